@@ -2,9 +2,13 @@ package dsdk
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	_path "path"
+	"reflect"
 	"strconv"
+	"sync"
+	"time"
 
 	greq "github.com/levigross/grequests"
 )
@@ -76,7 +80,7 @@ func newAppInstances(path string) *AppInstances {
 func (e *AppInstances) Create(ro *AppInstancesCreateRequest) (*AppInstance, *ApiErrorResponse, error) {
 	gro := &greq.RequestOptions{JSON: ro}
 	rs, apierr, err := GetConn(ro.Ctxt).Post(ro.Ctxt, e.Path, gro)
-	Log().Debugf("App Instance create request sent to go-sdk with following data, %#v", ro)
+	GetConn(ro.Ctxt).logFor(ro.Ctxt).Debug(fmt.Sprintf("App Instance create request sent to go-sdk with following data, %#v", ro), nil)
 	if apierr != nil {
 		return nil, apierr, err
 	}
@@ -181,7 +185,16 @@ type AppInstanceDeleteRequest struct {
 }
 
 func (e *AppInstance) Delete(ro *AppInstanceDeleteRequest) (*AppInstance, *ApiErrorResponse, error) {
-	rs, apierr, err := GetConn(ro.Ctxt).Delete(ro.Ctxt, e.Path, nil)
+	if ro == nil {
+		return nil, nil, badStatus[InvalidRequest]
+	}
+	v := reflect.ValueOf(*ro)
+	t := reflect.TypeOf(*ro)
+	gro := &greq.RequestOptions{
+		JSON: ro,
+	}
+	formatQueryParams(gro, v, t)
+	rs, apierr, err := GetConn(ro.Ctxt).Delete(ro.Ctxt, e.Path, gro)
 	if apierr != nil {
 		return nil, apierr, err
 	}
@@ -277,3 +290,219 @@ func (e *AppInstance) Reload(ro *AppInstanceReloadRequest) (*AppInstance, *ApiEr
 	RegisterAppInstanceEndpoints(resp)
 	return resp, nil, nil
 }
+
+// AppInstanceCloneOptions controls what AppInstances.Clone copies from the source
+type AppInstanceCloneOptions struct {
+	// StorageInstances copies the source's storage instance and volume configuration.
+	// None of their data is copied
+	StorageInstances bool
+}
+
+// Clone creates an app instance named newName configured like the one named srcName.
+// Fields the server manages, like uuids, paths and states, are left for it to fill
+// in.  opts may be nil
+func (e *AppInstances) Clone(ctxt context.Context, srcName, newName string, opts *AppInstanceCloneOptions) (*AppInstance, *ApiErrorResponse, error) {
+	src, apierr, err := e.Get(&AppInstancesGetRequest{Ctxt: ctxt, Id: srcName})
+	if apierr != nil {
+		return nil, apierr, err
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	ro := &AppInstancesCreateRequest{
+		Ctxt:           ctxt,
+		Name:           newName,
+		Descr:          src.Descr,
+		RepairPriority: src.RepairPriority,
+		StoragePool:    storagePoolRefs(src.StoragePool),
+	}
+	if opts != nil && opts.StorageInstances {
+		for _, si := range src.StorageInstances {
+			ro.StorageInstances = append(ro.StorageInstances, cloneStorageInstance(si))
+		}
+	}
+	return e.Create(ro)
+}
+
+// cloneStorageInstance returns the configuration of si without anything the server
+// manages
+func cloneStorageInstance(si *StorageInstance) *StorageInstance {
+	c := &StorageInstance{
+		Name:                 si.Name,
+		AccessControlMode:    si.AccessControlMode,
+		ServiceConfiguration: si.ServiceConfiguration,
+	}
+	if si.Auth != nil {
+		auth := *si.Auth
+		auth.Path = ""
+		c.Auth = &auth
+	}
+	if si.IpPool != nil {
+		c.IpPool = &AccessNetworkIpPool{Path: si.IpPool.Path}
+	}
+	for _, vol := range si.Volumes {
+		v := &Volume{
+			Name:          vol.Name,
+			Size:          vol.Size,
+			ReplicaCount:  vol.ReplicaCount,
+			PlacementMode: vol.PlacementMode,
+			StoragePool:   storagePoolRefs(vol.StoragePool),
+		}
+		if vol.PlacementPolicy != nil {
+			v.PlacementPolicy = &PlacementPolicy{Path: vol.PlacementPolicy.Path}
+		}
+		c.Volumes = append(c.Volumes, v)
+	}
+	return c
+}
+
+// storagePoolRefs refers to pools by path alone
+func storagePoolRefs(pools []*StoragePool) []*StoragePool {
+	var refs []*StoragePool
+	for _, p := range pools {
+		refs = append(refs, &StoragePool{Path: p.Path})
+	}
+	return refs
+}
+
+// ErrWaitTimeout is returned by WaitForState and StorageNodes.WaitForDrain when the
+// object waited on doesn't reach the desired state in time
+var ErrWaitTimeout = errors.New("timeout reached before reaching the desired state")
+
+// WaitForState polls the app instance named name until its op_state is desired and
+// returns it.  Polls are spaced out like retries are, using the connection's backoff.
+// If timeout passes first the last version seen is returned with ErrWaitTimeout
+func (e *AppInstances) WaitForState(ctxt context.Context, name, desired string, timeout time.Duration) (*AppInstance, *ApiErrorResponse, error) {
+	var last *AppInstance
+	apierr, err := pollUntil(ctxt, timeout, "app instance "+name, desired, func(ctxt context.Context) (string, *ApiErrorResponse, error) {
+		ai, apierr, err := e.Get(&AppInstancesGetRequest{Ctxt: ctxt, Id: name})
+		if apierr != nil || err != nil {
+			return "", apierr, err
+		}
+		last = ai
+		return ai.OpState, nil, nil
+	})
+	return last, apierr, err
+}
+
+// pollUntil calls get, which returns the op_state of the object described by describe,
+// until it returns desired.  Polls are spaced out using the connection's backoff.  An
+// error from get ends the wait, and one caused by timeout passing rather than ctxt
+// ending is reported as ErrWaitTimeout
+func pollUntil(ctxt context.Context, timeout time.Duration, describe, desired string, get func(ctxt context.Context) (string, *ApiErrorResponse, error)) (*ApiErrorResponse, error) {
+	conn := GetConn(ctxt)
+	logger := conn.logFor(ctxt)
+	wctxt, cancel := context.WithTimeout(ctxt, timeout)
+	defer cancel()
+	state := "unknown"
+	timedOut := func(err error) error {
+		if ctxt.Err() != nil || wctxt.Err() == nil {
+			return err
+		}
+		return fmt.Errorf("%w: %s is %s after %s, expected %s", ErrWaitTimeout, describe, state, timeout, desired)
+	}
+	for attempt := 1; ; attempt++ {
+		got, apierr, err := get(wctxt)
+		if apierr != nil {
+			return apierr, err
+		}
+		if err != nil {
+			return nil, timedOut(err)
+		}
+		state = got
+		if state == desired {
+			return nil, nil
+		}
+		logger.Debug(fmt.Sprintf("%s is %s, waiting for %s", describe, state, desired), map[string]interface{}{
+			"object":   describe,
+			"op_state": state,
+			"attempt":  attempt,
+		})
+		select {
+		case <-time.After(conn.backoffInterval(attempt)):
+		case <-wctxt.Done():
+			return nil, timedOut(wctxt.Err())
+		}
+	}
+}
+
+// DeleteWhere deletes every app instance matching filter, taking those that are online
+// offline first, with up to concurrency deletions in flight at once.  It returns the
+// names of the deleted app instances and, if any couldn't be deleted, a BulkError.  An
+// empty filter is refused rather than deleting every app instance
+func (e *AppInstances) DeleteWhere(ctxt context.Context, filter string, concurrency int) ([]string, *ApiErrorResponse, error) {
+	if filter == "" {
+		return nil, nil, fmt.Errorf("%w: DeleteWhere needs a filter", ErrInvalidRequest)
+	}
+	ais, apierr, err := e.List(&AppInstancesListRequest{Ctxt: ctxt, Params: ListParams{Filter: filter}})
+	if apierr != nil {
+		return nil, apierr, err
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	var (
+		m       sync.Mutex
+		deleted []string
+		failed  = map[string]error{}
+	)
+	runConcurrently(len(ais), concurrency, func(i int) {
+		err := deleteAppInstance(ctxt, ais[i])
+		m.Lock()
+		defer m.Unlock()
+		if err != nil {
+			failed[ais[i].Name] = err
+			return
+		}
+		deleted = append(deleted, ais[i].Name)
+	})
+	if len(failed) > 0 {
+		return deleted, nil, &BulkError{Errors: failed}
+	}
+	return deleted, nil, nil
+}
+
+// deleteAppInstance takes ai offline, since the API refuses to delete online app
+// instances, and deletes it
+func deleteAppInstance(ctxt context.Context, ai *AppInstance) error {
+	if ai.AdminState != "offline" {
+		_, apierr, err := ai.Set(&AppInstanceSetRequest{Ctxt: ctxt, AdminState: "offline", Force: true})
+		if apierr != nil {
+			return apierr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	_, apierr, err := ai.Delete(&AppInstanceDeleteRequest{Ctxt: ctxt, Force: true})
+	if apierr != nil {
+		return apierr
+	}
+	return err
+}
+
+// SetOnline brings the app instance named name online and returns it.  Nothing is
+// changed if it's already online
+func (e *AppInstances) SetOnline(ctxt context.Context, name string) (*AppInstance, *ApiErrorResponse, error) {
+	return e.setAdminState(ctxt, name, "online")
+}
+
+// SetOffline takes the app instance named name offline and returns it.  Nothing is
+// changed if it's already offline
+func (e *AppInstances) SetOffline(ctxt context.Context, name string) (*AppInstance, *ApiErrorResponse, error) {
+	return e.setAdminState(ctxt, name, "offline")
+}
+
+func (e *AppInstances) setAdminState(ctxt context.Context, name, state string) (*AppInstance, *ApiErrorResponse, error) {
+	ai, apierr, err := e.Get(&AppInstancesGetRequest{Ctxt: ctxt, Id: name})
+	if apierr != nil {
+		return nil, apierr, err
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if ai.AdminState == state {
+		return ai, nil, nil
+	}
+	return ai.Set(&AppInstanceSetRequest{Ctxt: ctxt, AdminState: state})
+}
@@ -3,6 +3,7 @@ package dsdk
 import (
 	"context"
 	_path "path"
+	"reflect"
 
 	greq "github.com/levigross/grequests"
 )
@@ -146,7 +147,16 @@ type AppTemplateDeleteRequest struct {
 }
 
 func (e *AppTemplate) Delete(ro *AppTemplateDeleteRequest) (*AppTemplate, *ApiErrorResponse, error) {
-	rs, apierr, err := GetConn(ro.Ctxt).Delete(ro.Ctxt, e.Path, nil)
+	if ro == nil {
+		return nil, nil, badStatus[InvalidRequest]
+	}
+	v := reflect.ValueOf(*ro)
+	t := reflect.TypeOf(*ro)
+	gro := &greq.RequestOptions{
+		JSON: ro,
+	}
+	formatQueryParams(gro, v, t)
+	rs, apierr, err := GetConn(ro.Ctxt).Delete(ro.Ctxt, e.Path, gro)
 	if apierr != nil {
 		return nil, apierr, err
 	}
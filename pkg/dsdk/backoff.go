@@ -0,0 +1,95 @@
+package dsdk
+
+import (
+	"math/rand"
+	"time"
+)
+
+var (
+	// DefaultMaxBackoff is the longest single sleep between retries when an
+	// ApiConnection doesn't configure its own with WithMaxBackoff
+	DefaultMaxBackoff = 30 * time.Second
+)
+
+// Jitter selects how the retry backoff is randomized so that many clients
+// retrying against the same cluster don't wake up in lockstep
+type Jitter int
+
+const (
+	// EqualJitter sleeps for half of the computed backoff plus a random
+	// amount up to the other half.  This is the default
+	EqualJitter Jitter = iota
+	// FullJitter sleeps for a random amount between zero and the computed backoff
+	FullJitter
+	// NoJitter sleeps for exactly the computed backoff
+	NoJitter
+)
+
+// BackoffStrategy computes how long to sleep before a retry.  attempt starts at 1
+// for the first retry and grows by one for each subsequent retry
+type BackoffStrategy interface {
+	NextInterval(attempt int) time.Duration
+}
+
+// QuadraticBackoff is the default BackoffStrategy.  It sleeps attempt*attempt
+// seconds, capped at Max and randomized according to Jitter
+type QuadraticBackoff struct {
+	// Max caps a single sleep.  Defaults to DefaultMaxBackoff
+	Max time.Duration
+	// Jitter selects how the sleep is randomized.  Defaults to EqualJitter
+	Jitter Jitter
+	// Rand returns values in the range [0.0, 1.0).  Defaults to rand.Float64
+	Rand func() float64
+}
+
+// NextInterval implements BackoffStrategy
+func (q QuadraticBackoff) NextInterval(attempt int) time.Duration {
+	max := q.Max
+	if max <= 0 {
+		max = DefaultMaxBackoff
+	}
+	d := max
+	// compare in seconds first so large attempt counts can't overflow the Duration
+	if secs := int64(attempt) * int64(attempt); secs <= int64(max/time.Second) {
+		d = time.Second * time.Duration(secs)
+	}
+	rnd := q.Rand
+	if rnd == nil {
+		rnd = rand.Float64
+	}
+	switch q.Jitter {
+	case FullJitter:
+		return time.Duration(rnd() * float64(d))
+	case NoJitter:
+		return d
+	default:
+		half := d / 2
+		return half + time.Duration(rnd()*float64(d-half))
+	}
+}
+
+// backoffInterval returns how long to sleep before the given retry attempt using the
+// connection's BackoffStrategy, or QuadraticBackoff when none was configured
+func (c *ApiConnection) backoffInterval(backoff int) time.Duration {
+	if c.backoffStrategy != nil {
+		return c.backoffStrategy.NextInterval(backoff)
+	}
+	return QuadraticBackoff{Max: c.maxBackoff, Jitter: c.jitter, Rand: c.jitterSource}.NextInterval(backoff)
+}
+
+// retrySleep returns the backoff for the given retry attempt bounded by the time
+// remaining in the retry window.  A non-zero retryAfter, as requested by the server,
+// replaces the computed backoff
+func (c *ApiConnection) retrySleep(backoff int, retryAfter, remaining time.Duration) time.Duration {
+	d := retryAfter
+	if d <= 0 {
+		d = c.backoffInterval(backoff)
+	}
+	if d > remaining {
+		d = remaining
+	}
+	if d < 0 {
+		d = 0
+	}
+	return d
+}
@@ -0,0 +1,127 @@
+package dsdk
+
+import (
+	"testing"
+	"time"
+
+	udc "github.com/Datera/go-udc/pkg/udc"
+)
+
+func newTestConnection(opts ...ApiConnectionOption) *ApiConnection {
+	return NewApiConnection(&udc.UDC{
+		MgmtIp:     "127.0.0.1",
+		Username:   "foo",
+		Password:   "bar",
+		ApiVersion: "1",
+	}, false, opts...)
+}
+
+func Test_backoffInterval(t *testing.T) {
+	fixed := func(f float64) func() float64 {
+		return func() float64 { return f }
+	}
+	tests := []struct {
+		name    string
+		opts    []ApiConnectionOption
+		backoff int
+		want    time.Duration
+	}{
+		{
+			name:    "equal jitter is the default",
+			opts:    []ApiConnectionOption{WithJitterSource(fixed(0.5))},
+			backoff: 2,
+			want:    3 * time.Second,
+		},
+		{
+			name:    "equal jitter never drops below half the backoff",
+			opts:    []ApiConnectionOption{WithJitter(EqualJitter), WithJitterSource(fixed(0))},
+			backoff: 2,
+			want:    2 * time.Second,
+		},
+		{
+			name:    "full jitter scales the whole backoff",
+			opts:    []ApiConnectionOption{WithJitter(FullJitter), WithJitterSource(fixed(0.25))},
+			backoff: 2,
+			want:    time.Second,
+		},
+		{
+			name:    "no jitter uses the squared backoff",
+			opts:    []ApiConnectionOption{WithJitter(NoJitter), WithJitterSource(fixed(0.25))},
+			backoff: 3,
+			want:    9 * time.Second,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestConnection(tt.opts...)
+			if got := c.backoffInterval(tt.backoff); got != tt.want {
+				t.Errorf("backoffInterval() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_retrySleepBoundedByRemainingWindow(t *testing.T) {
+	c := newTestConnection(WithJitter(NoJitter))
+	if got := c.retrySleep(3, 0, 2*time.Second); got != 2*time.Second {
+		t.Errorf("retrySleep() = %v, want %v", got, 2*time.Second)
+	}
+	if got := c.retrySleep(3, 0, -time.Second); got != 0 {
+		t.Errorf("retrySleep() = %v, want 0", got)
+	}
+	if got := c.retrySleep(3, 20*time.Second, 10*time.Second); got != 10*time.Second {
+		t.Errorf("retrySleep() = %v, want %v", got, 10*time.Second)
+	}
+}
+
+func Test_retrySleepPrefersRetryAfter(t *testing.T) {
+	c := newTestConnection(WithJitter(NoJitter))
+	if got := c.retrySleep(1, 2*time.Second, time.Minute); got != 2*time.Second {
+		t.Errorf("retrySleep() = %v, want %v", got, 2*time.Second)
+	}
+}
+
+func Test_parseRetryAfter(t *testing.T) {
+	tests := []struct {
+		header string
+		want   time.Duration
+	}{
+		{header: "", want: 0},
+		{header: "2", want: 2 * time.Second},
+		{header: "-1", want: 0},
+		{header: "soon", want: 0},
+		{header: "Wed, 21 Oct 2015 07:28:00 GMT", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			if got := parseRetryAfter(tt.header); got != tt.want {
+				t.Errorf("parseRetryAfter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_backoffIntervalCapped(t *testing.T) {
+	for _, max := range []time.Duration{0, 5 * time.Second, 1500 * time.Millisecond} {
+		c := newTestConnection(WithMaxBackoff(max), WithJitter(NoJitter))
+		want := max
+		if want == 0 {
+			want = DefaultMaxBackoff
+		}
+		for backoff := 1; backoff <= 10000; backoff++ {
+			if got := c.backoffInterval(backoff); got > want || got <= 0 {
+				t.Fatalf("attempt %d: backoffInterval() = %v, want in (0, %v]", backoff, got, want)
+			}
+		}
+	}
+}
+
+func Test_backoffIntervalBelowCapUnchanged(t *testing.T) {
+	c := newTestConnection(WithMaxBackoff(1500*time.Millisecond), WithJitter(NoJitter))
+	if got := c.backoffInterval(1); got != time.Second {
+		t.Errorf("backoffInterval() = %v, want %v", got, time.Second)
+	}
+	if got := c.backoffInterval(2); got != 1500*time.Millisecond {
+		t.Errorf("backoffInterval() = %v, want %v", got, 1500*time.Millisecond)
+	}
+}
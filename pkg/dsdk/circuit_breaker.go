@@ -0,0 +1,110 @@
+package dsdk
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	ErrCircuitOpen = errors.New("circuit breaker is open, cluster is not reachable")
+)
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// circuitBreaker fails requests fast once the cluster has been unreachable or failing
+// with 5xx responses for a number of consecutive requests.  After the cooldown a single
+// probe request is let through; if the cluster answers it without a 5xx the circuit
+// closes again, otherwise it reopens
+type circuitBreaker struct {
+	m         sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	state     circuitState
+	failures  int
+	openedAt  time.Time
+	now       func() time.Time
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+	}
+}
+
+// allow returns ErrCircuitOpen if the request should not be sent
+func (b *circuitBreaker) allow() error {
+	b.m.Lock()
+	defer b.m.Unlock()
+	switch b.state {
+	case circuitOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return ErrCircuitOpen
+		}
+		// let this request through as the probe, everyone else waits on its result
+		b.state = circuitHalfOpen
+		return nil
+	case circuitHalfOpen:
+		return ErrCircuitOpen
+	default:
+		return nil
+	}
+}
+
+// record updates the circuit with the outcome of a request that allow let through.
+// status is the HTTP status of the response, 0 if there was none, and err is the error
+// returned by translateErrors
+func (b *circuitBreaker) record(status int, err error) {
+	b.m.Lock()
+	defer b.m.Unlock()
+	switch {
+	case isClusterFailure(status, err):
+		b.failures++
+		if b.state == circuitHalfOpen || b.failures >= b.threshold {
+			b.state = circuitOpen
+			b.openedAt = b.now()
+		}
+	case err != nil && isTransportError(err):
+		// the caller gave up on the request before it got an answer so it tells us
+		// nothing about the cluster.  Give up the probe
+		// without restarting the cooldown
+		if b.state == circuitHalfOpen {
+			b.state = circuitOpen
+		}
+	default:
+		b.state = circuitClosed
+		b.failures = 0
+	}
+}
+
+// isClusterFailure reports whether a request failed because of the cluster: it got no
+// answer for any reason other than its context ending (connection refused, dial and i/o
+// timeouts, no route to host, ...) or it was answered with a 5xx
+func isClusterFailure(status int, err error) bool {
+	if status >= 500 || err == badStatus[ConnectionError] {
+		return true
+	}
+	if err == nil || !isTransportError(err) {
+		return false
+	}
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
+
+// isTransportError reports whether err was produced without receiving a response
+func isTransportError(err error) bool {
+	for _, e := range badStatus {
+		if err == e {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,125 @@
+package dsdk
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func Test_circuitBreakerTransitions(t *testing.T) {
+	now := time.Now()
+	b := newCircuitBreaker(2, time.Minute)
+	b.now = func() time.Time { return now }
+
+	b.record(0, badStatus[ConnectionError])
+	if err := b.allow(); err != nil {
+		t.Fatalf("circuit opened before reaching the threshold: %s", err)
+	}
+	b.record(0, badStatus[ConnectionError])
+	if err := b.allow(); err != ErrCircuitOpen {
+		t.Fatalf("expected ErrCircuitOpen after 2 connection errors, got %v", err)
+	}
+
+	// half-open: a single probe is let through once the cooldown passes
+	now = now.Add(time.Minute)
+	if err := b.allow(); err != nil {
+		t.Fatalf("expected the probe to be allowed, got %s", err)
+	}
+	if err := b.allow(); err != ErrCircuitOpen {
+		t.Fatalf("expected only one probe while half-open, got %v", err)
+	}
+
+	// a failed probe reopens the circuit for another cooldown
+	b.record(0, badStatus[ConnectionError])
+	if err := b.allow(); err != ErrCircuitOpen {
+		t.Fatalf("expected ErrCircuitOpen after a failed probe, got %v", err)
+	}
+	now = now.Add(time.Minute)
+	if err := b.allow(); err != nil {
+		t.Fatalf("expected the probe to be allowed, got %s", err)
+	}
+
+	// any response from the cluster other than a 5xx, even an error, closes the circuit
+	b.record(NotFound, nil)
+	for i := 0; i < 3; i++ {
+		if err := b.allow(); err != nil {
+			t.Fatalf("expected the circuit to be closed, got %s", err)
+		}
+	}
+	b.record(0, badStatus[ConnectionError])
+	if err := b.allow(); err != nil {
+		t.Fatalf("failure count wasn't reset when the circuit closed: %s", err)
+	}
+}
+
+func Test_circuitBreakerInconclusiveProbe(t *testing.T) {
+	now := time.Now()
+	b := newCircuitBreaker(1, time.Minute)
+	b.now = func() time.Time { return now }
+
+	b.record(0, badStatus[ConnectionError])
+	now = now.Add(time.Minute)
+	if err := b.allow(); err != nil {
+		t.Fatalf("expected the probe to be allowed, got %s", err)
+	}
+	// a cancelled probe says nothing about the cluster, so the next caller may probe
+	b.record(0, context.Canceled)
+	if err := b.allow(); err != nil {
+		t.Fatalf("expected another probe to be allowed, got %s", err)
+	}
+}
+
+func Test_circuitBreakerCountsClusterFailures(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		err    error
+		opens  bool
+	}{
+		{"connection refused", 0, badStatus[ConnectionError], true},
+		{"dial timeout", 0, &url.Error{Op: "Get", URL: "http://cluster", Err: &net.OpError{Op: "dial", Err: timeoutError{}}}, true},
+		{"i/o timeout", 0, &url.Error{Op: "Get", URL: "http://cluster", Err: &net.OpError{Op: "read", Err: timeoutError{}}}, true},
+		{"no route to host", 0, &url.Error{Op: "Get", URL: "http://cluster", Err: &net.OpError{Op: "dial", Err: syscall.EHOSTUNREACH}}, true},
+		{"500", 500, nil, true},
+		{"503", Retry503, badStatus[Retry503], true},
+		{"504", 504, nil, true},
+		{"404", NotFound, nil, false},
+		{"429", TooManyRequests, badStatus[TooManyRequests], false},
+		{"cancelled", 0, &url.Error{Op: "Get", URL: "http://cluster", Err: context.Canceled}, false},
+		{"deadline exceeded", 0, &url.Error{Op: "Get", URL: "http://cluster", Err: context.DeadlineExceeded}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newCircuitBreaker(1, time.Minute)
+			b.record(tt.status, tt.err)
+			if err := b.allow(); (err == ErrCircuitOpen) != tt.opens {
+				t.Errorf("expected the circuit to open %v, got %v", tt.opens, err)
+			}
+		})
+	}
+}
+
+// timeoutError is a net.Error that timed out, as returned for dial and i/o timeouts
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func Test_circuitBreakerShortCircuitsRequests(t *testing.T) {
+	c := newTestConnection(WithCircuitBreaker(1, time.Minute))
+	c.breaker.record(0, badStatus[ConnectionError])
+	_, _, err := c.Get(context.Background(), "system", nil)
+	if err != ErrCircuitOpen {
+		t.Errorf("expected ErrCircuitOpen, got %v", err)
+	}
+}
+
+func TestWithCircuitBreakerInvalidThreshold(t *testing.T) {
+	if err := newTestConnection(WithCircuitBreaker(0, time.Minute)).Err(); err == nil {
+		t.Error("expected an error for a zero threshold")
+	}
+}
@@ -0,0 +1,119 @@
+package dsdk
+
+import (
+	"context"
+	"fmt"
+)
+
+// CleanupOptions controls what SDK.Cleanup does
+type CleanupOptions struct {
+	// DryRun lists what would be deleted without deleting anything
+	DryRun bool
+}
+
+// Cleanup deletes the AppInstances, with their StorageInstances, AppTemplates,
+// InitiatorGroups and Initiators of the tenant the SDK is configured with, taking online
+// app instances offline first.  Every request is made in that tenant whatever ctxt
+// carries, and initiators belonging to another tenant, such as those inherited from
+// root, are left alone.  It refuses to clean the root tenant.  It returns the paths
+// deleted, or that would be with opts.DryRun, and a BulkError for those that couldn't
+// be.  opts may be nil
+func (c SDK) Cleanup(ctxt context.Context, opts *CleanupOptions) ([]string, *ApiErrorResponse, error) {
+	c.Conn.m.RLock()
+	tenant := c.Conn.tenant
+	c.Conn.m.RUnlock()
+	if tenant == "" || tenantPath(tenant) == "/root" {
+		return nil, nil, fmt.Errorf("%w: cleanup needs a tenant other than root to be configured", ErrInvalidRequest)
+	}
+	tenant = tenantPath(tenant)
+	ctxt = WithRequestTenant(ctxt, tenant)
+	dryRun := opts != nil && opts.DryRun
+
+	var deleted []string
+	failed := map[string]error{}
+	clean := func(path string, del func() (*ApiErrorResponse, error)) {
+		if !dryRun {
+			if apierr, err := del(); apierr != nil {
+				failed[path] = apierr
+				return
+			} else if err != nil {
+				failed[path] = err
+				return
+			}
+		}
+		deleted = append(deleted, path)
+	}
+
+	ais, apierr, err := c.AppInstances.List(&AppInstancesListRequest{Ctxt: ctxt})
+	if apierr != nil || err != nil {
+		return nil, apierr, err
+	}
+	for _, ai := range ais {
+		ai := ai
+		if !dryRun && ai.AdminState != "offline" {
+			if _, apierr, err := ai.Set(&AppInstanceSetRequest{Ctxt: ctxt, AdminState: "offline", Force: true}); apierr != nil {
+				failed[ai.Path] = apierr
+				continue
+			} else if err != nil {
+				failed[ai.Path] = err
+				continue
+			}
+		}
+		for _, si := range ai.StorageInstances {
+			si := si
+			clean(si.Path, func() (*ApiErrorResponse, error) {
+				_, apierr, err := si.Delete(&StorageInstanceDeleteRequest{Ctxt: ctxt, Force: true})
+				return apierr, err
+			})
+		}
+		clean(ai.Path, func() (*ApiErrorResponse, error) {
+			_, apierr, err := ai.Delete(&AppInstanceDeleteRequest{Ctxt: ctxt, Force: true})
+			return apierr, err
+		})
+	}
+
+	ats, apierr, err := c.AppTemplates.List(&AppTemplatesListRequest{Ctxt: ctxt})
+	if apierr != nil || err != nil {
+		return deleted, apierr, err
+	}
+	for _, at := range ats {
+		at := at
+		clean(at.Path, func() (*ApiErrorResponse, error) {
+			_, apierr, err := at.Delete(&AppTemplateDeleteRequest{Ctxt: ctxt, Force: true})
+			return apierr, err
+		})
+	}
+
+	// groups go before the initiators they hold
+	igs, apierr, err := c.InitiatorGroups.List(&InitiatorGroupsListRequest{Ctxt: ctxt})
+	if apierr != nil || err != nil {
+		return deleted, apierr, err
+	}
+	for _, ig := range igs {
+		ig := ig
+		clean(ig.Path, func() (*ApiErrorResponse, error) {
+			_, apierr, err := ig.Delete(&InitiatorGroupDeleteRequest{Ctxt: ctxt})
+			return apierr, err
+		})
+	}
+
+	inits, apierr, err := c.Initiators.List(&InitiatorsListRequest{Ctxt: ctxt})
+	if apierr != nil || err != nil {
+		return deleted, apierr, err
+	}
+	for _, in := range inits {
+		in := in
+		if in.Tenant != "" && tenantPath(in.Tenant) != tenant {
+			continue
+		}
+		clean(in.Path, func() (*ApiErrorResponse, error) {
+			_, apierr, err := in.Delete(&InitiatorDeleteRequest{Ctxt: ctxt})
+			return apierr, err
+		})
+	}
+
+	if len(failed) > 0 {
+		return deleted, nil, &BulkError{Errors: failed}
+	}
+	return deleted, nil, nil
+}
@@ -6,6 +6,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"path"
@@ -20,23 +22,42 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// Requests that fail with these statuses return an error, or an ApiErrorResponse,
+// matching them with errors.Is
+var (
+	ErrInvalidRequest     = errors.New("InvalidRequest")
+	ErrPermissionDenied   = errors.New("PermissionDenied")
+	ErrTooManyRequests    = errors.New("TooManyRequests")
+	ErrServiceUnavailable = errors.New("Retry503")
+	ErrConnectionError    = errors.New("ConnectionError")
+	ErrNotFound           = errors.New("NotFound")
+	ErrConflict           = errors.New("Conflict")
+)
+
 var (
 	RetryTimeout           = int64(300)
 	ErrRetryTimeout        = errors.New("timeout reached before request completed successfully during retries")
+	ErrMaxAttempts         = errors.New("maximum attempts reached before request completed successfully during retries")
 	InvalidRequest         = 400
 	PermissionDenied       = 401
+	NotFound               = 404
+	Conflict               = 409
+	TooManyRequests        = 429
 	Retry503               = 503
 	ConnectionError        = 9998
 	RetryRequestAfterLogin = 9999
 	badStatus              = map[int]error{
-		InvalidRequest:         fmt.Errorf("InvalidRequest"),
-		PermissionDenied:       fmt.Errorf("PermissionDenied"),
-		Retry503:               fmt.Errorf("Retry503"),
-		ConnectionError:        fmt.Errorf("ConnectionError"),
+		InvalidRequest:         ErrInvalidRequest,
+		PermissionDenied:       ErrPermissionDenied,
+		TooManyRequests:        ErrTooManyRequests,
+		Retry503:               ErrServiceUnavailable,
+		ConnectionError:        ErrConnectionError,
 		RetryRequestAfterLogin: fmt.Errorf("RetryRequestAfterLogin"),
 	}
 	DateraDriver = fmt.Sprintf("Golang-SDK-%s", VERSION)
-	logTraceID   = "trace_id"
+	// IdempotencyKeyHeader carries the request id when idempotency keys are enabled
+	IdempotencyKeyHeader = "Idempotency-Key"
+	logTraceID           = "trace_id"
 )
 
 const (
@@ -56,6 +77,44 @@ type ApiConnection struct {
 	apikey     string
 	baseUrl    *url.URL
 	httpClient *http.Client
+	err        error
+
+	// retryTimeout overrides the package level RetryTimeout when non-zero
+	retryTimeout       time.Duration
+	maxBackoff         time.Duration
+	jitter             Jitter
+	jitterSource       func() float64
+	retryableStatuses  map[int]bool
+	maxAttempts        int
+	backoffStrategy    BackoffStrategy
+	breaker            *circuitBreaker
+	onRetry            func(attempt int, status int, err error, next time.Duration)
+	idempotencyKeys    bool
+	retryUnsafeMethods bool
+	budget             *retryBudget
+	tlsConfig          *tls.Config
+	tlsMinVersion      uint16
+	// ownTransport is set by options that need a dedicated http.Transport even for
+	// plain HTTP connections
+	ownTransport        bool
+	maxIdleConns        int
+	maxIdleConnsPerHost int
+	idleConnTimeout     time.Duration
+	port                int
+	proxy               func(*http.Request) (*url.URL, error)
+	dialContext         func(ctx context.Context, network, addr string) (net.Conn, error)
+	sessionTTL          time.Duration
+	sessionExpiry       time.Time
+	loginMu             sync.Mutex
+	loginCall           *loginCall
+	loginTimeout        time.Duration
+	onReauth            func(reason string, err error)
+	pageSize            int
+	logger              Logger
+	tracer              Tracer
+	metrics             MetricsSink
+	redactedFields      map[string]bool
+	validateApiVersion  bool
 }
 
 type ApiErrorResponse struct {
@@ -75,6 +134,42 @@ type ApiErrorResponse struct {
 	Id           int               `json:"api_req_id,omitempty"`
 	TenancyClass string            `json:"tenancy_class,omitempty"`
 	Errors       []string          `json:"errors,omitempty"`
+
+	// RetryAfter is populated from the Retry-After header of rate limited responses
+	RetryAfter time.Duration `json:"-"`
+}
+
+// Error formats the response so it can be returned as an error, recoverable with
+// errors.As
+func (e *ApiErrorResponse) Error() string {
+	if e == nil {
+		return "<nil>"
+	}
+	name := e.Name
+	if name == "" {
+		name = "ApiError"
+	}
+	msg := fmt.Sprintf("%s: %s (code %d, http %d, op %s, path %s)", name, e.Message, e.Code, e.Http, e.Op, e.Path)
+	if len(e.Errors) > 0 {
+		msg += ": " + strings.Join(e.Errors, "; ")
+	}
+	return msg
+}
+
+// Is reports whether target is the sentinel error for the response's HTTP status, such
+// as ErrPermissionDenied for a 401
+func (e *ApiErrorResponse) Is(target error) bool {
+	if e == nil {
+		return false
+	}
+	switch e.Http {
+	case NotFound:
+		return target == ErrNotFound
+	case Conflict:
+		return target == ErrConflict
+	}
+	sentinel, ok := badStatus[e.Http]
+	return ok && target == sentinel
 }
 
 type ApiLogin struct {
@@ -96,6 +191,13 @@ type ApiListOuter struct {
 	Path     string                 `json:"path,omitempty"`
 }
 
+// TotalCount returns the number of items in the whole collection as reported by the
+// server, or false if the server didn't report it
+func (l *ApiListOuter) TotalCount() (int, bool) {
+	total, ok := l.Metadata["total_count"].(float64)
+	return int(total), ok
+}
+
 type ApiOuter struct {
 	Data     map[string]interface{} `json:"data,omitempty"`
 	Version  string                 `json:"version,omitempty"`
@@ -218,22 +320,42 @@ func ListRangeParamsFromMap(m map[string]string) *ListRangeParams {
 	return lp
 }
 
-func init() {
-	// TODO(_alastor_): Disable this and do real certificate verification
-	http.DefaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
-}
-
-func makeBaseUrl(h, apiv string, secure bool) (*url.URL, error) {
+// makeBaseUrl builds the API url for the management host h, which may be a hostname,
+// an IPv4 address or an IPv6 address with or without brackets.  The port defaults to
+// 7718 for HTTPS and 7717 for HTTP and can be overridden either by port or by giving h
+// in host:port form, with port taking precedence
+func makeBaseUrl(h, apiv string, secure bool, port int) (*url.URL, error) {
 	h = strings.Trim(h, "/")
+	if host, p, err := net.SplitHostPort(h); err == nil {
+		h = host
+		if port == 0 {
+			if port, err = strconv.Atoi(p); err != nil {
+				return nil, fmt.Errorf("invalid port in management address %s: %w", h, err)
+			}
+		}
+	}
+	// IPv6 literals may come bracketed without a port, JoinHostPort adds the brackets
+	// back and the zone needs escaping for url.Parse
+	h = strings.TrimSuffix(strings.TrimPrefix(h, "["), "]")
+	if strings.Contains(h, ":") && strings.Contains(h, "%") && !strings.Contains(h, "%25") {
+		h = strings.Replace(h, "%", "%25", 1)
+	}
+	scheme := "http"
 	if secure {
-		return url.Parse(fmt.Sprintf("https://%s:7718/v%s", h, apiv))
+		scheme = "https"
+	}
+	if port == 0 {
+		port = 7717
+		if secure {
+			port = 7718
+		}
 	}
-	return url.Parse(fmt.Sprintf("http://%s:7717/v%s", h, apiv))
+	return url.Parse(fmt.Sprintf("%s://%s/v%s", scheme, net.JoinHostPort(h, strconv.Itoa(port)), apiv))
 }
 
-func translateErrors(ctxt context.Context, resp *greq.Response, err error) (*ApiErrorResponse, error) {
+func translateErrors(logger Logger, resp *greq.Response, err error) (*ApiErrorResponse, error) {
 	if err != nil {
-		WithUserFields(ctxt, Log()).Error(err)
+		logger.Error(err.Error(), nil)
 		if strings.Contains(err.Error(), "connect: connection refused") {
 			return nil, badStatus[ConnectionError]
 		}
@@ -244,7 +366,7 @@ func translateErrors(ctxt context.Context, resp *greq.Response, err error) (*Api
 		eresp := &ApiErrorResponse{}
 		err := resp.JSON(eresp)
 		if err != nil {
-			WithUserFields(ctxt, Log()).Error(fmt.Sprintf("failed to unmarshal ApiErrorResponse %+v: %v", eresp, err))
+			logger.Error(fmt.Sprintf("failed to unmarshal ApiErrorResponse %+v: %v", eresp, err), nil)
 		}
 
 		// in some cases (like 503s) the response JSON doesn't contain
@@ -253,59 +375,284 @@ func translateErrors(ctxt context.Context, resp *greq.Response, err error) (*Api
 		if eresp.Http == 0 {
 			eresp.Http = resp.StatusCode
 		}
+		eresp.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
 		return eresp, badStatus[resp.StatusCode]
 	}
 	return nil, nil
 }
 
-// hasLoggedIn reports whether the ApiConnection has successfully authenticated once
-func (c *ApiConnection) hasLoggedIn() bool {
+// parseRetryAfter converts a Retry-After header, given either as a number of seconds
+// or as an HTTP date, into a duration.  Missing or malformed values return 0
+func parseRetryAfter(h string) time.Duration {
+	if h == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(h); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(h); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// defaultRetryableStatuses returns the statuses retried when an ApiConnection
+// doesn't configure its own with WithRetryableStatuses
+func defaultRetryableStatuses() map[int]bool {
+	return map[int]bool{
+		TooManyRequests: true,
+		Retry503:        true,
+		ConnectionError: true,
+	}
+}
+
+// isRetryable reports whether a failed attempt should be retried according to the
+// connection's retryable statuses.  Connection errors are represented by ConnectionError
+func (c *ApiConnection) isRetryable(apiresp *ApiErrorResponse, err error) bool {
+	return retryable(c.retryableStatuses, apiresp, err)
+}
+
+// retryable reports whether a request that failed with apiresp or err is retried when
+// statuses are the retryable ones.  It's shared with IsRetryable so the two can't drift
+func retryable(statuses map[int]bool, apiresp *ApiErrorResponse, err error) bool {
+	if apiresp != nil {
+		return statuses[apiresp.Http]
+	}
+	if err == nil {
+		return false
+	}
+	if statuses[ConnectionError] && strings.Contains(err.Error(), "connect: connection refused") {
+		return true
+	}
+	for status := range statuses {
+		if sentinel, ok := badStatus[status]; ok && errors.Is(err, sentinel) {
+			return true
+		}
+	}
+	return false
+}
+
+// canRetryMethod reports whether requests with the given method may be retried.  Only
+// idempotent methods are retried unless RetryUnsafeMethods was set.  Login requests,
+// the only ones made without allowLogin, have no side effects and are always retried
+func (c *ApiConnection) canRetryMethod(method string, allowLogin bool) bool {
+	if c.retryUnsafeMethods || !allowLogin {
+		return true
+	}
+	switch method {
+	case "GET", "DELETE", "HEAD":
+		return true
+	}
+	return false
+}
+
+// needsLogin reports whether requests must be authenticated with a login.  A connection
+// without a username that presents a client certificate relies on the certificate alone
+func (c *ApiConnection) needsLogin() bool {
+	c.m.RLock()
+	defer c.m.RUnlock()
+	return c.username != "" || c.tlsConfig == nil || len(c.tlsConfig.Certificates) == 0
+}
+
+// expireSession drops the current session when it is close enough to its expiry that
+// it might expire mid-request, so the next request logs in again instead of failing
+// with a 401 first
+func (c *ApiConnection) expireSession() {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if c.apikey == "" || c.sessionExpiry.IsZero() || !c.hasCredentialsLocked() {
+		return
+	}
+	// refresh once 90% of the TTL has passed
+	if time.Until(c.sessionExpiry) <= c.sessionTTL/10 {
+		c.logFor(context.Background()).Debug("session is about to expire, logging in again", nil)
+		c.apikey = ""
+	}
+}
+
+// hasCredentials reports whether the ApiConnection has a username and password to log in with
+func (c *ApiConnection) hasCredentials() bool {
+	c.m.RLock()
+	defer c.m.RUnlock()
+	return c.hasCredentialsLocked()
+}
+
+func (c *ApiConnection) hasCredentialsLocked() bool {
+	return c.username != "" && c.password != ""
+}
+
+// IsLoggedIn reports whether the ApiConnection currently holds an API key, either from
+// a successful Login or one it was given.  Calling Login up front lets a burst of
+// requests share a single login
+func (c *ApiConnection) IsLoggedIn() bool {
 	c.m.RLock()
 	defer c.m.RUnlock()
 	return c.apikey != ""
 }
 
-func (c *ApiConnection) retry(ctxt context.Context, method, url string, ro *greq.RequestOptions, rs interface{}, sensitive, allowLogin bool) (*ApiErrorResponse, error) {
-	t1 := time.Now().Unix()
+// getRetryTimeout returns the retry window for this connection, falling back
+// to the package level RetryTimeout when one wasn't configured
+func (c *ApiConnection) getRetryTimeout() time.Duration {
+	if c.retryTimeout > 0 {
+		return c.retryTimeout
+	}
+	return time.Duration(RetryTimeout) * time.Second
+}
+
+// waitToRetry sleeps for d or until the context is done, whichever comes first
+func (c *ApiConnection) waitToRetry(ctxt context.Context, d time.Duration) error {
+	if stats := retryStatsFromContext(ctxt); stats != nil {
+		defer func(t1 time.Time) { stats.Backoff += time.Since(t1) }(time.Now())
+	}
+	select {
+	case <-time.After(d):
+		return nil
+	case <-ctxt.Done():
+		c.logFor(ctxt).Debug(fmt.Sprintf("context done while waiting to retry request: %s", ctxt.Err()), nil)
+		return ctxt.Err()
+	}
+}
+
+// notifyRetry calls the OnRetry callback, if any, about the attempt that just failed
+func (c *ApiConnection) notifyRetry(attempt int, apiresp *ApiErrorResponse, err error, next time.Duration) {
+	if c.onRetry == nil {
+		return
+	}
+	status := 0
+	if apiresp != nil {
+		status = apiresp.Http
+		// the response says everything there is to say about the failure
+		err = nil
+	} else if err == badStatus[ConnectionError] {
+		status = ConnectionError
+	}
+	c.onRetry(attempt, status, err, next)
+}
+
+// notifyReauth calls the OnReauth callback, if any, with the outcome of a re-login
+func (c *ApiConnection) notifyReauth(reason string, apiresp *ApiErrorResponse, err error) {
+	if c.onReauth == nil {
+		return
+	}
+	if err == nil && apiresp != nil {
+		err = fmt.Errorf("login failed with status %d: %s", apiresp.Http, apiresp.Message)
+	}
+	c.onReauth(reason, err)
+}
+
+// retry re-issues a request until it succeeds, fails with a non-retryable error or the
+// retry window is exhausted.  last and lastErr are the response and error that
+// triggered the retries
+func (c *ApiConnection) retry(ctxt context.Context, method, url string, ro *greq.RequestOptions, rs interface{}, sensitive, allowLogin bool, last *ApiErrorResponse, lastErr error) (*ApiErrorResponse, error) {
+	t1 := time.Now()
+	timeout := c.getRetryTimeout()
 	backoff := 1
-	var apiresp *ApiErrorResponse
-	for time.Now().Unix()-t1 < RetryTimeout {
+	// the request that triggered the retries counts as the first attempt
+	attempts := 1
+	// keep hold of the most recent failure so giving up still says why
+	failure := c.failureResponse(url, last, lastErr)
+	if c.maxAttempts > 0 && attempts >= c.maxAttempts {
+		return failure, fmt.Errorf("%w: %d", ErrMaxAttempts, attempts)
+	}
+	if c.budget != nil && !c.budget.withdraw() {
+		return failure, ErrRetryBudgetExhausted
+	}
+	// the first retry goes out right away unless the server told us how long to back off
+	var wait time.Duration
+	if last != nil && last.RetryAfter > 0 {
+		wait = c.retrySleep(backoff, last.RetryAfter, timeout)
+	}
+	c.notifyRetry(attempts, last, lastErr, wait)
+	if wait > 0 {
+		if err := c.waitToRetry(ctxt, wait); err != nil {
+			return nil, err
+		}
+	}
+	for time.Since(t1) < timeout {
+		attempts++
 		// any call to `do` from within a retry must use `false` for retry param
 		apiresp, err := c.do(ctxt, method, url, ro, rs, !canRetry, sensitive, allowLogin)
 		if apiresp == nil && err == nil {
 			return nil, nil
 		}
 
-		// Retry on 503 and ConnectionErrors only
-		if apiresp != nil && apiresp.Http != 503 {
-			return apiresp, nil
-		} else if err != nil && !strings.Contains(err.Error(), "connect: connection refused") {
-			return nil, err
+		if !c.isRetryable(apiresp, err) {
+			return apiresp, err
+		}
+		failure = c.failureResponse(url, apiresp, err)
+		if c.maxAttempts > 0 && attempts >= c.maxAttempts {
+			return failure, fmt.Errorf("%w: %d", ErrMaxAttempts, attempts)
+		}
+		if c.budget != nil && !c.budget.withdraw() {
+			return failure, ErrRetryBudgetExhausted
 		}
 
-		time.Sleep(time.Second * time.Duration(backoff*backoff))
+		var retryAfter time.Duration
+		if apiresp != nil {
+			retryAfter = apiresp.RetryAfter
+		}
+		wait := c.retrySleep(backoff, retryAfter, timeout-time.Since(t1))
+		c.notifyRetry(attempts, apiresp, err, wait)
+		if err := c.waitToRetry(ctxt, wait); err != nil {
+			return nil, err
+		}
 		backoff += 1
 	}
-	return apiresp, ErrRetryTimeout
+	return failure, ErrRetryTimeout
+}
+
+// failureResponse returns apiresp, or when the cluster couldn't be reached at all an
+// ApiErrorResponse synthesized from err, so that a request that gives up retrying can
+// tell an unreachable cluster apart from one that keeps failing requests
+func (c *ApiConnection) failureResponse(url string, apiresp *ApiErrorResponse, err error) *ApiErrorResponse {
+	if apiresp != nil || err == nil {
+		return apiresp
+	}
+	status := 0
+	if err == badStatus[ConnectionError] {
+		status = ConnectionError
+	}
+	return &ApiErrorResponse{
+		Name:    err.Error(),
+		Http:    status,
+		Message: fmt.Sprintf("could not connect to %s: %s", c.baseUrl.Host, err),
+		Path:    path.Join(c.baseUrl.Path, url),
+	}
 }
 
 func (c *ApiConnection) do(ctxt context.Context, method, url string, ro *greq.RequestOptions, rs interface{}, retry, sensitive, allowLogin bool) (*ApiErrorResponse, error) {
+	logger := c.logFor(ctxt)
+	// only the outermost call resets the stats, retries and re-authenticated
+	// requests add to them
+	if stats := retryStatsFromContext(ctxt); stats != nil && retry {
+		*stats = RetryStats{}
+		defer func(t1 time.Time) { stats.Elapsed = time.Since(t1) }(time.Now())
+	}
+	if c.budget != nil && retry {
+		c.budget.deposit()
+	}
+	if c.breaker != nil {
+		if err := c.breaker.allow(); err != nil {
+			logger.Debug(fmt.Sprintf("not sending %s %s: %s", method, url, err), nil)
+			return nil, err
+		}
+	}
 	gurl := *c.baseUrl
 	gurl.Path = path.Join(gurl.Path, url)
 	reqId := uuid.Must(uuid.NewRandom()).String()
 	sdata, err := json.Marshal(ro.JSON)
 	if err != nil {
-		WithUserFields(ctxt, Log()).Errorf("Couldn't stringify data, %s", ro.JSON)
-	}
-	// Strip all CHAP credentails before printing to logs
-	if strings.Contains(string(sdata), "target_user_name") == true {
-		sdata = []byte("********")
-	}
-	if strings.Contains(string(sdata), "secret") == true {
-		sdata = []byte("********")
+		logger.Error(fmt.Sprintf("Couldn't stringify data, %s", ro.JSON), nil)
 	}
+	// Strip all CHAP credentails and other secrets before printing to logs
+	sdata = redactPayload(sdata, c.redactedFields)
 	if sensitive {
-		sdata = []byte("********")
+		sdata = []byte(redactedValue)
 	}
 	if ro.HTTPClient == nil && c.httpClient != nil {
 		ro.HTTPClient = c.httpClient
@@ -317,24 +664,33 @@ func (c *ApiConnection) do(ctxt context.Context, method, url string, ro *greq.Re
 		ro.Headers = make(map[string]string, 1)
 	}
 	ro.Headers["Datera-Driver"] = DateraDriver
-	tid, ok := ctxt.Value("tid").(string)
+	if c.idempotencyKeys {
+		// retries and re-authenticated attempts share ro with the first attempt, so
+		// the key it set identifies the whole logical request
+		if key, ok := ro.Headers[IdempotencyKeyHeader]; ok {
+			reqId = key
+		} else {
+			ro.Headers[IdempotencyKeyHeader] = reqId
+		}
+	}
+	tid, ok := traceIDFromContext(ctxt)
 	if !ok {
 		tid = "nil"
 	}
-	if _, ok := ctxt.Value("quiet").(bool); ok {
+	if isQuiet(ctxt) {
 		sdata = []byte("<muted>")
 	}
 	t1 := time.Now()
 	// This will be run before each request.  It's needed so we can get access
 	// to the headers/body passed with the request instead of just our custom ones
-	if Log().Logger.GetLevel() >= log.DebugLevel {
+	if debugEnabled(logger) {
 		ro.BeforeRequest = func(h *http.Request) error {
 			sheaders, err := json.Marshal(h.Header)
 			if err != nil {
-				WithUserFields(ctxt, Log()).Errorf("Couldn't stringify headers, %s", h.Header)
+				logger.Error(fmt.Sprintf("Couldn't stringify headers, %s", h.Header), nil)
 			}
 
-			WithUserFields(ctxt, Log()).WithFields(log.Fields{
+			logger.Debug("Datera SDK making request", map[string]interface{}{
 				logTraceID:        tid,
 				"request_id":      reqId,
 				"request_method":  method,
@@ -343,22 +699,31 @@ func (c *ApiConnection) do(ctxt context.Context, method, url string, ro *greq.Re
 				"request_headers": sheaders,
 				"request_payload": string(sdata),
 				"query_params":    ro.Params,
-			}).Debugf("Datera SDK making request")
+			})
 			return nil
 		}
 	}
 
+	route := canonicalizeRoute(gurl.Path, c.apiVersion)
+	span := c.startSpan(ctxt, route)
 	// The actual request happens here
 	// Context is passed through ro.Context
 	resp, err := greq.DoRegularRequest(method, gurl.String(), ro)
 
 	t2 := time.Now()
 	tDelta := t2.Sub(t1)
-	rdata := resp.String()
-	if _, ok := ctxt.Value("quiet").(bool); ok {
+	stream, streaming := rs.(*bodyStream)
+	var rdata string
+	if streaming && resp.Ok {
+		// reading the body here would buffer all of it, leave it to the caller
+		rdata = "<streamed>"
+	} else {
+		rdata = resp.String()
+	}
+	if isQuiet(ctxt) {
 		rdata = "<muted>"
 	}
-	detailLog := WithUserFields(ctxt, Log()).WithFields(log.Fields{
+	detailFields := map[string]interface{}{
 		logTraceID:           tid,
 		"request_id":         reqId,
 		"response_timedelta": tDelta.Seconds(),
@@ -368,11 +733,49 @@ func (c *ApiConnection) do(ctxt context.Context, method, url string, ro *greq.Re
 		"request_route":      canonicalizeRoute(gurl.Path, c.apiVersion),
 		"response_payload":   rdata,
 		"response_code":      resp.StatusCode,
-	})
+	}
 
-	detailLog.Debugf("Datera SDK response received")
+	logger.Debug("Datera SDK response received", detailFields)
 
-	eresp, err := translateErrors(ctxt, resp, err)
+	eresp, err := translateErrors(logger, resp, err)
+	span.SetAttributes(map[string]interface{}{
+		"http.method":      method,
+		"http.status_code": resp.StatusCode,
+		"request_id":       reqId,
+	})
+	var failure error
+	if err != nil {
+		failure = err
+	} else if eresp != nil {
+		failure = fmt.Errorf("%d: %s", eresp.Http, eresp.Message)
+	}
+	if failure != nil {
+		span.RecordError(failure)
+	}
+	span.End()
+	if c.metrics != nil {
+		status := resp.StatusCode
+		if err == badStatus[ConnectionError] {
+			status = ConnectionError
+		}
+		c.metrics.ObserveRequest(RequestMetric{
+			Method:   method,
+			Route:    route,
+			Status:   status,
+			Duration: tDelta,
+			Err:      failure,
+		})
+	}
+	if c.breaker != nil {
+		c.breaker.record(resp.StatusCode, err)
+	}
+	if stats := retryStatsFromContext(ctxt); stats != nil {
+		stats.Attempts++
+		stats.LastStatus = resp.StatusCode
+		if err == badStatus[ConnectionError] {
+			stats.LastStatus = ConnectionError
+		}
+	}
 
 	if err == badStatus[PermissionDenied] {
 		// if we have logged in successfully before we may just need to refresh the apikey
@@ -381,10 +784,19 @@ func (c *ApiConnection) do(ctxt context.Context, method, url string, ro *greq.Re
 		// a Login we can't do anything without deadlocking.  In this case we need to just return
 		// the error
 
-		if allowLogin && c.hasLoggedIn() {
-			c.Logout()
-			if apiresp, err2 := c.Login(ctxt); apiresp != nil || err2 != nil {
-				detailLog.Errorf("failed to re-authenticate before retrying request: %s", err2)
+		// a connection seeded with only an API key has nothing to log in again with
+		if allowLogin && c.IsLoggedIn() && !c.hasCredentials() {
+			logger.Error("API key was rejected and no credentials are configured to re-authenticate", detailFields)
+			return eresp, nil
+		}
+		if allowLogin && c.IsLoggedIn() {
+			// only drop the session this request was rejected with, if a concurrent
+			// request already replaced it there's no need to log in again
+			c.logoutSession(ro.Headers["Auth-Token"])
+			apiresp, err2 := c.Login(ctxt)
+			c.notifyReauth(fmt.Sprintf("%s %s was denied", method, url), apiresp, err2)
+			if apiresp != nil || err2 != nil {
+				logger.Error(fmt.Sprintf("failed to re-authenticate before retrying request: %s", err2), detailFields)
 				return apiresp, err2
 			}
 			c.m.RLock()
@@ -398,63 +810,127 @@ func (c *ApiConnection) do(ctxt context.Context, method, url string, ro *greq.Re
 		return eresp, nil
 
 	}
-	if retry && (err == badStatus[Retry503] || err == badStatus[ConnectionError]) {
-		return c.retry(ctxt, method, url, ro, rs, sensitive, allowLogin)
+	if retry && c.canRetryMethod(method, allowLogin) && c.isRetryable(eresp, err) {
+		return c.retry(ctxt, method, url, ro, rs, sensitive, allowLogin, eresp, err)
 	}
 	if eresp != nil {
-		detailLog.Errorf("Received API Error %s", Pretty(eresp))
+		logger.Error(fmt.Sprintf("Received API Error %s", Pretty(eresp)), detailFields)
 		return eresp, nil
 	}
 	if err != nil {
-		detailLog.Errorf("Error during translateErrors: %s", err)
+		logger.Error(fmt.Sprintf("Error during translateErrors: %s", err), detailFields)
 		return nil, err
 	}
+	if streaming {
+		stream.body = resp.RawResponse.Body
+		stream.header = resp.Header
+		return nil, nil
+	}
+	// decoding drains the response, keep the body to report it if that fails
+	body := resp.Bytes()
+	if raw, ok := rs.(*rawBody); ok {
+		*raw = body
+		return nil, nil
+	}
 	err = resp.JSON(rs)
 	if err != nil {
-		detailLog.Errorf("Could not unpack response, err: %s with response: %s", err, resp.String())
-		return nil, err
+		logger.Error(fmt.Sprintf("Could not unpack response, err: %s with response: %s", err, body), detailFields)
+		return nil, &UnmarshalError{Status: resp.StatusCode, Route: route, Body: body, Err: err}
 	}
 	return nil, nil
 }
 
 func (c *ApiConnection) doWithAuth(ctxt context.Context, method, url string, ro *greq.RequestOptions, rs interface{}) (*ApiErrorResponse, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
 	if ro == nil {
 		ro = &greq.RequestOptions{}
 	}
+	c.expireSession()
 	// don't need to check the loggingIn flag first because doWithAuth is not called from Login
 	// so that won't deadlock
-	if !c.hasLoggedIn() {
+	if c.needsLogin() && !c.IsLoggedIn() {
 		if apierr, err := c.Login(ctxt); apierr != nil || err != nil {
-			WithUserFields(ctxt, Log()).Errorf("Login failure: %s, %s", Pretty(apierr), err)
+			c.logFor(ctxt).Error(fmt.Sprintf("Login failure: %s, %s", Pretty(apierr), err), nil)
 			return apierr, err
 		}
 	}
+	// send a copy so the caller's ro can be reused, the tenant resolved for this request
+	// would otherwise look like an override the next time
+	out := *ro
+	out.Headers = make(map[string]string, len(ro.Headers)+2)
+	for k, v := range ro.Headers {
+		out.Headers[k] = v
+	}
 	c.m.RLock()
-	ro.Headers = map[string]string{"tenant": c.tenant, "Auth-Token": c.apikey}
+	out.Headers["tenant"] = c.requestTenant(ctxt, ro)
+	out.Headers["Auth-Token"] = c.apikey
 	c.m.RUnlock()
-	return c.do(ctxt, method, url, ro, rs, canRetry, !isSensitive, allowLogin)
+	return c.do(ctxt, method, url, &out, rs, canRetry, !isSensitive, allowLogin)
 }
 
-func NewApiConnection(c *udc.UDC, secure bool) *ApiConnection {
-	return NewApiConnectionWithHTTPClient(c, secure, nil)
+// requestTenant returns the tenant a request is made in: a tenant header set on ro, then
+// one attached to the context with WithRequestTenant, then the connection's tenant.
+// The caller must hold the read lock
+func (c *ApiConnection) requestTenant(ctxt context.Context, ro *greq.RequestOptions) string {
+	if t := ro.Headers["tenant"]; t != "" {
+		return t
+	}
+	if t, ok := ctxt.Value(tenantCtxKey).(string); ok && t != "" {
+		return t
+	}
+	return c.tenant
 }
 
-func NewApiConnectionWithHTTPClient(c *udc.UDC, secure bool, client *http.Client) *ApiConnection {
-	u, err := makeBaseUrl(c.MgmtIp, c.ApiVersion, secure)
-	if err != nil {
-		Log().Fatalf("%s", err)
-	}
-	return &ApiConnection{
+func NewApiConnection(c *udc.UDC, secure bool, opts ...ApiConnectionOption) *ApiConnection {
+	return NewApiConnectionWithHTTPClient(c, secure, nil, opts...)
+}
+
+// NewApiConnectionWithHTTPClient creates an ApiConnection using the provided http.Client.
+// When client is nil a secure connection, or one configured with transport options,
+// gets its own http.Transport while plain HTTP connections use http.DefaultClient.
+// http.DefaultTransport is never modified.
+// Any ApiConnectionOption that fails to apply is logged and returned by every subsequent
+// request made with the connection.
+func NewApiConnectionWithHTTPClient(c *udc.UDC, secure bool, client *http.Client, opts ...ApiConnectionOption) *ApiConnection {
+	conn := &ApiConnection{
 		username:   c.Username,
 		password:   c.Password,
 		apiVersion: c.ApiVersion,
 		tenant:     c.Tenant,
 		ldap:       c.Ldap,
 		secure:     secure,
-		baseUrl:    u,
 		httpClient: client,
 		m:          &sync.RWMutex{},
+
+		retryableStatuses: defaultRetryableStatuses(),
+		logger:            NewLogrusLogger(log.NewEntry(log.StandardLogger())),
+		redactedFields:    defaultRedactedFields(),
 	}
+	for _, opt := range opts {
+		if err := opt(conn); err != nil {
+			Log().Errorf("failed to apply ApiConnection option: %s", err)
+			conn.err = err
+			break
+		}
+	}
+	u, err := makeBaseUrl(c.MgmtIp, c.ApiVersion, secure, conn.port)
+	if err != nil {
+		Log().Fatalf("%s", err)
+	}
+	conn.baseUrl = u
+	// plain HTTP has no TLS settings to carry, so unless an option needs it, keep using
+	// the default client there
+	if conn.httpClient == nil && (secure || conn.ownTransport) {
+		conn.httpClient = &http.Client{Transport: conn.newTransport()}
+	}
+	return conn
+}
+
+// Err returns the error encountered while applying ApiConnectionOptions, if any
+func (c *ApiConnection) Err() error {
+	return c.err
 }
 
 func (c *ApiConnection) Get(ctxt context.Context, url string, ro *greq.RequestOptions) (*ApiOuter, *ApiErrorResponse, error) {
@@ -465,21 +941,61 @@ func (c *ApiConnection) Get(ctxt context.Context, url string, ro *greq.RequestOp
 
 func (c *ApiConnection) GetList(ctxt context.Context, url string, ro *greq.RequestOptions) (*ApiListOuter, *ApiErrorResponse, error) {
 	rs := &ApiListOuter{}
+	lp := ListParamsFromMap(ro.Params)
+	paginate := lp.Limit == 0 && lp.Offset == 0
+	limit := 0
+	if limitAsTotal(ctxt) {
+		paginate, limit = true, lp.Limit
+	}
+	// pageLimit is the limit to request a page with once collected items are in hand
+	pageLimit := func(collected int) int {
+		n := c.pageSize
+		if limit != 0 && (n == 0 || limit-collected < n) {
+			n = limit - collected
+		}
+		return n
+	}
+	if n := pageLimit(0); paginate && n != 0 {
+		if ro.Params == nil {
+			ro.Params = map[string]string{}
+		}
+		ro.Params["limit"] = strconv.FormatInt(int64(n), 10)
+	}
 	apiresp, err := c.doWithAuth(ctxt, "GET", url, ro, rs)
-	// TODO:(_alastor_) handle pulling paged entries
+	onPage := pageFuncFromContext(ctxt)
+	if apiresp == nil && err == nil && onPage != nil {
+		if err := onPage(rs); err != nil {
+			return rs, nil, err
+		}
+	}
 
 	if apiresp == nil && len(rs.Metadata) > 0 {
-		lp := ListParamsFromMap(ro.Params)
-		if lp.Limit != 0 || lp.Offset != 0 {
+		if !paginate {
 			return rs, apiresp, err
 		}
+		// every page is decoded into rs, keep the first page's metadata for the list
+		metadata := rs.Metadata
+		defer func() { rs.Metadata = metadata }()
 		data := rs.Data
-		offset := 0
+		offset := lp.Offset
 		tcnt := 0
-		for ldata := len(data); ldata != tcnt; {
-			tcnt := int(rs.Metadata["total_count"].(float64))
+		for ldata := len(data); ldata != tcnt; ldata = len(data) {
+			if err := ctxt.Err(); err != nil {
+				rs.Data = data
+				return rs, nil, err
+			}
+			if limit != 0 && ldata >= limit {
+				break
+			}
+			// older firmware can leave total_count out, treat that as a single page
+			total, ok := rs.TotalCount()
+			if !ok {
+				break
+			}
+			tcnt = total
 			offset += len(rs.Data)
-			if offset >= tcnt {
+			// an empty page would never move the offset forward
+			if offset >= tcnt || len(rs.Data) == 0 {
 				break
 			}
 			if ro.Params == nil {
@@ -488,18 +1004,31 @@ func (c *ApiConnection) GetList(ctxt context.Context, url string, ro *greq.Reque
 				}.ToMap()
 			} else {
 				// there are api endpoints that handle lists with more fields than
-				// ListParams (but still have offset/limit in common)
+				// ListParams (but still have offset/limit in common), such as the
+				// since/from/to bounds of ListRangeParams
 				// just update offset directly here to preserve those extra fields
 				ro.Params["offset"] = strconv.FormatInt(int64(offset), 10)
 			}
-			rs.Data = []interface{}{}
+			if n := pageLimit(len(data)); n != 0 {
+				ro.Params["limit"] = strconv.FormatInt(int64(n), 10)
+			}
+			rs.Data, rs.Metadata = []interface{}{}, nil
 			apiresp, err := c.doWithAuth(ctxt, "GET", url, ro, rs)
 			if apiresp != nil || err != nil {
 				rs.Data = data
 				return rs, apiresp, err
 			}
+			if onPage != nil {
+				if err := onPage(rs); err != nil {
+					rs.Data = append(data, rs.Data...)
+					return rs, nil, err
+				}
+			}
 			data = append(data, rs.Data...)
 		}
+		if limit != 0 && len(data) > limit {
+			data = data[:limit]
+		}
 		rs.Data = data
 	}
 	return rs, apiresp, err
@@ -517,6 +1046,45 @@ func (c *ApiConnection) Post(ctxt context.Context, url string, ro *greq.RequestO
 	return rs, apiresp, err
 }
 
+// rawBody receives a response's body as is in place of a decoded envelope
+type rawBody []byte
+
+// DoRaw makes a request like Get, Put and friends do, logging in and retrying as
+// needed, but returns the response body without decoding it.  Use it for endpoints
+// that don't answer with the usual envelope
+func (c *ApiConnection) DoRaw(ctxt context.Context, method, url string, ro *greq.RequestOptions) ([]byte, *ApiErrorResponse, error) {
+	var body rawBody
+	apiresp, err := c.doWithAuth(ctxt, method, url, ro, &body)
+	return body, apiresp, err
+}
+
+// bodyStream receives a response's body unread in place of a decoded envelope
+type bodyStream struct {
+	body   io.ReadCloser
+	header http.Header
+}
+
+// DoStream makes a request like DoRaw does, logging in and retrying until a
+// successful response is received, but returns its body unread so large payloads
+// can be consumed without holding them in memory.  The caller must close the body.
+// Error responses are decoded and returned as usual
+func (c *ApiConnection) DoStream(ctxt context.Context, method, url string, ro *greq.RequestOptions) (io.ReadCloser, *ApiErrorResponse, error) {
+	stream := &bodyStream{}
+	apiresp, err := c.doWithAuth(ctxt, method, url, ro, stream)
+	if apiresp != nil || err != nil {
+		return nil, apiresp, err
+	}
+	return stream.body, nil, nil
+}
+
+// Patch partially updates the resource at url.  Like Put and Post it's only retried
+// with WithRetryUnsafeMethods
+func (c *ApiConnection) Patch(ctxt context.Context, url string, ro *greq.RequestOptions) (*ApiOuter, *ApiErrorResponse, error) {
+	rs := &ApiOuter{}
+	apiresp, err := c.doWithAuth(ctxt, "PATCH", url, ro, rs)
+	return rs, apiresp, err
+}
+
 func (c *ApiConnection) Delete(ctxt context.Context, url string, ro *greq.RequestOptions) (*ApiOuter, *ApiErrorResponse, error) {
 	rs := &ApiOuter{}
 	apiresp, err := c.doWithAuth(ctxt, "DELETE", url, ro, rs)
@@ -524,22 +1092,94 @@ func (c *ApiConnection) Delete(ctxt context.Context, url string, ro *greq.Reques
 }
 
 func (c *ApiConnection) ApiVersions() []string {
+	versions, err := c.apiVersions(context.Background())
+	if err != nil {
+		return []string{}
+	}
+	return versions
+}
+
+// ErrUnsupportedApiVersion is returned by NewSDK, with WithApiVersionCheck, when the
+// cluster doesn't support the UDC's api version
+var ErrUnsupportedApiVersion = errors.New("api version not supported by the cluster")
+
+// apiVersions fetches the API versions the cluster supports, unlike ApiVersions failing
+// when they can't be
+func (c *ApiConnection) apiVersions(ctxt context.Context) ([]string, error) {
 	gurl := *c.baseUrl
 	gurl.Path = "api_versions"
-	resp, err := greq.DoRegularRequest("GET", gurl.String(), nil)
+	resp, err := greq.Get(gurl.String(), &greq.RequestOptions{HTTPClient: c.httpClient, Context: ctxt})
 	if err != nil {
-		return []string{}
+		return nil, err
+	}
+	defer resp.Close()
+	if !resp.Ok {
+		return nil, fmt.Errorf("failed to get the cluster's api versions: status %d", resp.StatusCode)
 	}
 	apiv := &ApiVersions{}
-	resp.JSON(apiv)
-	return apiv.ApiVersions
+	if err = resp.JSON(apiv); err != nil {
+		return nil, err
+	}
+	return apiv.ApiVersions, nil
+}
+
+// checkApiVersion returns ErrUnsupportedApiVersion if the cluster doesn't list the
+// connection's api version among those it supports
+func (c *ApiConnection) checkApiVersion(ctxt context.Context) error {
+	versions, err := c.apiVersions(ctxt)
+	if err != nil {
+		return err
+	}
+	want := strings.TrimPrefix(c.apiVersion, "v")
+	for _, v := range versions {
+		if strings.TrimPrefix(v, "v") == want {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s, the cluster supports %s", ErrUnsupportedApiVersion, c.apiVersion, strings.Join(versions, ", "))
 }
 
+// loginCall is a login in progress that concurrent callers of Login wait on
+type loginCall struct {
+	done    chan struct{}
+	apiresp *ApiErrorResponse
+	err     error
+}
+
+// Login authenticates the connection.  Concurrent calls are coalesced into a single
+// login request whose result they all share
 func (c *ApiConnection) Login(ctxt context.Context) (*ApiErrorResponse, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	c.loginMu.Lock()
+	if call := c.loginCall; call != nil {
+		c.loginMu.Unlock()
+		select {
+		case <-call.done:
+			return call.apiresp, call.err
+		case <-ctxt.Done():
+			return nil, ctxt.Err()
+		}
+	}
+	call := &loginCall{done: make(chan struct{})}
+	c.loginCall = call
+	c.loginMu.Unlock()
+
+	call.apiresp, call.err = c.login(ctxt)
+
+	c.loginMu.Lock()
+	c.loginCall = nil
+	c.loginMu.Unlock()
+	close(call.done)
+	return call.apiresp, call.err
+}
+
+func (c *ApiConnection) login(ctxt context.Context) (*ApiErrorResponse, error) {
 	c.m.Lock()
 	defer c.m.Unlock()
 
-	// can't call hasLoggedIn since that needs to RLock but this is equivalent
+	// can't call IsLoggedIn since that needs to RLock but this is equivalent
 	if c.apikey != "" {
 		// any time the connection has an apikey we can skip the login because
 		// the apikey gets cleared after a session expiration before attempting to login
@@ -559,12 +1199,23 @@ func (c *ApiConnection) Login(ctxt context.Context) (*ApiErrorResponse, error) {
 		ro.Data["remote_server"] = c.ldap
 	}
 
-	apiresp, err := c.do(ctxt, "PUT", "login", ro, login, canRetry, isSensitive, !allowLogin)
+	// the login isn't part of the request the caller asked for stats about
+	lctxt := WithRetryStats(ctxt, nil)
+	if c.loginTimeout > 0 {
+		var cancel context.CancelFunc
+		lctxt, cancel = context.WithTimeout(lctxt, c.loginTimeout)
+		defer cancel()
+	}
+	apiresp, err := c.do(lctxt, "PUT", "login", ro, login, canRetry, isSensitive, !allowLogin)
 
 	if (apiresp != nil && apiresp.Http == PermissionDenied) || (err != nil && err == badStatus[PermissionDenied]) {
 		c.apikey = ""
 	} else {
 		c.apikey = login.Key
+		c.sessionExpiry = time.Time{}
+		if c.sessionTTL > 0 {
+			c.sessionExpiry = time.Now().Add(c.sessionTTL)
+		}
 	}
 
 	return apiresp, err
@@ -575,3 +1226,43 @@ func (c *ApiConnection) Logout() {
 	defer c.m.Unlock()
 	c.apikey = ""
 }
+
+// logoutSession clears the session if it still uses apikey
+func (c *ApiConnection) logoutSession(apikey string) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if c.apikey == apikey {
+		c.apikey = ""
+	}
+}
+
+// ExportSession returns the current session token and, when a session TTL is configured
+// or the session was restored with WithSession, when it expires.  Restore it in another
+// process with WithSession to skip logging in.  The token is empty if not logged in
+func (c *ApiConnection) ExportSession() (string, time.Time) {
+	c.m.RLock()
+	defer c.m.RUnlock()
+	return c.apikey, c.sessionExpiry
+}
+
+// SetTenant changes the tenant used by requests that don't specify their own.  The
+// current session is kept because Datera sends the tenant with every request rather
+// than binding it to the session token; on a cluster configured with tenant scoped
+// tokens call Logout afterwards so the next request logs in again
+func (c *ApiConnection) SetTenant(tenant string) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.tenant = tenant
+}
+
+// SetCredentials replaces the username, password and LDAP server used to log in and
+// drops the current session so the next request logs in with them.  Requests already
+// in flight complete with the session they started with
+func (c *ApiConnection) SetCredentials(username, password, ldap string) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.username = username
+	c.password = password
+	c.ldap = ldap
+	c.apikey = ""
+}
@@ -0,0 +1,400 @@
+package dsdk
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ApiConnectionOption configures optional behavior of an ApiConnection.  Options are
+// applied in order by NewApiConnection and NewApiConnectionWithHTTPClient
+type ApiConnectionOption func(*ApiConnection) error
+
+// WithRetryTimeout sets how long the ApiConnection keeps retrying a request before
+// giving up with ErrRetryTimeout.  When unset the package level RetryTimeout is used
+func WithRetryTimeout(d time.Duration) ApiConnectionOption {
+	return func(c *ApiConnection) error {
+		c.retryTimeout = d
+		return nil
+	}
+}
+
+// WithMaxBackoff caps how long the ApiConnection sleeps between any two retries.
+// Defaults to DefaultMaxBackoff.  Ignored when WithBackoffStrategy is used
+func WithMaxBackoff(d time.Duration) ApiConnectionOption {
+	return func(c *ApiConnection) error {
+		c.maxBackoff = d
+		return nil
+	}
+}
+
+// WithJitter selects how the retry backoff is randomized.  Defaults to EqualJitter.
+// Ignored when WithBackoffStrategy is used
+func WithJitter(j Jitter) ApiConnectionOption {
+	return func(c *ApiConnection) error {
+		c.jitter = j
+		return nil
+	}
+}
+
+// WithJitterSource overrides the random source used to jitter the retry backoff.
+// The function must return values in the range [0.0, 1.0)
+func WithJitterSource(f func() float64) ApiConnectionOption {
+	return func(c *ApiConnection) error {
+		c.jitterSource = f
+		return nil
+	}
+}
+
+// WithRetryableStatuses replaces the set of HTTP statuses that are retried.  Include
+// ConnectionError to keep retrying when the cluster can't be reached.  Defaults to
+// 429, 503 and ConnectionError
+func WithRetryableStatuses(statuses ...int) ApiConnectionOption {
+	return func(c *ApiConnection) error {
+		c.retryableStatuses = make(map[int]bool, len(statuses))
+		for _, s := range statuses {
+			c.retryableStatuses[s] = true
+		}
+		return nil
+	}
+}
+
+// WithMaxAttempts caps the number of times a request is sent, including the first
+// attempt, before giving up with ErrMaxAttempts.  Zero means attempts are only
+// bounded by the retry timeout
+func WithMaxAttempts(n int) ApiConnectionOption {
+	return func(c *ApiConnection) error {
+		c.maxAttempts = n
+		return nil
+	}
+}
+
+// WithBackoffStrategy replaces the default QuadraticBackoff used to space out retries.
+// A Retry-After sent by the server still takes precedence over the strategy
+func WithBackoffStrategy(b BackoffStrategy) ApiConnectionOption {
+	return func(c *ApiConnection) error {
+		c.backoffStrategy = b
+		return nil
+	}
+}
+
+// WithCircuitBreaker fails requests immediately with ErrCircuitOpen once threshold
+// consecutive requests couldn't reach the cluster or got a 5xx from it.  After cooldown
+// a single request is sent to probe the cluster and the circuit closes again if it gets
+// a response other than a 5xx.  Disabled by default
+func WithCircuitBreaker(threshold int, cooldown time.Duration) ApiConnectionOption {
+	return func(c *ApiConnection) error {
+		if threshold <= 0 {
+			return fmt.Errorf("circuit breaker threshold must be positive, got %d", threshold)
+		}
+		c.breaker = newCircuitBreaker(threshold, cooldown)
+		return nil
+	}
+}
+
+// WithOnRetry registers a callback that is invoked every time a failed request is
+// about to be retried, before backing off.  attempt is the number of the attempt
+// that failed, starting at 1, and status is its HTTP status or ConnectionError.  err
+// is only set when no response was received.  next is how long the connection will
+// sleep before sending the request again.  The callback runs on the requesting
+// goroutine so it should return quickly
+func WithOnRetry(f func(attempt int, status int, err error, next time.Duration)) ApiConnectionOption {
+	return func(c *ApiConnection) error {
+		c.onRetry = f
+		return nil
+	}
+}
+
+// WithIdempotencyKeys sends an Idempotency-Key header with every request.  The key
+// stays the same across all retries of a request so the cluster can recognize a
+// retried POST instead of creating the resource twice
+func WithIdempotencyKeys() ApiConnectionOption {
+	return func(c *ApiConnection) error {
+		c.idempotencyKeys = true
+		return nil
+	}
+}
+
+// WithRetryUnsafeMethods retries POST, PUT and PATCH requests as well as GET, DELETE
+// and HEAD.  Without idempotency keys a retried request may be applied twice, so this
+// is best paired with WithIdempotencyKeys
+func WithRetryUnsafeMethods() ApiConnectionOption {
+	return func(c *ApiConnection) error {
+		c.retryUnsafeMethods = true
+		return nil
+	}
+}
+
+// WithRetryBudget limits retries across all requests on the connection to ratio
+// retries per request, eg. 0.2 for one retry every five requests, with up to burst
+// retries banked.  Once the budget is spent failed requests return
+// ErrRetryBudgetExhausted instead of retrying.  Unlimited by default
+func WithRetryBudget(ratio float64, burst int) ApiConnectionOption {
+	return func(c *ApiConnection) error {
+		if ratio < 0 || burst < 0 {
+			return fmt.Errorf("retry budget ratio and burst must not be negative, got %v and %d", ratio, burst)
+		}
+		c.budget = newRetryBudget(ratio, burst)
+		return nil
+	}
+}
+
+// WithTLSConfig sets the TLS configuration used by secure connections.  Without it
+// the connection doesn't verify the cluster's certificate.  Replaces any TLS settings
+// made by earlier options and has no effect when an http.Client is supplied
+func WithTLSConfig(cfg *tls.Config) ApiConnectionOption {
+	return func(c *ApiConnection) error {
+		c.tlsConfig = cfg.Clone()
+		return nil
+	}
+}
+
+// WithCACertPEM trusts the PEM encoded CA certificates in pem when verifying the
+// cluster's certificate, and turns verification on.  Only used by secure connections
+func WithCACertPEM(pem []byte) ApiConnectionOption {
+	return func(c *ApiConnection) error {
+		return c.addCACerts(pem)
+	}
+}
+
+// WithCACertPath is like WithCACertPEM but reads the CA bundle from a file
+func WithCACertPath(path string) ApiConnectionOption {
+	return func(c *ApiConnection) error {
+		pem, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		return c.addCACerts(pem)
+	}
+}
+
+// WithClientCertificate presents cert to clusters that require mutual TLS.  When the
+// UDC has no username the certificate alone authenticates requests and the connection
+// doesn't log in.  Only used by secure connections
+func WithClientCertificate(cert tls.Certificate) ApiConnectionOption {
+	return func(c *ApiConnection) error {
+		cfg := c.mutableTLSConfig()
+		cfg.Certificates = append(cfg.Certificates, cert)
+		return nil
+	}
+}
+
+// WithClientCertFiles is like WithClientCertificate but loads a PEM encoded
+// certificate and key from files
+func WithClientCertFiles(certFile, keyFile string) ApiConnectionOption {
+	return func(c *ApiConnection) error {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		return WithClientCertificate(cert)(c)
+	}
+}
+
+// WithTLSMinVersion sets the oldest TLS version, eg. tls.VersionTLS13, that secure
+// connections accept.  Defaults to DefaultTLSMinVersion
+func WithTLSMinVersion(v uint16) ApiConnectionOption {
+	return func(c *ApiConnection) error {
+		switch v {
+		case tls.VersionTLS10, tls.VersionTLS11, tls.VersionTLS12, tls.VersionTLS13:
+			c.tlsMinVersion = v
+			return nil
+		}
+		return fmt.Errorf("unknown TLS version %#x", v)
+	}
+}
+
+// WithMaxIdleConns sets the maximum number of idle connections the connection's
+// dedicated transport keeps open.  Has no effect when an http.Client is supplied
+func WithMaxIdleConns(n int) ApiConnectionOption {
+	return func(c *ApiConnection) error {
+		c.maxIdleConns = n
+		c.ownTransport = true
+		return nil
+	}
+}
+
+// WithMaxIdleConnsPerHost sets the maximum number of idle connections the connection's
+// dedicated transport keeps open to the cluster.  Has no effect when an http.Client is
+// supplied
+func WithMaxIdleConnsPerHost(n int) ApiConnectionOption {
+	return func(c *ApiConnection) error {
+		c.maxIdleConnsPerHost = n
+		c.ownTransport = true
+		return nil
+	}
+}
+
+// WithIdleConnTimeout sets how long the connection's dedicated transport keeps an idle
+// connection open.  Has no effect when an http.Client is supplied
+func WithIdleConnTimeout(d time.Duration) ApiConnectionOption {
+	return func(c *ApiConnection) error {
+		c.idleConnTimeout = d
+		c.ownTransport = true
+		return nil
+	}
+}
+
+// WithPort overrides the management port, which otherwise defaults to 7718 for secure
+// connections and 7717 for plain HTTP, or to the port given with the UDC MgmtIp
+func WithPort(port int) ApiConnectionOption {
+	return func(c *ApiConnection) error {
+		if port <= 0 || port > 65535 {
+			return fmt.Errorf("invalid port %d", port)
+		}
+		c.port = port
+		return nil
+	}
+}
+
+// WithApiVersionCheck makes NewSDK and NewSDKWithHTTPClient fetch the cluster's api
+// versions and fail with ErrUnsupportedApiVersion if the UDC's api version isn't one
+// of them, rather than requests failing later with not found errors.  It costs an
+// extra request when the SDK is created
+func WithApiVersionCheck() ApiConnectionOption {
+	return func(c *ApiConnection) error {
+		c.validateApiVersion = true
+		return nil
+	}
+}
+
+// WithProxy routes requests through the proxy returned by proxy, see http.Transport.Proxy.
+// Has no effect when an http.Client is supplied
+func WithProxy(proxy func(*http.Request) (*url.URL, error)) ApiConnectionOption {
+	return func(c *ApiConnection) error {
+		c.proxy = proxy
+		c.ownTransport = true
+		return nil
+	}
+}
+
+// WithProxyURL routes requests through the proxy at proxyURL, except for hosts listed in
+// the NO_PROXY environment variable.  Requests to localhost are never proxied.  Has no
+// effect when an http.Client is supplied
+func WithProxyURL(proxyURL string) ApiConnectionOption {
+	return func(c *ApiConnection) error {
+		proxy, err := proxyFromURL(proxyURL)
+		if err != nil {
+			return err
+		}
+		return WithProxy(proxy)(c)
+	}
+}
+
+// WithDialContext replaces how the connection's transport opens network connections,
+// eg. for custom name resolution or to talk to an in-memory fake.  Has no effect when
+// an http.Client is supplied
+func WithDialContext(dial func(ctx context.Context, network, addr string) (net.Conn, error)) ApiConnectionOption {
+	return func(c *ApiConnection) error {
+		c.dialContext = dial
+		c.ownTransport = true
+		return nil
+	}
+}
+
+// WithAPIKey authenticates requests with an existing API key instead of logging in.  If
+// the key is rejected and the UDC has no username and password the request fails with
+// the permission denied error rather than attempting to log in
+func WithAPIKey(key string) ApiConnectionOption {
+	return func(c *ApiConnection) error {
+		c.apikey = key
+		return nil
+	}
+}
+
+// WithSessionTTL sets how long a session stays valid after logging in.  Requests made
+// when the session is close to expiring log in again first rather than waiting for the
+// cluster to reject the expired session.  Disabled by default
+func WithSessionTTL(ttl time.Duration) ApiConnectionOption {
+	return func(c *ApiConnection) error {
+		c.sessionTTL = ttl
+		return nil
+	}
+}
+
+// WithOnReauth registers a callback that is invoked whenever a request is rejected
+// because the session expired and the connection logs in again.  reason describes the
+// rejected request and err is nil if the login succeeded
+func WithOnReauth(f func(reason string, err error)) ApiConnectionOption {
+	return func(c *ApiConnection) error {
+		c.onReauth = f
+		return nil
+	}
+}
+
+// WithSession restores a session token previously returned by ExportSession so the
+// connection can skip logging in.  A zero expiry means the expiry is unknown.  Once the
+// session expires or is rejected the connection logs in again with its credentials
+func WithSession(token string, expiry time.Time) ApiConnectionOption {
+	return func(c *ApiConnection) error {
+		c.apikey = token
+		c.sessionExpiry = expiry
+		return nil
+	}
+}
+
+// WithLoginTimeout bounds how long logging in may take, including retries, both for
+// explicit calls to Login and for the logins requests make on their own.  It doesn't
+// change the retry window of other requests.  Unbounded by default
+func WithLoginTimeout(d time.Duration) ApiConnectionOption {
+	return func(c *ApiConnection) error {
+		c.loginTimeout = d
+		return nil
+	}
+}
+
+// WithPageSize sets how many items GetList and GetListIter ask for in each page when
+// paginating, trading memory for fewer round trips.  The server's default page size is
+// used when it isn't set
+func WithPageSize(n int) ApiConnectionOption {
+	return func(c *ApiConnection) error {
+		if n < 0 {
+			return fmt.Errorf("page size must not be negative, got %d", n)
+		}
+		c.pageSize = n
+		return nil
+	}
+}
+
+// WithLogger makes the connection log through l instead of logrus
+func WithLogger(l Logger) ApiConnectionOption {
+	return func(c *ApiConnection) error {
+		if l == nil {
+			return fmt.Errorf("logger must not be nil")
+		}
+		c.logger = l
+		return nil
+	}
+}
+
+// WithTracer makes the connection start a span with t for every request it sends
+func WithTracer(t Tracer) ApiConnectionOption {
+	return func(c *ApiConnection) error {
+		c.tracer = t
+		return nil
+	}
+}
+
+// WithMetricsSink makes the connection report every request it sends to sink
+func WithMetricsSink(sink MetricsSink) ApiConnectionOption {
+	return func(c *ApiConnection) error {
+		c.metrics = sink
+		return nil
+	}
+}
+
+// WithRedactedFields masks the values of the named JSON fields, in addition to
+// DefaultRedactedFields, wherever they appear in logged request payloads
+func WithRedactedFields(fields ...string) ApiConnectionOption {
+	return func(c *ApiConnection) error {
+		for _, f := range fields {
+			c.redactedFields[f] = true
+		}
+		return nil
+	}
+}
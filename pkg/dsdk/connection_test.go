@@ -0,0 +1,162 @@
+package dsdk
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_makeBaseUrl(t *testing.T) {
+	tests := []struct {
+		name   string
+		host   string
+		secure bool
+		port   int
+		want   string
+	}{
+		{name: "default https port", host: "1.1.1.1", secure: true, want: "https://1.1.1.1:7718/v2.2"},
+		{name: "default http port", host: "1.1.1.1", want: "http://1.1.1.1:7717/v2.2"},
+		{name: "port override", host: "1.1.1.1", secure: true, port: 8443, want: "https://1.1.1.1:8443/v2.2"},
+		{name: "port from management address", host: "1.1.1.1:8443", secure: true, want: "https://1.1.1.1:8443/v2.2"},
+		{name: "port override wins", host: "1.1.1.1:8443", port: 9000, want: "http://1.1.1.1:9000/v2.2"},
+		{name: "surrounding slashes", host: "/mgmt.example.com/", secure: true, want: "https://mgmt.example.com:7718/v2.2"},
+		{name: "bare IPv6", host: "fd00::1", secure: true, want: "https://[fd00::1]:7718/v2.2"},
+		{name: "bracketed IPv6", host: "[fd00::1]", secure: true, want: "https://[fd00::1]:7718/v2.2"},
+		{name: "bracketed IPv6 with port", host: "[fd00::1]:8443", secure: true, want: "https://[fd00::1]:8443/v2.2"},
+		{name: "IPv6 with port override", host: "fd00::1", port: 8080, want: "http://[fd00::1]:8080/v2.2"},
+		{name: "IPv6 with zone", host: "fe80::1%eth0", want: "http://[fe80::1%25eth0]:7717/v2.2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := makeBaseUrl(tt.host, "2.2", tt.secure, tt.port)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := u.String(); got != tt.want {
+				t.Errorf("makeBaseUrl() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithPort(t *testing.T) {
+	c := newTestConnection(WithPort(8443))
+	if got := c.baseUrl.String(); got != "http://127.0.0.1:8443/v1" {
+		t.Errorf("unexpected base url %s", got)
+	}
+	if err := newTestConnection(WithPort(70000)).Err(); err == nil {
+		t.Error("expected an error for an out of range port")
+	}
+}
+
+func TestWithLoginTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	c := newTestConnection(WithLoginTimeout(200 * time.Millisecond))
+	u, err := url.Parse(srv.URL + "/v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.baseUrl = u
+
+	t1 := time.Now()
+	_, err = c.Login(context.Background())
+	if elapsed := time.Since(t1); elapsed > time.Second {
+		t.Errorf("Login took %s, longer than its timeout", elapsed)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+}
+
+// countingReader produces size zero bytes, counting how many have been read
+type countingReader struct {
+	size int64
+	read int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	left := r.size - atomic.LoadInt64(&r.read)
+	if left <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > left {
+		p = p[:left]
+	}
+	for i := range p {
+		p[i] = 0
+	}
+	atomic.AddInt64(&r.read, int64(len(p)))
+	return len(p), nil
+}
+
+func (r *countingReader) count() int64 {
+	return atomic.LoadInt64(&r.read)
+}
+
+func TestDoStream(t *testing.T) {
+	const size = 64 << 20
+	src := &countingReader{size: size}
+	mux := newTestHandler().(*http.ServeMux)
+	mux.HandleFunc("/v1/logs_upload", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Auth-Token") != "thekey" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		io.Copy(w, src)
+	})
+	mux.HandleFunc("/v1/missing", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"name": "NotFoundError", "message": "no such thing", "http": 404}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	c := newTestConnection()
+	u, err := url.Parse(srv.URL + "/v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.baseUrl = u
+
+	body, apierr, err := c.DoStream(context.Background(), "GET", "logs_upload", nil)
+	if apierr != nil || err != nil {
+		t.Fatalf("unexpected error %v %v", apierr, err)
+	}
+	defer body.Close()
+
+	// only what fits in the connection's buffers should have been produced so far
+	if _, err := io.CopyN(ioutil.Discard, body, 1<<20); err != nil {
+		t.Fatal(err)
+	}
+	if n := src.count(); n >= size/4 {
+		t.Errorf("%d of %d bytes were read before the body was consumed", n, size)
+	}
+	n, err := io.Copy(ioutil.Discard, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n+1<<20 != size {
+		t.Errorf("streamed %d bytes, expected %d", n+1<<20, size)
+	}
+
+	body, apierr, err = c.DoStream(context.Background(), "GET", "missing", nil)
+	if err != nil || apierr == nil || apierr.Http != http.StatusNotFound {
+		t.Errorf("expected a 404 ApiErrorResponse, got %v %v", apierr, err)
+	}
+	if body != nil {
+		t.Error("expected no body with an error response")
+	}
+}
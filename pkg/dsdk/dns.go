@@ -1,3 +1,6 @@
 package dsdk
 
-type Dns struct{}
+type Dns struct {
+	Servers       []string `json:"servers,omitempty" mapstructure:"servers"`
+	SearchDomains []string `json:"search_domains,omitempty" mapstructure:"search_domains"`
+}
@@ -0,0 +1,79 @@
+package dsdk
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	greq "github.com/levigross/grequests"
+)
+
+// ChecksumHeader is the response header Download reads a file's expected SHA-256,
+// hex encoded, from
+const ChecksumHeader = "X-Checksum-Sha256"
+
+// Download streams the response to a GET of url into the file at dest, replacing
+// it if it exists.  If the server sends a ChecksumHeader the file's SHA-256 must
+// match it.  The response is written to a temporary file next to dest that only
+// replaces it once verified, so a failed download leaves dest as it was
+func (c *ApiConnection) Download(ctxt context.Context, url, dest string, ro *greq.RequestOptions) (*ApiErrorResponse, error) {
+	stream := &bodyStream{}
+	apiresp, err := c.doWithAuth(ctxt, "GET", url, ro, stream)
+	if apiresp != nil || err != nil {
+		return apiresp, err
+	}
+	defer stream.body.Close()
+
+	f, err := ioutil.TempFile(filepath.Dir(dest), "."+filepath.Base(dest)+".*")
+	if err != nil {
+		return nil, err
+	}
+	tmp := f.Name()
+	if err = writeVerified(f, stream.body, stream.header.Get(ChecksumHeader)); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return nil, fmt.Errorf("failed to download %s to %s: %w", url, dest, err)
+	}
+	// temporary files are only readable by their owner, give dest the mode it had or
+	// the one os.Create would
+	mode := os.FileMode(0644)
+	if fi, err := os.Stat(dest); err == nil {
+		mode = fi.Mode().Perm()
+	}
+	if err = f.Chmod(mode); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return nil, err
+	}
+	if err = f.Close(); err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+	if err = os.Rename(tmp, dest); err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+	return nil, nil
+}
+
+// writeVerified copies r to w, checking what was copied against the hex encoded
+// SHA-256 expected unless it's empty
+func writeVerified(w io.Writer, r io.Reader, expected string) error {
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(w, h), r); err != nil {
+		return err
+	}
+	if expected == "" {
+		return nil
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(got, expected) {
+		return fmt.Errorf("checksum mismatch, expected %s got %s", expected, got)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package dsdk
+
+import (
+	"context"
+	"fmt"
+	_path "path"
+
+	greq "github.com/levigross/grequests"
+)
+
+// Drive media types, each listed from its own collection under a storage node
+const (
+	DriveHdd   = "hdd"
+	DriveFlash = "flash"
+	DriveNvm   = "nvm"
+)
+
+// driveCollections maps drive media types to the storage node collection holding them
+var driveCollections = []struct {
+	mediaType  string
+	collection string
+}{
+	{DriveHdd, "hdds"},
+	{DriveFlash, "flash_devices"},
+	{DriveNvm, "nvm_flash_devices"},
+}
+
+// Drive is a data drive of a storage node
+type Drive struct {
+	Path      string   `json:"path,omitempty" mapstructure:"path"`
+	MediaType string   `json:"-" mapstructure:"-"`
+	Causes    []string `json:"causes,omitempty" mapstructure:"causes"`
+	Health    string   `json:"health,omitempty" mapstructure:"health"`
+	Id        string   `json:"id,omitempty" mapstructure:"id"`
+	Model     string   `json:"model,omitempty" mapstructure:"model"`
+	OpState   string   `json:"op_state,omitempty" mapstructure:"op_state"`
+	SerialNo  string   `json:"serial_no,omitempty" mapstructure:"serial_no"`
+	Size      int      `json:"size,omitempty" mapstructure:"size"`
+	SlotLabel string   `json:"slot_label,omitempty" mapstructure:"slot_label"`
+	Vendor    string   `json:"vendor,omitempty" mapstructure:"vendor"`
+}
+
+// ListDrives lists the HDD, flash and NVM drives of the storage node with uuid nodeUuid,
+// hdds first.  A node without one of the collections, such as an all flash node without
+// hdds, has no drives of that type rather than failing
+func (e *StorageNodes) ListDrives(ctxt context.Context, nodeUuid string) ([]*Drive, *ApiErrorResponse, error) {
+	resp := []*Drive{}
+	// the node itself is missing if none of its collections are found
+	var missing *ApiErrorResponse
+	found := false
+	for _, dc := range driveCollections {
+		rs, apierr, err := GetConn(ctxt).GetList(ctxt, _path.Join(e.Path, nodeUuid, dc.collection), &greq.RequestOptions{})
+		if apierr != nil && apierr.Http == NotFound {
+			missing = apierr
+			continue
+		}
+		if apierr != nil {
+			return nil, apierr, err
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		found = true
+		for _, data := range rs.Data {
+			elem := &Drive{}
+			adata := data.(map[string]interface{})
+			if err = FillStruct(adata, elem); err != nil {
+				return nil, nil, err
+			}
+			elem.MediaType = dc.mediaType
+			resp = append(resp, elem)
+		}
+	}
+	if !found {
+		return nil, missing, fmt.Errorf("no storage node %s to list drives of: %w", nodeUuid, ErrNotFound)
+	}
+	return resp, nil, nil
+}
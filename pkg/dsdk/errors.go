@@ -0,0 +1,64 @@
+package dsdk
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// IsNotFound reports whether err is, or wraps, an ApiErrorResponse for a resource that
+// doesn't exist
+func IsNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound)
+}
+
+// IsRetryable reports whether err is a failure a connection with the default retry
+// settings retries: a 429 or 503 response, or the cluster not being reachable.
+// Responses and errors returned by the SDK may be passed, wrapped or not
+func IsRetryable(err error) bool {
+	var apiresp *ApiErrorResponse
+	if errors.As(err, &apiresp) {
+		return retryable(defaultRetryableStatuses(), apiresp, nil)
+	}
+	return retryable(defaultRetryableStatuses(), nil, err)
+}
+
+// UnmarshalError is returned when a response can't be decoded, for example when a
+// proxy answers a request with an HTML error page
+type UnmarshalError struct {
+	// Status is the HTTP status of the response
+	Status int
+	// Route is the request path with resource ids replaced by ":id"
+	Route string
+	// Body is the raw response body
+	Body []byte
+	Err  error
+}
+
+func (e *UnmarshalError) Error() string {
+	return fmt.Sprintf("failed to decode %d response from %s: %s", e.Status, e.Route, e.Err)
+}
+
+func (e *UnmarshalError) Unwrap() error {
+	return e.Err
+}
+
+// BulkError is returned by operations on many resources when some of them fail
+type BulkError struct {
+	// Errors holds why each failed resource failed, keyed by its name
+	Errors map[string]error
+}
+
+func (e *BulkError) Error() string {
+	names := make([]string, 0, len(e.Errors))
+	for name := range e.Errors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	msgs := make([]string, 0, len(names))
+	for _, name := range names {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", name, e.Errors[name]))
+	}
+	return fmt.Sprintf("%d failed: %s", len(names), strings.Join(msgs, "; "))
+}
@@ -2,13 +2,20 @@ package dsdk
 
 import (
 	"context"
+	"fmt"
 	_path "path"
+	"time"
 
 	greq "github.com/levigross/grequests"
 )
 
+// defaultEventPollInterval is how long SystemEvents.Subscribe waits between polls
+// unless given an interval
+const defaultEventPollInterval = 10 * time.Second
+
 type SystemEvent struct {
 	Time        string `json:"time,omitempty" mapstructure:"time"`
+	Category    string `json:"category,omitempty" mapstructure:"category"`
 	Code        string `json:"code,omitempty" mapstructure:"code"`
 	Context     string `json:"context,omitempty" mapstructure:"context"`
 	Debug       string `json:"debug,omitempty" mapstructure:"debug"`
@@ -20,11 +27,24 @@ type SystemEvent struct {
 	Tenant      string `json:"tenant,omitempty" mapstructure:"tenant"`
 	Uuid        string `json:"uuid,omitempty" mapstructure:"uuid"`
 	ObjectPath  string `json:"object_path,omitempty" mapstructure:"object_path"`
+	// Extra holds the fields of the event not decoded into the ones above
+	Extra map[string]interface{} `json:"-" mapstructure:",remain"`
 }
 
+// Event severities SystemEventsRequest can be filtered by
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityError    = "error"
+	SeverityCritical = "critical"
+)
+
 type SystemEventsRequest struct {
 	Ctxt   context.Context `json:"-"`
 	Params ListRangeParams `json:"params,omitempty"`
+	// Severity lists only the events of one severity, filtered server side.  It
+	// can't be combined with a filter in Params
+	Severity string `json:"-"`
 }
 
 type SystemEvents struct {
@@ -38,6 +58,18 @@ func newSystemEvents(path string) *SystemEvents {
 }
 
 func (e *SystemEvents) List(ro *SystemEventsRequest) ([]*SystemEvent, *ApiErrorResponse, error) {
+	if ro.Severity != "" {
+		filter, err := severityFilter(ro.Severity)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ro.Params.Filter != "" {
+			return nil, nil, fmt.Errorf("%w: events can't be filtered by both severity and %s", ErrInvalidRequest, ro.Params.Filter)
+		}
+		params := ro.Params
+		params.Filter = filter
+		ro = &SystemEventsRequest{Ctxt: ro.Ctxt, Params: params}
+	}
 	gro := &greq.RequestOptions{
 		JSON:   ro,
 		Params: ro.Params.ToMap(),
@@ -64,3 +96,120 @@ func (e *SystemEvents) List(ro *SystemEventsRequest) ([]*SystemEvent, *ApiErrorR
 
 	return resp, nil, nil
 }
+
+// ListCritical lists the critical system events
+func (e *SystemEvents) ListCritical(ctxt context.Context) ([]*SystemEvent, *ApiErrorResponse, error) {
+	return e.List(&SystemEventsRequest{Ctxt: ctxt, Severity: SeverityCritical})
+}
+
+// Tail returns the latest n system events, newest first.  The server sorts and
+// limits the list so only those events are fetched however many there are
+func (e *SystemEvents) Tail(ctxt context.Context, n int) ([]*SystemEvent, *ApiErrorResponse, error) {
+	if n < 1 {
+		return nil, nil, fmt.Errorf("%w: can't tail %d events", ErrInvalidRequest, n)
+	}
+	return e.List(&SystemEventsRequest{
+		Ctxt:   WithLimitAsTotal(ctxt),
+		Params: ListRangeParams{Sort: "-time", Limit: n},
+	})
+}
+
+// severityFilter returns the filter matching events of the given severity
+func severityFilter(severity string) (string, error) {
+	switch severity {
+	case SeverityInfo, SeverityWarning, SeverityError, SeverityCritical:
+		return fmt.Sprintf("match(severity,^%s$)", severity), nil
+	}
+	return "", fmt.Errorf("%w: unknown event severity %q", ErrInvalidRequest, severity)
+}
+
+// eventTime returns when ev happened, or fallback if its time can't be parsed
+func eventTime(ev *SystemEvent, fallback time.Time) time.Time {
+	t, err := parseRangeTime(ev.Time)
+	if err != nil {
+		return fallback
+	}
+	return t
+}
+
+// Subscribe polls for system events every interval, or every 10 seconds if it isn't
+// positive, and sends each new one on the returned channel once, in the order they're
+// listed.  Events from since on are sent, an empty since starts from the latest event
+// on the cluster, which isn't sent, rather than the whole history.  Each poll asks
+// only for events since the latest one delivered.  Failed polls are logged and
+// retried at the next interval.  The channel is closed once ctxt is done
+func (e *SystemEvents) Subscribe(ctxt context.Context, since string, interval time.Duration) <-chan *SystemEvent {
+	if interval <= 0 {
+		interval = defaultEventPollInterval
+	}
+	ch := make(chan *SystemEvent)
+	logger := GetConn(ctxt).logFor(ctxt)
+	go func() {
+		defer close(ch)
+		// the events at the since cursor are listed again by the next poll.  Times are
+		// compared parsed, the API may vary their precision and zone, while since keeps
+		// the latest event's time as the API gave it to send back
+		seen := map[string]time.Time{}
+		var cursor time.Time
+		started := since != ""
+		if started {
+			if t, err := parseRangeTime(since); err == nil {
+				cursor = t
+			}
+		}
+		for {
+			if !started {
+				latest, apierr, err := e.Tail(ctxt, 1)
+				if apierr != nil || err != nil {
+					if ctxt.Err() != nil {
+						return
+					}
+					logger.Error(fmt.Sprintf("failed to find the latest system event: %v %v", apierr, err), nil)
+				} else {
+					started = true
+					if len(latest) > 0 {
+						since = latest[0].Time
+						cursor = eventTime(latest[0], cursor)
+						seen[latest[0].Uuid] = cursor
+					}
+				}
+			}
+			if started {
+				events, apierr, err := e.List(&SystemEventsRequest{Ctxt: ctxt, Params: ListRangeParams{Since: since}})
+				if apierr != nil || err != nil {
+					if ctxt.Err() != nil {
+						return
+					}
+					logger.Error(fmt.Sprintf("failed to poll system events since %q: %v %v", since, apierr, err), nil)
+				}
+				for _, ev := range events {
+					if _, ok := seen[ev.Uuid]; ok {
+						continue
+					}
+					select {
+					case ch <- ev:
+					case <-ctxt.Done():
+						return
+					}
+					t := eventTime(ev, cursor)
+					seen[ev.Uuid] = t
+					if t.After(cursor) {
+						cursor = t
+						since = ev.Time
+					}
+				}
+				for uuid, t := range seen {
+					if t.Before(cursor) {
+						delete(seen, uuid)
+					}
+				}
+			}
+			select {
+			case <-time.After(interval):
+			case <-ctxt.Done():
+				return
+			}
+		}
+	}()
+	return ch
+}
@@ -2,6 +2,7 @@ package dsdk
 
 import (
 	"context"
+	"fmt"
 	_path "path"
 
 	greq "github.com/levigross/grequests"
@@ -136,3 +137,167 @@ func (e *InitiatorGroup) Delete(ro *InitiatorGroupDeleteRequest) (*InitiatorGrou
 	}
 	return resp, nil, nil
 }
+
+// AddMembers adds the initiators with the given IQNs to the group named group,
+// leaving those that are already members alone, and returns the group.  The members
+// are read and written back whole, and the API has no precondition to make that
+// atomic.  With conflictRetries above 0 the group is read again after the write and,
+// if a concurrent change undid it or the write was rejected with a 409, the update is
+// redone from that read up to conflictRetries times.  A change someone else made
+// between the read and the write can still be lost
+func (e *InitiatorGroups) AddMembers(ctxt context.Context, group string, iqns []string, conflictRetries int) (*InitiatorGroup, *ApiErrorResponse, error) {
+	return e.updateMembers(ctxt, group, conflictRetries, func(members []Initiator) []Initiator {
+		have := memberSet(members)
+		for _, iqn := range iqns {
+			if !have.Contains(iqn) {
+				have.Add(iqn)
+				members = append(members, initiatorRef(iqn))
+			}
+		}
+		return members
+	})
+}
+
+// RemoveMembers removes the initiators with the given IQNs from the group named
+// group, ignoring those that aren't members, and returns the group.  conflictRetries
+// works as it does for AddMembers
+func (e *InitiatorGroups) RemoveMembers(ctxt context.Context, group string, iqns []string, conflictRetries int) (*InitiatorGroup, *ApiErrorResponse, error) {
+	return e.updateMembers(ctxt, group, conflictRetries, func(members []Initiator) []Initiator {
+		remove := NewStringSet(len(iqns), iqns...)
+		kept := []Initiator{}
+		for _, m := range members {
+			if !remove.Contains(memberIQN(m)) {
+				kept = append(kept, m)
+			}
+		}
+		return kept
+	})
+}
+
+// MembersDiff holds the IQNs of the initiators SyncMembers added to and removed from
+// a group
+type MembersDiff struct {
+	Added   []string
+	Removed []string
+}
+
+// SyncMembers makes the members of the group named group exactly the initiators with
+// the desired IQNs, in a single write, and returns what it changed.  Nothing is
+// written when they already match
+func (e *InitiatorGroups) SyncMembers(ctxt context.Context, group string, desired []string) (*MembersDiff, *ApiErrorResponse, error) {
+	diff := &MembersDiff{}
+	_, apierr, err := e.updateMembers(ctxt, group, 0, func(members []Initiator) []Initiator {
+		want := NewStringSet(len(desired), desired...)
+		have := memberSet(members)
+		synced := []Initiator{}
+		for _, m := range members {
+			if iqn := memberIQN(m); want.Contains(iqn) {
+				synced = append(synced, m)
+			} else {
+				diff.Removed = append(diff.Removed, iqn)
+			}
+		}
+		for _, iqn := range desired {
+			if !have.Contains(iqn) {
+				have.Add(iqn)
+				diff.Added = append(diff.Added, iqn)
+				synced = append(synced, initiatorRef(iqn))
+			}
+		}
+		return synced
+	})
+	if apierr != nil || err != nil {
+		return nil, apierr, err
+	}
+	return diff, nil, nil
+}
+
+// initiatorGroupMembers is the payload updateMembers writes, unlike
+// InitiatorGroupSetRequest it sends an empty members list to remove them all
+type initiatorGroupMembers struct {
+	Members []Initiator `json:"members"`
+}
+
+// updateMembers replaces the members of the group named group with what update
+// returns given the current ones, skipping the write if they're unchanged.  update must
+// be idempotent: with conflictRetries above 0 the write is checked by reading the group
+// again and applying update to it, if that would change the members they were changed
+// concurrently and the update is redone
+func (e *InitiatorGroups) updateMembers(ctxt context.Context, group string, conflictRetries int, update func([]Initiator) []Initiator) (*InitiatorGroup, *ApiErrorResponse, error) {
+	get := func() (*InitiatorGroup, *ApiErrorResponse, error) {
+		ig, apierr, err := e.Get(&InitiatorGroupsGetRequest{Ctxt: ctxt, Name: group})
+		if apierr != nil || err != nil {
+			return nil, apierr, err
+		}
+		if ig.Path == "" {
+			ig.Path = _path.Join(e.Path, group)
+		}
+		return ig, nil, nil
+	}
+	ig, apierr, err := get()
+	if apierr != nil || err != nil {
+		return nil, apierr, err
+	}
+	for attempt := 0; ; attempt++ {
+		members := update(append([]Initiator{}, ig.Members...))
+		if sameMembers(ig.Members, members) {
+			return ig, nil, nil
+		}
+		gro := &greq.RequestOptions{JSON: &initiatorGroupMembers{Members: members}}
+		rs, apierr, err := GetConn(ctxt).Put(ctxt, ig.Path, gro)
+		retry := attempt < conflictRetries
+		if apierr != nil && !(retry && apierr.Http == Conflict) {
+			return nil, apierr, err
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if apierr == nil && conflictRetries == 0 {
+			resp := &InitiatorGroup{}
+			if err = FillStruct(rs.Data, resp); err != nil {
+				return nil, nil, err
+			}
+			return resp, nil, nil
+		}
+		written := apierr == nil
+		if ig, apierr, err = get(); apierr != nil || err != nil {
+			return nil, apierr, err
+		}
+		if written && sameMembers(ig.Members, update(append([]Initiator{}, ig.Members...))) {
+			return ig, nil, nil
+		}
+		if !retry {
+			return ig, nil, fmt.Errorf("%w: members of initiator group %s were changed concurrently %d times", ErrConflict, group, attempt+1)
+		}
+		GetConn(ctxt).logFor(ctxt).Debug(fmt.Sprintf("members of initiator group %s changed concurrently, retrying", group), map[string]interface{}{
+			"initiator_group": group,
+			"attempt":         attempt + 1,
+		})
+	}
+}
+
+// initiatorRef refers to the initiator with the given IQN
+func initiatorRef(iqn string) Initiator {
+	return Initiator{Path: _path.Join("/initiators", iqn)}
+}
+
+// memberIQN returns the IQN of the group member m
+func memberIQN(m Initiator) string {
+	if m.Id != "" {
+		return m.Id
+	}
+	return _path.Base(m.Path)
+}
+
+func memberSet(members []Initiator) *StringSet {
+	s := NewStringSet(len(members))
+	for _, m := range members {
+		s.Add(memberIQN(m))
+	}
+	return s
+}
+
+// sameMembers reports whether a and b hold the same initiators
+func sameMembers(a, b []Initiator) bool {
+	return len(a) == len(b) && len(memberSet(a).SymDifference(memberSet(b)).List()) == 0
+}
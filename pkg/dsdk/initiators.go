@@ -2,7 +2,10 @@ package dsdk
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	_path "path"
+	"regexp"
 
 	greq "github.com/levigross/grequests"
 )
@@ -47,6 +50,53 @@ func (e *Initiators) Create(ro *InitiatorsCreateRequest) (*Initiator, *ApiErrorR
 	return resp, nil, nil
 }
 
+// InitiatorSpec describes an initiator for CreateMany to create
+type InitiatorSpec struct {
+	IQN  string
+	Name string
+}
+
+// InitiatorResult is the outcome of creating one initiator with CreateMany
+type InitiatorResult struct {
+	Spec InitiatorSpec
+	// Initiator is the created initiator, nil if it already existed or failed
+	Initiator *Initiator
+	// Existed is set when the initiator had already been created
+	Existed bool
+	Err     error
+}
+
+// CreateMany creates the initiators described by inits with up to concurrency
+// requests in flight at once.  Initiators that already exist count as created.  The
+// results are in the same order as inits and, if any failed, a BulkError keyed by
+// IQN is returned with them
+func (e *Initiators) CreateMany(ctxt context.Context, inits []InitiatorSpec, concurrency int) ([]*InitiatorResult, error) {
+	results := make([]*InitiatorResult, len(inits))
+	runConcurrently(len(inits), concurrency, func(i int) {
+		res := &InitiatorResult{Spec: inits[i]}
+		init, apierr, err := e.Create(&InitiatorsCreateRequest{Ctxt: ctxt, Id: inits[i].IQN, Name: inits[i].Name})
+		switch {
+		case apierr != nil && errors.Is(apierr, ErrConflict):
+			res.Existed = true
+		case apierr != nil:
+			res.Err = apierr
+		default:
+			res.Initiator, res.Err = init, err
+		}
+		results[i] = res
+	})
+	failed := map[string]error{}
+	for _, res := range results {
+		if res.Err != nil {
+			failed[res.Spec.IQN] = res.Err
+		}
+	}
+	if len(failed) > 0 {
+		return results, &BulkError{Errors: failed}
+	}
+	return results, nil
+}
+
 type InitiatorsListRequest struct {
 	Ctxt   context.Context `json:"-"`
 	Params ListParams      `json:"params,omitempty"`
@@ -75,6 +125,28 @@ func (e *Initiators) List(ro *InitiatorsListRequest) ([]*Initiator, *ApiErrorRes
 	return resp, nil, nil
 }
 
+// GetByIQN returns the initiator with the given IQN, filtering the list server side
+// rather than fetching all of them.  The error satisfies IsNotFound when there's no
+// such initiator
+func (e *Initiators) GetByIQN(ctxt context.Context, iqn string) (*Initiator, *ApiErrorResponse, error) {
+	filter := fmt.Sprintf("match(id,^%s$)", regexp.QuoteMeta(iqn))
+	inits, apierr, err := e.List(&InitiatorsListRequest{Ctxt: ctxt, Params: ListParams{Filter: filter}})
+	if apierr != nil {
+		return nil, apierr, err
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	switch len(inits) {
+	case 0:
+		return nil, nil, fmt.Errorf("no initiator has IQN %s: %w", iqn, ErrNotFound)
+	case 1:
+		return inits[0], nil, nil
+	default:
+		return nil, nil, fmt.Errorf("%d initiators have IQN %s", len(inits), iqn)
+	}
+}
+
 type InitiatorsGetRequest struct {
 	Ctxt context.Context `json:"-"`
 	Id   string          `json:"-"`
@@ -2,7 +2,12 @@ package dsdk
 
 import (
 	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
 	_path "path"
+	"sync"
 
 	greq "github.com/levigross/grequests"
 )
@@ -14,15 +19,30 @@ type AccessNetworkIpPool struct {
 	Descr        string        `json:"descr,omitempty" mapstructure:"descr"`
 }
 
+// IpPoolNetworkPath is a range of addresses in an access network ip pool
+type IpPoolNetworkPath struct {
+	Name    string `json:"name,omitempty" mapstructure:"name"`
+	StartIp string `json:"start_ip,omitempty" mapstructure:"start_ip"`
+	EndIp   string `json:"end_ip,omitempty" mapstructure:"end_ip"`
+	Netmask int    `json:"netmask,omitempty" mapstructure:"netmask"`
+	Vlan    int    `json:"vlan,omitempty" mapstructure:"vlan"`
+}
+
 type AccessNetworkIpPools struct {
 	Path string
+
+	// addresses handed out by Allocate, by pool name
+	m       sync.Mutex
+	claimed map[string]map[string]bool
 }
 
 type AccessNetworkIpPoolsCreateRequest struct {
-	Ctxt  context.Context `json:"-"`
-	Id    string          `json:"id,omitempty" mapstructure:"id"`
-	Name  string          `json:"name,omitempty" mapstructure:"name"`
-	Force bool            `json:"force,omitempty" mapstructure:"force"`
+	Ctxt         context.Context      `json:"-"`
+	Id           string               `json:"id,omitempty" mapstructure:"id"`
+	Name         string               `json:"name,omitempty" mapstructure:"name"`
+	Descr        string               `json:"descr,omitempty" mapstructure:"descr"`
+	NetworkPaths []*IpPoolNetworkPath `json:"network_paths,omitempty" mapstructure:"network_paths"`
+	Force        bool                 `json:"force,omitempty" mapstructure:"force"`
 }
 
 func newAccessNetworkIpPools(path string) *AccessNetworkIpPools {
@@ -137,3 +157,79 @@ func (e *AccessNetworkIpPool) Delete(ro *AccessNetworkIpPoolDeleteRequest) (*Acc
 	}
 	return resp, nil, nil
 }
+
+// ErrIpPoolExhausted is returned by Allocate when every address in a pool is in use
+var ErrIpPoolExhausted = errors.New("no free addresses left in access network ip pool")
+
+// Allocate returns the first address in the pool named poolName that no storage instance
+// using the pool has and that Allocate hasn't already returned.  The API has no way to
+// claim an address, so allocations are only exclusive between callers sharing this
+// AccessNetworkIpPools, call Release to hand back an address that wasn't used.  Only
+// IPv4 ranges are supported
+func (e *AccessNetworkIpPools) Allocate(ctxt context.Context, poolName string) (string, *ApiErrorResponse, error) {
+	pool, apierr, err := e.Get(&AccessNetworkIpPoolsGetRequest{Ctxt: ctxt, Name: poolName})
+	if apierr != nil || err != nil {
+		return "", apierr, err
+	}
+	ais, apierr, err := newAppInstances("/").List(&AppInstancesListRequest{Ctxt: ctxt})
+	if apierr != nil || err != nil {
+		return "", apierr, err
+	}
+	inUse := map[string]bool{}
+	for _, ai := range ais {
+		for _, si := range ai.StorageInstances {
+			if si.IpPool == nil || si.IpPool.Path != pool.Path || si.Access == nil {
+				continue
+			}
+			for _, ip := range si.Access.Ips {
+				inUse[ip] = true
+			}
+		}
+	}
+
+	e.m.Lock()
+	defer e.m.Unlock()
+	if e.claimed == nil {
+		e.claimed = map[string]map[string]bool{}
+	}
+	claimed := e.claimed[poolName]
+	if claimed == nil {
+		claimed = map[string]bool{}
+		e.claimed[poolName] = claimed
+	}
+	for _, np := range pool.NetworkPaths {
+		m, ok := np.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		r := &IpPoolNetworkPath{}
+		if err = FillStruct(m, r); err != nil {
+			return "", nil, err
+		}
+		start, end := net.ParseIP(r.StartIp).To4(), net.ParseIP(r.EndIp).To4()
+		if start == nil || end == nil {
+			return "", nil, fmt.Errorf("%w: pool %s has range %s-%s, only IPv4 ranges can be allocated from",
+				ErrInvalidRequest, poolName, r.StartIp, r.EndIp)
+		}
+		for n := binary.BigEndian.Uint32(start); n <= binary.BigEndian.Uint32(end); n++ {
+			ip := make(net.IP, net.IPv4len)
+			binary.BigEndian.PutUint32(ip, n)
+			if addr := ip.String(); !inUse[addr] && !claimed[addr] {
+				claimed[addr] = true
+				return addr, nil, nil
+			}
+			if n == ^uint32(0) {
+				break
+			}
+		}
+	}
+	return "", nil, fmt.Errorf("%w: %s", ErrIpPoolExhausted, poolName)
+}
+
+// Release hands an address returned by Allocate back, so it can be allocated again once
+// no storage instance has it
+func (e *AccessNetworkIpPools) Release(poolName, ip string) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	delete(e.claimed[poolName], ip)
+}
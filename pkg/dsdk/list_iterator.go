@@ -0,0 +1,116 @@
+package dsdk
+
+import (
+	"context"
+	"strconv"
+
+	greq "github.com/levigross/grequests"
+)
+
+// ListIterator walks the items of a list endpoint fetching one page at a time, so
+// only a single page is held in memory.  Use it like:
+//
+//	it := conn.GetListIter(ctxt, "initiators", nil)
+//	for it.Next() {
+//		item := it.Item()
+//	}
+//	if apierr, err := it.Err(); apierr != nil || err != nil {
+//	}
+type ListIterator struct {
+	conn   *ApiConnection
+	ctxt   context.Context
+	url    string
+	ro     *greq.RequestOptions
+	offset int
+
+	items   []interface{}
+	idx     int
+	fetched bool
+	done    bool
+	apiresp *ApiErrorResponse
+	err     error
+}
+
+// GetListIter returns a ListIterator over the items at url.  An offset in ro.Params is
+// where iteration starts and a limit is used as the page size, falling back to the
+// connection's page size
+func (c *ApiConnection) GetListIter(ctxt context.Context, url string, ro *greq.RequestOptions) *ListIterator {
+	if ro == nil {
+		ro = &greq.RequestOptions{}
+	}
+	if c.pageSize > 0 && ro.Params["limit"] == "" {
+		if ro.Params == nil {
+			ro.Params = map[string]string{}
+		}
+		ro.Params["limit"] = strconv.FormatInt(int64(c.pageSize), 10)
+	}
+	return &ListIterator{
+		conn:   c,
+		ctxt:   ctxt,
+		url:    url,
+		ro:     ro,
+		offset: ListParamsFromMap(ro.Params).Offset,
+		idx:    -1,
+	}
+}
+
+// Next advances to the next item, fetching the next page when the current one is
+// used up.  It returns false once there are no more items, the context is done or a
+// request fails
+func (it *ListIterator) Next() bool {
+	if it.idx+1 < len(it.items) {
+		it.idx++
+		return true
+	}
+	if it.done {
+		return false
+	}
+	if err := it.ctxt.Err(); err != nil {
+		it.err = err
+		it.done = true
+		return false
+	}
+	if !it.fetchPage() {
+		it.done = true
+		return false
+	}
+	return it.Next()
+}
+
+// Item returns the current item
+func (it *ListIterator) Item() interface{} {
+	if it.idx < 0 || it.idx >= len(it.items) {
+		return nil
+	}
+	return it.items[it.idx]
+}
+
+// Err returns the failure that stopped iteration, if any
+func (it *ListIterator) Err() (*ApiErrorResponse, error) {
+	return it.apiresp, it.err
+}
+
+// fetchPage replaces the current page with the next one, returning false if there
+// was nothing left to fetch
+func (it *ListIterator) fetchPage() bool {
+	if it.fetched || it.offset != 0 {
+		if it.ro.Params == nil {
+			it.ro.Params = map[string]string{}
+		}
+		// update offset directly to preserve any other params the endpoint takes
+		it.ro.Params["offset"] = strconv.FormatInt(int64(it.offset), 10)
+	}
+	rs := &ApiListOuter{}
+	it.apiresp, it.err = it.conn.doWithAuth(it.ctxt, "GET", it.url, it.ro, rs)
+	if it.apiresp != nil || it.err != nil {
+		return false
+	}
+	it.fetched = true
+	it.items, it.idx = rs.Data, -1
+	it.offset += len(rs.Data)
+	tcnt, ok := rs.TotalCount()
+	if !ok || len(rs.Data) == 0 || it.offset >= tcnt {
+		it.done = true
+	}
+	return len(rs.Data) > 0
+}
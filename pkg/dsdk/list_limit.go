@@ -0,0 +1,19 @@
+package dsdk
+
+import (
+	"context"
+)
+
+// WithLimitAsTotal returns a copy of ctxt that makes GetList treat the limit and offset
+// in a request's params as a window over the whole list rather than a single page.
+// GetList keeps paginating from the offset until it has collected limit items, or the
+// end of the list if no limit is given
+func WithLimitAsTotal(ctxt context.Context) context.Context {
+	return context.WithValue(ctxt, limitAsTotalCtxKey, true)
+}
+
+// limitAsTotal reports whether ctxt was returned by WithLimitAsTotal
+func limitAsTotal(ctxt context.Context) bool {
+	v, _ := ctxt.Value(limitAsTotalCtxKey).(bool)
+	return v
+}
@@ -0,0 +1,126 @@
+package dsdk
+
+import (
+	"context"
+	"runtime"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Logger is what a connection logs through.  fields holds structured context for the
+// message and may be nil.  Connections log with logrus by default, use WithLogger to
+// replace it
+type Logger interface {
+	Debug(msg string, fields map[string]interface{})
+	Info(msg string, fields map[string]interface{})
+	Error(msg string, fields map[string]interface{})
+}
+
+// DebugEnabler can be implemented by a Logger to report whether debug messages are
+// emitted, which lets the SDK skip building detailed request logs nobody will see.
+// Loggers that don't implement it are always sent them
+type DebugEnabler interface {
+	DebugEnabled() bool
+}
+
+type logrusLogger struct {
+	entry *log.Entry
+}
+
+// NewLogrusLogger returns a Logger that logs to entry, annotating messages with the
+// file, line and function that logged them the same way Log does
+func NewLogrusLogger(entry *log.Entry) Logger {
+	return logrusLogger{entry: entry}
+}
+
+func (l logrusLogger) Debug(msg string, fields map[string]interface{}) {
+	l.log(log.DebugLevel, msg, fields)
+}
+
+func (l logrusLogger) Info(msg string, fields map[string]interface{}) {
+	l.log(log.InfoLevel, msg, fields)
+}
+
+func (l logrusLogger) Error(msg string, fields map[string]interface{}) {
+	l.log(log.ErrorLevel, msg, fields)
+}
+
+func (l logrusLogger) DebugEnabled() bool {
+	return l.entry.Logger.GetLevel() >= log.DebugLevel
+}
+
+func (l logrusLogger) log(level log.Level, msg string, fields map[string]interface{}) {
+	entry := l.entry
+	if frame, ok := loggerCaller(); ok {
+		entry = entry.WithField("file", frame.File).WithField("line", frame.Line).WithField("func", frame.Function)
+	}
+	entry.WithFields(log.Fields(fields)).Log(level, msg)
+}
+
+// loggerCaller returns the frame that called into the logger, skipping the logrusLogger
+// and any fieldLoggers wrapping it since it may be used with or without them
+func loggerCaller() (runtime.Frame, bool) {
+	pcs := make([]uintptr, 16)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	for {
+		frame, more := frames.Next()
+		name := frame.Function[strings.LastIndex(frame.Function, "/")+1:]
+		if !strings.HasPrefix(name, "dsdk.logrusLogger.") && !strings.HasPrefix(name, "dsdk.fieldLogger.") {
+			return frame, frame.Function != ""
+		}
+		if !more {
+			return runtime.Frame{}, false
+		}
+	}
+}
+
+// fieldLogger adds fields to every message logged through it
+type fieldLogger struct {
+	l      Logger
+	fields map[string]interface{}
+}
+
+func (f fieldLogger) Debug(msg string, fields map[string]interface{}) {
+	f.l.Debug(msg, f.merge(fields))
+}
+
+func (f fieldLogger) Info(msg string, fields map[string]interface{}) {
+	f.l.Info(msg, f.merge(fields))
+}
+
+func (f fieldLogger) Error(msg string, fields map[string]interface{}) {
+	f.l.Error(msg, f.merge(fields))
+}
+
+func (f fieldLogger) DebugEnabled() bool {
+	return debugEnabled(f.l)
+}
+
+func (f fieldLogger) merge(fields map[string]interface{}) map[string]interface{} {
+	if len(f.fields) == 0 {
+		return fields
+	}
+	m := make(map[string]interface{}, len(f.fields)+len(fields))
+	for k, v := range f.fields {
+		m[k] = v
+	}
+	for k, v := range fields {
+		m[k] = v
+	}
+	return m
+}
+
+// debugEnabled reports whether l emits debug messages
+func debugEnabled(l Logger) bool {
+	if d, ok := l.(DebugEnabler); ok {
+		return d.DebugEnabled()
+	}
+	return true
+}
+
+// logFor returns the connection's logger with the user log fields attached to ctxt
+func (c *ApiConnection) logFor(ctxt context.Context) Logger {
+	fields, _ := ctxt.Value(UserLogFieldsCtxKey).(map[string]interface{})
+	return fieldLogger{l: c.logger, fields: fields}
+}
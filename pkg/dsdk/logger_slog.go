@@ -0,0 +1,49 @@
+//go:build go1.21
+// +build go1.21
+
+package dsdk
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+)
+
+type slogLogger struct {
+	l *slog.Logger
+}
+
+// NewSlogLogger returns a Logger that logs to l, passing fields as attributes
+func NewSlogLogger(l *slog.Logger) Logger {
+	return slogLogger{l: l}
+}
+
+func (s slogLogger) Debug(msg string, fields map[string]interface{}) {
+	s.l.Debug(msg, slogArgs(fields)...)
+}
+
+func (s slogLogger) Info(msg string, fields map[string]interface{}) {
+	s.l.Info(msg, slogArgs(fields)...)
+}
+
+func (s slogLogger) Error(msg string, fields map[string]interface{}) {
+	s.l.Error(msg, slogArgs(fields)...)
+}
+
+func (s slogLogger) DebugEnabled() bool {
+	return s.l.Enabled(context.Background(), slog.LevelDebug)
+}
+
+// slogArgs turns fields into attributes sorted by key so output is stable
+func slogArgs(fields map[string]interface{}) []interface{} {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	args := make([]interface{}, 0, len(keys))
+	for _, k := range keys {
+		args = append(args, slog.Any(k, fields[k]))
+	}
+	return args
+}
@@ -11,9 +11,10 @@ import (
 	"net/http"
 	"os"
 	_path "path"
+	"strconv"
 
 	uuid "github.com/google/uuid"
-	log "github.com/sirupsen/logrus"
+	greq "github.com/levigross/grequests"
 )
 
 var (
@@ -27,6 +28,34 @@ type LogsUpload struct {
 type LogsUploadRequest struct {
 	Ctxt  context.Context
 	Files []string
+	// Progress, if set, is called as the upload is sent with the bytes sent so far and
+	// the size of the whole request body, or -1 when the size isn't known
+	Progress func(bytesSent, bytesTotal int64)
+}
+
+// defaultLogsChunkSize is the part size UploadChunked uses when a request doesn't set
+// one
+const defaultLogsChunkSize int64 = 64 << 20
+
+// defaultChunkAttempts bounds the attempts at each part of a chunked upload on
+// connections without a max attempts setting
+const defaultChunkAttempts = 5
+
+type LogsUploadChunkedRequest struct {
+	Ctxt context.Context
+	File string
+	// ChunkSize is the size of each part, 64MiB if it isn't positive
+	ChunkSize int64
+	// Resume continues the upload this state was returned for
+	Resume *LogsUploadState
+}
+
+// LogsUploadState tracks the parts of a chunked upload the cluster has received
+type LogsUploadState struct {
+	UploadID  string
+	Parts     int
+	ChunkSize int64
+	Uploaded  map[int]bool
 }
 
 func newLogsUpload(path string) *LogsUpload {
@@ -35,84 +64,186 @@ func newLogsUpload(path string) *LogsUpload {
 	}
 }
 
-func logsUpload(ctxt context.Context, file string) error {
+func logsUpload(ctxt context.Context, file string, progress func(sent, total int64)) (*ApiErrorResponse, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	size := int64(-1)
+	if fi, err := f.Stat(); err == nil && fi.Mode().IsRegular() {
+		size = fi.Size()
+	}
+	key, apierr, err := uploadSession(ctxt)
+	if apierr != nil || err != nil {
+		return apierr, err
+	}
+	return logsUploadReader(ctxt, key, file, f, size, nil, progress)
+}
+
+// uploadSession returns the session key to upload with, logging in first the way
+// doWithAuth does when there's no session or it's about to expire.  Uploads stream
+// their body so they can't go through doWithAuth, which may need to send it twice
+func uploadSession(ctxt context.Context) (string, *ApiErrorResponse, error) {
+	conn := GetConn(ctxt)
+	if conn.err != nil {
+		return "", nil, conn.err
+	}
+	conn.expireSession()
+	if conn.needsLogin() && !conn.IsLoggedIn() {
+		if apierr, err := conn.Login(ctxt); apierr != nil || err != nil {
+			conn.logFor(ctxt).Error(fmt.Sprintf("Login failure: %s, %s", Pretty(apierr), err), nil)
+			return "", apierr, err
+		}
+	}
+	key, _ := conn.ExportSession()
+	return key, nil, nil
+}
+
+// logsUploadReader uploads size bytes read from r as a bundle called name with the
+// session key, size is -1 when it isn't known.  params are added to the upload's query.
+// A response other than a 200 is returned as an ApiErrorResponse
+func logsUploadReader(ctxt context.Context, key, name string, r io.Reader, size int64, params map[string]string, progress func(sent, total int64)) (*ApiErrorResponse, error) {
 	conn := GetConn(ctxt)
-	tid, ok := ctxt.Value("tid").(string)
+	logger := conn.logFor(ctxt)
+	tid, ok := traceIDFromContext(ctxt)
 	if !ok {
 		tid = "nil"
 	}
 	reqId := uuid.Must(uuid.NewRandom()).String()
-	var err error
-	if conn.apikey == "" {
-		if _, err = conn.Login(ctxt); err != nil {
-			return err
-		}
-	}
-	key := conn.apikey
+	conn.m.RLock()
+	tenant := conn.requestTenant(ctxt, &greq.RequestOptions{})
+	conn.m.RUnlock()
 	gurl := *conn.baseUrl
 	gurl.Path = _path.Join(conn.baseUrl.Path, "logs_upload")
+	if len(params) > 0 {
+		q := gurl.Query()
+		for k, v := range params {
+			q.Set(k, v)
+		}
+		gurl.RawQuery = q.Encode()
+	}
 	url := gurl.String()
 
+	// The form is streamed rather than buffered since bundles can be large, the multipart
+	// writer only produces the parts before and after the file
 	var b bytes.Buffer
 	w := multipart.NewWriter(&b)
-
-	f, err := os.Open(file)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-	err = w.WriteField("ecosystem", "kubernetes")
-	if err != nil {
-		return err
+	if err := w.WriteField("ecosystem", "kubernetes"); err != nil {
+		return nil, err
 	}
-
-	fw, err := w.CreateFormFile("logs.tar.gz", file)
-	if err != nil {
-		return err
-	}
-	if _, err = io.Copy(fw, f); err != nil {
-		return err
+	if _, err := w.CreateFormFile("logs.tar.gz", name); err != nil {
+		return nil, err
 	}
+	head := append([]byte{}, b.Bytes()...)
+	b.Reset()
 	// Don't forget to close the multipart writer.
 	// If you don't close it, your request will be missing the terminating boundary.
 	w.Close()
+	tail := b.Bytes()
+
+	total := int64(-1)
+	if size >= 0 {
+		total = int64(len(head)) + size + int64(len(tail))
+		r = io.LimitReader(r, size)
+	}
+	var body io.Reader = &ctxtReader{
+		ctxt: ctxt,
+		r:    io.MultiReader(bytes.NewReader(head), r, bytes.NewReader(tail)),
+	}
+	if progress != nil {
+		body = &progressReader{r: body, total: total, progress: progress}
+	}
 
-	// Now that you have a form, you can submit it to your handler.
-	req, err := http.NewRequest(http.MethodPut, url, &b)
+	// Now that you have a form, you can submit it to your handler.  Cancelling ctxt
+	// aborts the request mid body, so the server never receives a complete bundle
+	req, err := http.NewRequestWithContext(ctxt, http.MethodPut, url, body)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	// an unknown length is sent chunked
+	req.ContentLength = total
 	// Don't forget to set the content type, this will contain the boundary.
 	req.Header.Set("Content-Type", w.FormDataContentType())
 	req.Header.Set("Auth-Token", key)
+	req.Header.Set("tenant", tenant)
+	req.Header.Set("Datera-Driver", DateraDriver)
 
 	// Submit the request
-	client := &http.Client{}
+	client := conn.httpClient
+	if client == nil {
+		client = &http.Client{}
+	}
 	sheaders, err := json.Marshal(req.Header)
 	if err != nil {
-		Log().Errorf("Couldn't stringify headers, %s", req.Header)
+		logger.Error(fmt.Sprintf("Couldn't stringify headers, %s", req.Header), nil)
 	}
-	Log().WithFields(log.Fields{
+	logger.Debug("Datera SDK uploading logs", map[string]interface{}{
 		logTraceID:        tid,
 		"request_id":      reqId,
 		"request_method":  http.MethodPut,
 		"request_url":     gurl.String(),
 		"request_headers": sheaders,
-	}).Debug("Datera SDK uploading logs")
+	})
 	res, err := client.Do(req)
 	if err != nil {
-		return err
+		if ctxt.Err() != nil {
+			return nil, ctxt.Err()
+		}
+		return nil, err
 	}
-	Log().Debugf("Status Code: %d", res.StatusCode)
+	defer res.Body.Close()
+	logger.Debug(fmt.Sprintf("Status Code: %d", res.StatusCode), nil)
 	// Check the response
 	if res.StatusCode != http.StatusOK {
-		err = fmt.Errorf("bad status: %s", res.Status)
 		bodyBytes, _ := ioutil.ReadAll(res.Body)
-		Log().Error(err)
-		Log().Error(string(bodyBytes))
-		return err
+		eresp := &ApiErrorResponse{}
+		if err = json.Unmarshal(bodyBytes, eresp); err != nil {
+			logger.Error(fmt.Sprintf("failed to unmarshal ApiErrorResponse %s: %v", bodyBytes, err), nil)
+		}
+		// as in translateErrors the body may not say what the status was
+		if eresp.Http == 0 {
+			eresp.Http = res.StatusCode
+		}
+		eresp.RetryAfter = parseRetryAfter(res.Header.Get("Retry-After"))
+		logger.Error(fmt.Sprintf("Received API Error %s", Pretty(eresp)), map[string]interface{}{
+			logTraceID:   tid,
+			"request_id": reqId,
+		})
+		return eresp, nil
 	}
-	return nil
+	return nil, nil
+}
+
+// ctxtReader fails reads from r once ctxt is done, so transports that don't watch the
+// request context still stop sending the body
+type ctxtReader struct {
+	ctxt context.Context
+	r    io.Reader
+}
+
+func (c *ctxtReader) Read(b []byte) (int, error) {
+	if err := c.ctxt.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(b)
+}
+
+// progressReader calls progress with the bytes read from r so far after every read
+type progressReader struct {
+	r        io.Reader
+	sent     int64
+	total    int64
+	progress func(sent, total int64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.sent += int64(n)
+		p.progress(p.sent, p.total)
+	}
+	return n, err
 }
 
 func rotateLogs(rule string) error {
@@ -123,7 +254,142 @@ func rotateLogs(rule string) error {
 }
 
 func (e *LogsUpload) Upload(ro *LogsUploadRequest) (*LogsUpload, *ApiErrorResponse, error) {
-	return nil, nil, logsUpload(ro.Ctxt, ro.Files[0])
+	apierr, err := logsUpload(ro.Ctxt, ro.Files[0], ro.Progress)
+	return nil, apierr, err
+}
+
+// UploadReader uploads a bundle called name streamed from r rather than a file.  size is
+// the number of bytes to read from r, when it's negative r is read to EOF and the bundle
+// is sent with chunked transfer encoding
+func (e *LogsUpload) UploadReader(ctxt context.Context, name string, r io.Reader, size int64) (*ApiErrorResponse, error) {
+	if size < 0 {
+		size = -1
+	}
+	key, apierr, err := uploadSession(ctxt)
+	if apierr != nil || err != nil {
+		return apierr, err
+	}
+	return logsUploadReader(ctxt, key, name, r, size, nil, nil)
+}
+
+// UploadChunked uploads a bundle in parts of ro.ChunkSize bytes.  Each part is sent as
+// its own logs upload with upload_id, part and parts query params, on the assumption
+// that the cluster collects the parts of an upload id into one bundle once it has them
+// all; nothing is sent to finish the upload, so success means every part was accepted,
+// not that the cluster has put the bundle together.  A part that fails with a retryable
+// status is retried on its own, up to the connection's max attempts, defaultChunkAttempts
+// by default, and within its retry budget, any other failure ends the upload.  A part
+// rejected with a 401 logs in again and is re-sent once.  The returned state records the
+// parts that were uploaded, passing it back as ro.Resume after a failure uploads only
+// the rest
+func (e *LogsUpload) UploadChunked(ro *LogsUploadChunkedRequest) (*LogsUploadState, *ApiErrorResponse, error) {
+	f, err := os.Open(ro.File)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	chunk := ro.ChunkSize
+	if chunk <= 0 {
+		chunk = defaultLogsChunkSize
+	}
+	parts := int((fi.Size() + chunk - 1) / chunk)
+	if parts == 0 {
+		parts = 1
+	}
+	state := ro.Resume
+	if state == nil {
+		state = &LogsUploadState{UploadID: uuid.Must(uuid.NewRandom()).String(), Uploaded: map[int]bool{}}
+	} else if state.Parts != parts || state.ChunkSize != chunk {
+		return state, nil, fmt.Errorf("%w: can't resume upload %s of %d parts of %d bytes as %d parts of %d bytes",
+			ErrInvalidRequest, state.UploadID, state.Parts, state.ChunkSize, parts, chunk)
+	}
+	state.Parts = parts
+	state.ChunkSize = chunk
+	if state.Uploaded == nil {
+		state.Uploaded = map[int]bool{}
+	}
+
+	conn := GetConn(ro.Ctxt)
+	for part := 1; part <= parts; part++ {
+		if state.Uploaded[part] {
+			continue
+		}
+		off := int64(part-1) * chunk
+		size := chunk
+		if off+size > fi.Size() {
+			size = fi.Size() - off
+		}
+		if apierr, err := e.uploadPart(ro.Ctxt, conn, f, state, part, off, size); apierr != nil || err != nil {
+			return state, apierr, err
+		}
+		state.Uploaded[part] = true
+	}
+	// the upload earns retries for the connection like a single request does, not once
+	// per part, or large uploads would refill the budget other requests share
+	if conn.budget != nil {
+		conn.budget.deposit()
+	}
+	return state, nil, nil
+}
+
+// uploadPart sends size bytes of f from off as the given part of the upload, retrying
+// the way ApiConnection.retry does
+func (e *LogsUpload) uploadPart(ctxt context.Context, conn *ApiConnection, f *os.File, state *LogsUploadState, part int, off, size int64) (*ApiErrorResponse, error) {
+	params := map[string]string{
+		"upload_id": state.UploadID,
+		"part":      strconv.Itoa(part),
+		"parts":     strconv.Itoa(state.Parts),
+	}
+	maxAttempts := conn.maxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultChunkAttempts
+	}
+	reauthed := false
+	for attempt := 1; ; attempt++ {
+		key, apierr, err := uploadSession(ctxt)
+		if apierr != nil || err != nil {
+			return apierr, err
+		}
+		apierr, err = logsUploadReader(ctxt, key, f.Name(), io.NewSectionReader(f, off, size), size, params, nil)
+		if apierr == nil && err == nil {
+			return nil, nil
+		}
+		if ctxt.Err() != nil {
+			return nil, ctxt.Err()
+		}
+		if apierr != nil && apierr.Http == PermissionDenied && !reauthed && conn.hasCredentials() {
+			// the session expired mid upload, only drop it if no one has replaced it yet
+			reauthed = true
+			conn.logoutSession(key)
+			apierr, err = conn.Login(ctxt)
+			conn.notifyReauth(fmt.Sprintf("part %d of upload %s was denied", part, state.UploadID), apierr, err)
+			if apierr != nil || err != nil {
+				return apierr, err
+			}
+			// re-sending with the new session doesn't count as a retry
+			attempt--
+			continue
+		}
+		if !conn.isRetryable(apierr, err) {
+			if err != nil {
+				err = fmt.Errorf("part %d of upload %s: %w", part, state.UploadID, err)
+			}
+			return apierr, err
+		}
+		if attempt >= maxAttempts {
+			return apierr, fmt.Errorf("part %d of upload %s: %w: %d", part, state.UploadID, ErrMaxAttempts, attempt)
+		}
+		if conn.budget != nil && !conn.budget.withdraw() {
+			return apierr, fmt.Errorf("part %d of upload %s: %w", part, state.UploadID, ErrRetryBudgetExhausted)
+		}
+		if err := conn.waitToRetry(ctxt, conn.backoffInterval(attempt)); err != nil {
+			return nil, err
+		}
+	}
 }
 
 func (e *LogsUpload) RotateUploadRemove(ctxt context.Context, rule, rotated string) error {
@@ -144,19 +410,20 @@ func (e *LogsUpload) RotateUploadRemove(ctxt context.Context, rule, rotated stri
 	}
 	// Even a single line of logs will be greater than 100 bytes
 	if fstat.Size() > 100 {
-		Log().Debug("Uploading logs")
+		logger := GetConn(ctxt).logFor(ctxt)
+		logger.Debug("Uploading logs", nil)
 		_, apierr, err := e.Upload(&LogsUploadRequest{
 			Ctxt:  ctxt,
 			Files: []string{rotated},
 		})
 		if apierr != nil {
-			Log().Errorf("%s", Pretty(apierr))
+			logger.Error(Pretty(apierr), nil)
 		}
 		if err != nil {
-			Log().Error(err)
+			logger.Error(err.Error(), nil)
 		}
 	} else {
-		Log().Debugf("No new filtered logs detected.  Size: %d", fstat.Size())
+		GetConn(ctxt).logFor(ctxt).Debug(fmt.Sprintf("No new filtered logs detected.  Size: %d", fstat.Size()), nil)
 	}
 	return nil
 }
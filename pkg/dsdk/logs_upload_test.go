@@ -0,0 +1,36 @@
+package dsdk
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestProgressReader(t *testing.T) {
+	for _, total := range []int64{-1, 26} {
+		var sent []int64
+		r := &progressReader{
+			r:     iotest.OneByteReader(strings.NewReader("abcdefghijklmnopqrstuvwxyz")),
+			total: total,
+			progress: func(s, tot int64) {
+				if tot != total {
+					t.Errorf("expected a total of %d, got %d", total, tot)
+				}
+				sent = append(sent, s)
+			},
+		}
+		if _, err := ioutil.ReadAll(r); err != nil {
+			t.Fatal(err)
+		}
+		if len(sent) != 26 || sent[len(sent)-1] != 26 {
+			t.Fatalf("expected progress for each of 26 bytes, got %v", sent)
+		}
+		for i := 1; i < len(sent); i++ {
+			if sent[i] <= sent[i-1] {
+				t.Errorf("expected increasing progress, got %v", sent)
+				break
+			}
+		}
+	}
+}
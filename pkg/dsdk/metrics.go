@@ -3,7 +3,12 @@ package dsdk
 import (
 	"context"
 	"fmt"
+	"math"
 	_path "path"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
 
 	greq "github.com/levigross/grequests"
 )
@@ -86,6 +91,14 @@ type Point struct {
 	Value float64 `json:"value" mapstructure:"value"`
 }
 
+// MetricSeries is the history of one metric for one object, oldest point first
+type MetricSeries struct {
+	Metric     IOMetric
+	Object     string
+	EntityPath string
+	Points     []Point
+}
+
 type IOMetricsRequest struct {
 	Ctxt   context.Context `json:"-"`
 	Type   IOMetric        `json:"-"`
@@ -94,7 +107,7 @@ type IOMetricsRequest struct {
 
 type HWMetricsRequest struct {
 	Ctxt   context.Context `json:"-"`
-	Type   IOMetric        `json:"-"`
+	Type   HWMetric        `json:"-"`
 	Params MetricsParams   `json:"params,omitempty"`
 }
 
@@ -118,6 +131,96 @@ func newHWMetrics(path string) *HWMetrics {
 	}
 }
 
+// scopedMetricsPath returns the metrics path of the object at path, relative to the object
+// the metrics at metricsPath belong to
+func scopedMetricsPath(metricsPath, path string) string {
+	return _path.Join(_path.Dir(_path.Dir(metricsPath)), path)
+}
+
+// ForStorageNode returns the IO metrics of the storage node with the given uuid
+func (m *IOMetrics) ForStorageNode(uuid string) *IOMetrics {
+	return m.ForPath(_path.Join("storage_nodes", uuid))
+}
+
+// ForPath returns the IO metrics of the object at path, eg
+// /app_instances/ai/storage_instances/si/volumes/vol
+func (m *IOMetrics) ForPath(path string) *IOMetrics {
+	return newIOMetrics(scopedMetricsPath(m.Path, path))
+}
+
+// ForStorageNode returns the HW metrics of the storage node with the given uuid
+func (m *HWMetrics) ForStorageNode(uuid string) *HWMetrics {
+	return m.ForPath(_path.Join("storage_nodes", uuid))
+}
+
+// ForPath returns the HW metrics of the object at path
+func (m *HWMetrics) ForPath(path string) *HWMetrics {
+	return newHWMetrics(scopedMetricsPath(m.Path, path))
+}
+
+// GetMany fetches metric for each of the objects, given as paths such as
+// /storage_nodes/<uuid>, with at most concurrency requests in flight.  Metrics are keyed
+// by object, objects that failed are left out and reported in a BulkError.  Once ctxt is
+// done no more objects are fetched and its error is returned
+func (m *IOMetrics) GetMany(ctxt context.Context, metric IOMetric, objects []string, concurrency int) (map[string][]*Metrics, error) {
+	if err := metric.Validate(); err != nil {
+		return nil, err
+	}
+	return getManyMetrics(ctxt, objects, concurrency, func(obj string) ([]*Metrics, *ApiErrorResponse, error) {
+		return m.ForPath(obj).List(&IOMetricsRequest{Ctxt: ctxt, Type: metric})
+	})
+}
+
+// GetMany fetches metric for each of the objects the way IOMetrics.GetMany does
+func (m *HWMetrics) GetMany(ctxt context.Context, metric HWMetric, objects []string, concurrency int) (map[string][]*Metrics, error) {
+	if err := metric.Validate(); err != nil {
+		return nil, err
+	}
+	return getManyMetrics(ctxt, objects, concurrency, func(obj string) ([]*Metrics, *ApiErrorResponse, error) {
+		return m.ForPath(obj).List(&HWMetricsRequest{Ctxt: ctxt, Type: metric})
+	})
+}
+
+func getManyMetrics(ctxt context.Context, objects []string, concurrency int, fetch func(obj string) ([]*Metrics, *ApiErrorResponse, error)) (map[string][]*Metrics, error) {
+	var (
+		m       sync.Mutex
+		results = map[string][]*Metrics{}
+		failed  = map[string]error{}
+	)
+	runConcurrently(len(objects), concurrency, func(i int) {
+		obj := objects[i]
+		if ctxt.Err() != nil {
+			return
+		}
+		ms, apierr, err := fetch(obj)
+		if err == nil && apierr != nil {
+			err = apierr
+		}
+		m.Lock()
+		defer m.Unlock()
+		if err != nil {
+			failed[obj] = err
+			return
+		}
+		results[obj] = ms
+	})
+	if err := ctxt.Err(); err != nil {
+		return results, err
+	}
+	if len(failed) > 0 {
+		return results, &BulkError{Errors: failed}
+	}
+	return results, nil
+}
+
+// metricsErr reports a 404 for the metrics at path as ErrNotFound
+func metricsErr(path string, apierr *ApiErrorResponse, err error) error {
+	if err == nil && apierr.Http == NotFound {
+		return fmt.Errorf("no metrics at %s: %w", path, ErrNotFound)
+	}
+	return err
+}
+
 func (m *IOMetrics) List(ro *IOMetricsRequest) ([]*Metrics, *ApiErrorResponse, error) {
 	if err := ro.Type.Validate(); err != nil {
 		return nil, nil, err
@@ -128,9 +231,10 @@ func (m *IOMetrics) List(ro *IOMetricsRequest) ([]*Metrics, *ApiErrorResponse, e
 		Params: ro.Params.ToMap(),
 	}
 
-	rs, apierr, err := GetConn(ro.Ctxt).GetList(ro.Ctxt, _path.Join(m.Path, string(ro.Type)), gro)
+	path := _path.Join(m.Path, string(ro.Type))
+	rs, apierr, err := GetConn(ro.Ctxt).GetList(ro.Ctxt, path, gro)
 	if apierr != nil {
-		return nil, apierr, err
+		return nil, apierr, metricsErr(path, apierr, err)
 	}
 
 	if err != nil {
@@ -160,9 +264,10 @@ func (m *HWMetrics) List(ro *HWMetricsRequest) ([]*Metrics, *ApiErrorResponse, e
 		Params: ro.Params.ToMap(),
 	}
 
-	rs, apierr, err := GetConn(ro.Ctxt).GetList(ro.Ctxt, _path.Join(m.Path, string(ro.Type)), gro)
+	path := _path.Join(m.Path, string(ro.Type))
+	rs, apierr, err := GetConn(ro.Ctxt).GetList(ro.Ctxt, path, gro)
 	if apierr != nil {
-		return nil, apierr, err
+		return nil, apierr, metricsErr(path, apierr, err)
 	}
 
 	if err != nil {
@@ -181,3 +286,106 @@ func (m *HWMetrics) List(ro *HWMetricsRequest) ([]*Metrics, *ApiErrorResponse, e
 
 	return resp, nil, nil
 }
+
+// Range returns the history of metric for the object at path, eg /storage_nodes/<uuid>,
+// over the window in rng.  From must precede To when both are given, they and Since are RFC3339
+// timestamps or unix seconds
+func (m *IOMetrics) Range(ctxt context.Context, metric IOMetric, path string, rng ListRangeParams) (*MetricSeries, *ApiErrorResponse, error) {
+	if path == "" {
+		return nil, nil, fmt.Errorf("%w: a metrics range needs an object path", ErrInvalidRequest)
+	}
+	if rng.From != "" && rng.To != "" {
+		from, err := parseRangeTime(rng.From)
+		if err != nil {
+			return nil, nil, err
+		}
+		to, err := parseRangeTime(rng.To)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !from.Before(to) {
+			return nil, nil, fmt.Errorf("%w: metrics range from %s doesn't precede to %s", ErrInvalidRequest, rng.From, rng.To)
+		}
+	}
+	ms, apierr, err := m.ForPath(path).List(&IOMetricsRequest{
+		Ctxt:   ctxt,
+		Type:   metric,
+		Params: MetricsParams{ListRangeParams: rng},
+	})
+	if apierr != nil || err != nil {
+		return nil, apierr, err
+	}
+	series := &MetricSeries{Metric: metric, Object: path, Points: []Point{}}
+	for _, me := range ms {
+		if series.EntityPath == "" {
+			series.EntityPath = me.EntityPath
+		}
+		series.Points = append(series.Points, me.Points...)
+	}
+	sort.SliceStable(series.Points, func(i, j int) bool {
+		return series.Points[i].Time < series.Points[j].Time
+	})
+	return series, nil, nil
+}
+
+// parseRangeTime parses a range bound given as an RFC3339 timestamp, with or without
+// fractional seconds, or unix seconds
+func parseRangeTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	if secs, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	return time.Time{}, fmt.Errorf("%w: %q is not an RFC3339 timestamp or unix time", ErrInvalidRequest, s)
+}
+
+// MetricSummary rolls up the points of a metric series.  Percentiles use the nearest
+// rank, every statistic is zero for an empty series
+type MetricSummary struct {
+	Count int
+	Avg   float64
+	Max   float64
+	P95   float64
+	P99   float64
+}
+
+// Summary summarizes the points of the series
+func (s *MetricSeries) Summary() MetricSummary {
+	return SummarizePoints(s.Points)
+}
+
+// Summary summarizes the points of the metrics
+func (m *Metrics) Summary() MetricSummary {
+	return SummarizePoints(m.Points)
+}
+
+// SummarizePoints computes the average, maximum and 95th and 99th percentiles of points
+func SummarizePoints(points []Point) MetricSummary {
+	if len(points) == 0 {
+		return MetricSummary{}
+	}
+	vals := make([]float64, len(points))
+	sum := 0.0
+	for i, p := range points {
+		vals[i] = p.Value
+		sum += p.Value
+	}
+	sort.Float64s(vals)
+	return MetricSummary{
+		Count: len(vals),
+		Avg:   sum / float64(len(vals)),
+		Max:   vals[len(vals)-1],
+		P95:   percentile(vals, 95),
+		P99:   percentile(vals, 99),
+	}
+}
+
+// percentile returns the nearest rank pth percentile of the sorted, non empty vals
+func percentile(vals []float64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(vals))))
+	if rank < 1 {
+		rank = 1
+	}
+	return vals[rank-1]
+}
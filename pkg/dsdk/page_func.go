@@ -0,0 +1,22 @@
+package dsdk
+
+import (
+	"context"
+)
+
+// PageFunc is called by GetList with each page of a list as it arrives.  Returning an
+// error stops pagination and GetList returns the items fetched so far along with it
+type PageFunc func(page *ApiListOuter) error
+
+// WithPageFunc returns a copy of ctxt that makes GetList call fn after every page it
+// fetches, which is useful for reporting progress through large lists.  GetList still
+// returns every item once it's done
+func WithPageFunc(ctxt context.Context, fn PageFunc) context.Context {
+	return context.WithValue(ctxt, pageFuncCtxKey, fn)
+}
+
+// pageFuncFromContext returns the PageFunc attached to ctxt or nil
+func pageFuncFromContext(ctxt context.Context) PageFunc {
+	fn, _ := ctxt.Value(pageFuncCtxKey).(PageFunc)
+	return fn
+}
@@ -3,6 +3,7 @@ package dsdk
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	_path "path"
 
 	greq "github.com/levigross/grequests"
@@ -190,3 +191,37 @@ func (e *PlacementPolicy) Reload(ro *PlacementPolicyReloadRequest) (*PlacementPo
 	}
 	return resp, nil, nil
 }
+
+// Attach sets the placement policy named policy on every volume of the storage instance
+// at storageInstancePath.  Volumes already using the policy are left alone, so attaching
+// a policy again is a no-op
+func (e *PlacementPolicies) Attach(ctxt context.Context, policy, storageInstancePath string) (*ApiErrorResponse, error) {
+	if policy == "" {
+		return nil, fmt.Errorf("%w: a placement policy name is required", ErrInvalidRequest)
+	}
+	ppath := _path.Join(e.Path, policy)
+	rs, apierr, err := GetConn(ctxt).Get(ctxt, storageInstancePath, nil)
+	if apierr != nil {
+		return apierr, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	si := &StorageInstance{}
+	if err = FillStruct(rs.Data, si); err != nil {
+		return nil, err
+	}
+	RegisterStorageInstanceEndpoints(si)
+	for _, vol := range si.Volumes {
+		if pp := vol.PlacementPolicy; pp != nil && (pp.Path == ppath || pp.ResolvedPath == ppath) {
+			continue
+		}
+		if _, apierr, err = vol.Set(&VolumeSetRequest{
+			Ctxt:            ctxt,
+			PlacementPolicy: &PlacementPolicy{Path: ppath},
+		}); apierr != nil || err != nil {
+			return apierr, err
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,81 @@
+package dsdk
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// prometheusLabels maps the collections in a metric's entity path to the label the id
+// following them is exported as
+var prometheusLabels = map[string]string{
+	"storage_nodes":     "node",
+	"app_instances":     "app_instance",
+	"storage_instances": "storage_instance",
+	"volumes":           "volume",
+}
+
+// PrometheusName is the name io is exported to Prometheus as
+func (io IOMetric) PrometheusName() string {
+	return "datera_io_" + string(io)
+}
+
+// PrometheusName is the name hw is exported to Prometheus as
+func (hw HWMetric) PrometheusName() string {
+	return "datera_hw_" + string(hw)
+}
+
+// FormatPrometheus renders ms, the result of a metrics query, as a Prometheus gauge
+// called name in the text exposition format.  Each entity is a series holding its latest
+// point, labelled with its tenant and the node, app instance, storage instance and volume
+// found in its entity path.  Entities without points are left out
+func FormatPrometheus(name string, ms []*Metrics) string {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "# HELP %s Exported from the Datera metrics API\n", name)
+	fmt.Fprintf(b, "# TYPE %s gauge\n", name)
+	for _, m := range ms {
+		if len(m.Points) == 0 {
+			continue
+		}
+		latest := m.Points[0]
+		for _, p := range m.Points[1:] {
+			if p.Time > latest.Time {
+				latest = p
+			}
+		}
+		fmt.Fprintf(b, "%s%s %s\n", name, formatPrometheusLabels(m), strconv.FormatFloat(latest.Value, 'g', -1, 64))
+	}
+	return b.String()
+}
+
+func formatPrometheusLabels(m *Metrics) string {
+	labels := map[string]string{}
+	if m.Tenant != "" {
+		labels["tenant"] = m.Tenant
+	}
+	parts := strings.Split(strings.Trim(m.EntityPath, "/"), "/")
+	for i := 0; i+1 < len(parts); i++ {
+		if label, ok := prometheusLabels[parts[i]]; ok {
+			labels[label] = parts[i+1]
+			i++
+		}
+	}
+	if len(labels) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(labels))
+	for k := range labels {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	pairs := make([]string, len(names))
+	for i, k := range names {
+		pairs[i] = fmt.Sprintf("%s=\"%s\"", k, escapePrometheusLabel(labels[k]))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func escapePrometheusLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
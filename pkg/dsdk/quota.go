@@ -1,5 +1,92 @@
 package dsdk
 
+import (
+	"context"
+	"encoding/json"
+	_path "path"
+	"strings"
+
+	greq "github.com/levigross/grequests"
+)
+
 type Quota interface{}
 
 type QuotaStatus interface{}
+
+// TenantQuota holds a tenant's capacity and object count limits.  Limits that are nil
+// aren't set, and SetQuota leaves them as they are
+type TenantQuota struct {
+	// Capacity limits the provisioned capacity in GB
+	Capacity     *int `json:"capacity,omitempty" mapstructure:"capacity"`
+	AppInstances *int `json:"app_instances,omitempty" mapstructure:"app_instances"`
+	Volumes      *int `json:"volumes,omitempty" mapstructure:"volumes"`
+	Snapshots    *int `json:"snapshots,omitempty" mapstructure:"snapshots"`
+}
+
+// GetQuota returns the quota of the tenant at the path tenant, which may leave out
+// the leading "/root"
+func (e *Tenants) GetQuota(ctxt context.Context, tenant string) (*TenantQuota, *ApiErrorResponse, error) {
+	t, apierr, err := e.Get(&TenantsGetRequest{Ctxt: ctxt, Path: strings.TrimPrefix(tenantPath(tenant), "/")})
+	if apierr != nil {
+		return nil, apierr, err
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := tenantQuota(t.Quota)
+	return resp, nil, err
+}
+
+// SetQuota changes the limits set in quota on the tenant at the path tenant and
+// returns its updated quota.  The rest of the tenant's quota settings are kept
+func (e *Tenants) SetQuota(ctxt context.Context, tenant string, quota *TenantQuota) (*TenantQuota, *ApiErrorResponse, error) {
+	rel := strings.TrimPrefix(tenantPath(tenant), "/")
+	t, apierr, err := e.Get(&TenantsGetRequest{Ctxt: ctxt, Path: rel})
+	if apierr != nil {
+		return nil, apierr, err
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	merged := map[string]interface{}{}
+	if current, ok := t.Quota.(map[string]interface{}); ok {
+		for k, v := range current {
+			merged[k] = v
+		}
+	}
+	// only the limits that are set survive the round trip
+	b, err := json.Marshal(quota)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = json.Unmarshal(b, &merged); err != nil {
+		return nil, nil, err
+	}
+	gro := &greq.RequestOptions{JSON: map[string]interface{}{"quota": merged}}
+	rs, apierr, err := GetConn(ctxt).Put(ctxt, _path.Join(e.Path, rel), gro)
+	if apierr != nil {
+		return nil, apierr, err
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	resp := &Tenant{}
+	if err = FillStruct(rs.Data, resp); err != nil {
+		return nil, nil, err
+	}
+	q, err := tenantQuota(resp.Quota)
+	return q, nil, err
+}
+
+// tenantQuota decodes the limits in a tenant's quota
+func tenantQuota(q Quota) (*TenantQuota, error) {
+	resp := &TenantQuota{}
+	m, ok := q.(map[string]interface{})
+	if !ok {
+		return resp, nil
+	}
+	if err := FillStruct(m, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
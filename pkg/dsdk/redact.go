@@ -0,0 +1,68 @@
+package dsdk
+
+import (
+	"encoding/json"
+)
+
+const redactedValue = "********"
+
+// DefaultRedactedFields are the JSON fields masked in logged request payloads.  Use
+// WithRedactedFields to mask more
+var DefaultRedactedFields = []string{
+	"initiator_user_name",
+	"initiator_pswd",
+	"target_user_name",
+	"target_pswd",
+	"secret",
+	"secret_key",
+	"private_key",
+	"password",
+}
+
+func defaultRedactedFields() map[string]bool {
+	fields := make(map[string]bool, len(DefaultRedactedFields))
+	for _, f := range DefaultRedactedFields {
+		fields[f] = true
+	}
+	return fields
+}
+
+// redactPayload masks the values of fields anywhere in the JSON document payload.  A
+// payload that can't be parsed is masked entirely
+func redactPayload(payload []byte, fields map[string]bool) []byte {
+	var doc interface{}
+	if err := json.Unmarshal(payload, &doc); err != nil {
+		return []byte(redactedValue)
+	}
+	if !redactValue(doc, fields) {
+		return payload
+	}
+	redacted, err := json.Marshal(doc)
+	if err != nil {
+		return []byte(redactedValue)
+	}
+	return redacted
+}
+
+// redactValue masks fields in v in place and reports whether anything was masked
+func redactValue(v interface{}, fields map[string]bool) bool {
+	masked := false
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, val := range t {
+			if fields[k] {
+				t[k] = redactedValue
+				masked = true
+			} else if redactValue(val, fields) {
+				masked = true
+			}
+		}
+	case []interface{}:
+		for _, val := range t {
+			if redactValue(val, fields) {
+				masked = true
+			}
+		}
+	}
+	return masked
+}
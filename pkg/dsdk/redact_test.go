@@ -0,0 +1,52 @@
+package dsdk
+
+import (
+	"testing"
+)
+
+func Test_redactPayload(t *testing.T) {
+	fields := defaultRedactedFields()
+	tests := []struct {
+		name    string
+		payload string
+		want    string
+	}{
+		{
+			name:    "chap credentials",
+			payload: `{"name":"ai","auth":{"type":"chap","target_user_name":"user","target_pswd":"pass"}}`,
+			want:    `{"auth":{"target_pswd":"********","target_user_name":"********","type":"chap"},"name":"ai"}`,
+		},
+		{
+			name:    "nested in a list",
+			payload: `{"remote_providers":[{"name":"s3","secret_key":"shh","access_key":"id"}]}`,
+			want:    `{"remote_providers":[{"access_key":"id","name":"s3","secret_key":"********"}]}`,
+		},
+		{
+			name:    "substring of a value",
+			payload: `{"description":"not a secret","name":"target_user_name"}`,
+			want:    `{"description":"not a secret","name":"target_user_name"}`,
+		},
+		{
+			name:    "secret in a volume name",
+			payload: `{"volumes":[{"name":"my-secret-data","size":5}],"secret":"shh"}`,
+			want:    `{"secret":"********","volumes":[{"name":"my-secret-data","size":5}]}`,
+		},
+		{
+			name:    "nothing to mask",
+			payload: `null`,
+			want:    `null`,
+		},
+		{
+			name:    "unparseable",
+			payload: `{"password":`,
+			want:    `********`,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := string(redactPayload([]byte(tc.payload), fields)); got != tc.want {
+				t.Errorf("expected %s, got %s", tc.want, got)
+			}
+		})
+	}
+}
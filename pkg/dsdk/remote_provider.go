@@ -4,6 +4,7 @@ import (
 	"context"
 	_path "path"
 	"reflect"
+	"time"
 
 	greq "github.com/levigross/grequests"
 )
@@ -26,6 +27,7 @@ type RemoteProvider struct {
 	Status            string                   `json:"status,omitempty" mapstructure:"status"`
 	Host              string                   `json:"host,omitempty" mapstructure:"host"`
 	Port              int                      `json:"port,omitempty" mapstructure:"port"`
+	Bucket            string                   `json:"bucket,omitempty" mapstructure:"bucket"`
 	OperationsEp      string
 	SnapshotsEp       *Snapshots
 
@@ -43,8 +45,12 @@ type RemoteProviders struct {
 	Path string
 }
 
+// RemoteProvidersCreateRequest registers a backup target.  Host and Port are its
+// endpoint and Bucket the bucket snapshots are stored in.  AccessKey and SecretKey, or
+// PrivateKey for Google Cloud, are its credentials, secrets are masked in logged requests
 type RemoteProvidersCreateRequest struct {
 	Ctxt        context.Context `json:"-"`
+	Bucket      string          `json:"bucket,omitempty" mapstructure:"bucket"`
 	ProjectName string          `json:"project_name,omitempty" mapstructure:"project_name"`
 	AccountId   string          `json:"account_id,omitempty" mapstructure:"account_id"`
 	RemoteType  string          `json:"remote_type,omitempty" mapstructure:"remote_type"`
@@ -158,6 +164,49 @@ func (e *RemoteProviders) Refresh(ro *RemoteProvidersRefreshRequest) (*RemotePro
 	return resp, nil, nil
 }
 
+// RemoteProviderConnectionResult is the outcome of validating a remote provider
+type RemoteProviderConnectionResult struct {
+	Ok bool
+	// Latency is the time the validation request took
+	Latency time.Duration
+	// Error says why the provider couldn't be reached or rejected its credentials
+	Error string
+}
+
+type remoteProviderConnectionResponse struct {
+	Status  string `mapstructure:"status"`
+	Message string `mapstructure:"message"`
+}
+
+// TestConnection has the cluster check that the remote provider with uuid providerName
+// is reachable and accepts its credentials.  A failed check is reported in the result,
+// along with the API error when the cluster answered with one.  The check is abandoned
+// when ctxt is done
+func (e *RemoteProviders) TestConnection(ctxt context.Context, providerName string) (*RemoteProviderConnectionResult, *ApiErrorResponse, error) {
+	t1 := time.Now()
+	rs, apierr, err := GetConn(ctxt).Put(ctxt, _path.Join(e.Path, providerName, "test_connection"), &greq.RequestOptions{})
+	result := &RemoteProviderConnectionResult{Latency: time.Since(t1)}
+	if apierr != nil {
+		if apierr.Http == NotFound {
+			return nil, apierr, err
+		}
+		result.Error = apierr.Message
+		return result, apierr, err
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	resp := &remoteProviderConnectionResponse{}
+	if err = FillStruct(rs.Data, resp); err != nil {
+		return nil, nil, err
+	}
+	result.Ok = resp.Status == "ok"
+	if !result.Ok {
+		result.Error = resp.Message
+	}
+	return result, nil, nil
+}
+
 type RemoteProviderSetRequest struct {
 	Ctxt        context.Context `json:"-"`
 	ProjectName string          `json:"project_name,omitempty" mapstructure:"project_name"`
@@ -0,0 +1,26 @@
+package dsdk
+
+import (
+	"time"
+)
+
+// RequestMetric describes one request a connection sent, including retries and logins
+type RequestMetric struct {
+	Method string
+	// Route is the request path with resource ids replaced by ":id", so it's suitable
+	// as a metric label
+	Route string
+	// Status is the HTTP status of the response, ConnectionError if the cluster
+	// couldn't be reached or 0 if no response was received for any other reason
+	Status   int
+	Duration time.Duration
+	// Err is set when the request failed, either with an error or an error response
+	Err error
+}
+
+// MetricsSink receives a RequestMetric for every request a connection sends, from
+// which request counts, latencies and error counts can be exported to Prometheus or
+// any other system.  ObserveRequest is called concurrently by concurrent requests
+type MetricsSink interface {
+	ObserveRequest(m RequestMetric)
+}
@@ -0,0 +1,49 @@
+package dsdk
+
+import (
+	"errors"
+	"sync"
+)
+
+var (
+	ErrRetryBudgetExhausted = errors.New("retry budget exhausted before request completed successfully")
+)
+
+// retryBudget is a token bucket shared by all requests on a connection that bounds how
+// many retries the connection makes relative to the number of requests.  Every request
+// adds ratio tokens, up to max, and every retry takes one
+type retryBudget struct {
+	m      sync.Mutex
+	ratio  float64
+	max    float64
+	tokens float64
+}
+
+func newRetryBudget(ratio float64, burst int) *retryBudget {
+	return &retryBudget{
+		ratio:  ratio,
+		max:    float64(burst),
+		tokens: float64(burst),
+	}
+}
+
+// deposit credits the budget for a new request
+func (b *retryBudget) deposit() {
+	b.m.Lock()
+	defer b.m.Unlock()
+	b.tokens += b.ratio
+	if b.tokens > b.max {
+		b.tokens = b.max
+	}
+}
+
+// withdraw takes a token for a retry, returning false if none are left
+func (b *retryBudget) withdraw() bool {
+	b.m.Lock()
+	defer b.m.Unlock()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
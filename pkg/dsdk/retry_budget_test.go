@@ -0,0 +1,33 @@
+package dsdk
+
+import (
+	"testing"
+)
+
+func Test_retryBudget(t *testing.T) {
+	b := newRetryBudget(0.5, 2)
+	for i := 0; i < 2; i++ {
+		if !b.withdraw() {
+			t.Fatalf("retry %d denied before the burst was spent", i+1)
+		}
+	}
+	if b.withdraw() {
+		t.Fatal("retry allowed with an empty budget")
+	}
+	// two requests earn one retry
+	b.deposit()
+	if b.withdraw() {
+		t.Fatal("retry allowed with half a token")
+	}
+	b.deposit()
+	if !b.withdraw() {
+		t.Fatal("retry denied after two requests refilled a token")
+	}
+	// deposits never exceed the burst
+	for i := 0; i < 10; i++ {
+		b.deposit()
+	}
+	if b.tokens != 2 {
+		t.Errorf("expected the budget to be capped at 2 tokens, got %v", b.tokens)
+	}
+}
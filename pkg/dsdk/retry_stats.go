@@ -0,0 +1,33 @@
+package dsdk
+
+import (
+	"context"
+	"time"
+)
+
+// RetryStats describes how a request went once it has completed, successfully or not.
+// Attach one to a request's context with WithRetryStats.  A RetryStats must not be
+// shared between concurrent requests
+type RetryStats struct {
+	// Attempts is the number of times the request was sent, including the first
+	Attempts int
+	// Backoff is the total time spent sleeping between attempts
+	Backoff time.Duration
+	// Elapsed is the total time spent on the request, including backoff
+	Elapsed time.Duration
+	// LastStatus is the HTTP status of the last attempt, ConnectionError if the cluster
+	// couldn't be reached or 0 if no response was received for any other reason
+	LastStatus int
+}
+
+// WithRetryStats returns a copy of ctxt that makes requests made with it fill in stats.
+// stats is reset at the start of each request
+func WithRetryStats(ctxt context.Context, stats *RetryStats) context.Context {
+	return context.WithValue(ctxt, retryStatsCtxKey, stats)
+}
+
+// retryStatsFromContext returns the RetryStats attached to ctxt or nil
+func retryStatsFromContext(ctxt context.Context) *RetryStats {
+	stats, _ := ctxt.Value(retryStatsCtxKey).(*RetryStats)
+	return stats
+}
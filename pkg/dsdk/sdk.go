@@ -43,11 +43,11 @@ type SDK struct {
 	UserData             *UserDatas
 }
 
-func NewSDK(c *udc.UDC, secure bool) (*SDK, error) {
-	return NewSDKWithHTTPClient(c, secure, nil)
+func NewSDK(c *udc.UDC, secure bool, opts ...ApiConnectionOption) (*SDK, error) {
+	return NewSDKWithHTTPClient(c, secure, nil, opts...)
 }
 
-func NewSDKWithHTTPClient(c *udc.UDC, secure bool, client *http.Client) (*SDK, error) {
+func NewSDKWithHTTPClient(c *udc.UDC, secure bool, client *http.Client, opts ...ApiConnectionOption) (*SDK, error) {
 	var err error
 	if c == nil {
 		c, err = udc.GetConfig()
@@ -56,7 +56,15 @@ func NewSDKWithHTTPClient(c *udc.UDC, secure bool, client *http.Client) (*SDK, e
 			return nil, err
 		}
 	}
-	conn := NewApiConnectionWithHTTPClient(c, secure, client)
+	conn := NewApiConnectionWithHTTPClient(c, secure, client, opts...)
+	if conn.Err() != nil {
+		return nil, conn.Err()
+	}
+	if conn.validateApiVersion {
+		if err = conn.checkApiVersion(context.Background()); err != nil {
+			return nil, err
+		}
+	}
 	return &SDK{
 		conf:                 c,
 		Conn:                 conn,
@@ -83,44 +91,49 @@ func (c SDK) SetDriver(d string) {
 	DateraDriver = d
 }
 
+// WithContext returns a copy of ctxt for making requests with the SDK.  A trace id set
+// with WithTraceID is kept, otherwise a new one is generated
 func (c SDK) WithContext(ctxt context.Context) context.Context {
-	return context.WithValue(ctxt, "conn", c.Conn)
+	ctxt = context.WithValue(ctxt, connCtxKey, c.Conn)
+	if tid, ok := traceIDFromContext(ctxt); !ok || tid == "" {
+		ctxt = WithTraceID(ctxt, uuid.Must(uuid.NewRandom()).String())
+	}
+	return ctxt
 }
 
 func (c SDK) NewContext() context.Context {
-	ctxt := context.WithValue(context.Background(), "conn", c.Conn)
-	ctxt = context.WithValue(ctxt, "tid", uuid.Must(uuid.NewRandom()).String())
-	return ctxt
+	return c.WithContext(context.Background())
 }
 
 func (c SDK) GetDateraVersion() (string, error) {
 	sys, apierr, err := c.System.Get(&SystemGetRequest{
-		Ctxt: context.WithValue(c.NewContext(), "quiet", true),
+		Ctxt: WithQuiet(c.NewContext()),
 	})
 	if err != nil {
 		return "", err
 	}
 	if apierr != nil {
-		return "", fmt.Errorf("ApiError: %s", Pretty(apierr))
+		return "", fmt.Errorf("failed to get the cluster version: %w", apierr)
 	}
 	return sys.SwVersion, nil
 }
 
-// Cleans AppInstances, AppTemplates, StorageInstances, Initiators and InitiatorGroups under
-// the currently configured tenant
+// HealthCheck checks the cluster can be reached by listing its storage nodes, logging
+// them at debug level.  Use Cleanup to delete the resources of the configured tenant
 func (c SDK) HealthCheck() error {
 	sns, apierr, err := c.StorageNodes.List(&StorageNodesListRequest{
-		Ctxt: context.WithValue(c.NewContext(), "quiet", true),
+		Ctxt: WithQuiet(c.NewContext()),
 	})
 	if err != nil {
 		return err
 	}
 	if apierr != nil {
-		return fmt.Errorf("ApiError: %s", Pretty(apierr))
+		return fmt.Errorf("health check failed: %w", apierr)
 	}
-	Log().Debugf("Connected to cluster: %s with tenant %s.", c.conf.MgmtIp, c.conf.Tenant)
+	logger := c.Conn.logFor(context.Background())
+	logger.Debug(fmt.Sprintf("Connected to cluster: %s with tenant %s.", c.conf.MgmtIp, c.conf.Tenant), nil)
 	for _, sn := range sns {
-		Log().Debugf("Found Storage Node: %s", sn.Uuid)
+		logger.Debug(fmt.Sprintf("Found Storage Node: %s", sn.Uuid), nil)
 	}
 	return nil
 }
@@ -181,3 +181,27 @@ func (e *Snapshot) Reload(ro *SnapshotReloadRequest) (*Snapshot, *ApiErrorRespon
 	}
 	return resp, nil, nil
 }
+
+type SnapshotRestoreRequest struct {
+	Ctxt context.Context `json:"-"`
+	// AppInstance names a new app instance to create from the snapshot.  Leave it
+	// empty to restore the snapshot's parent in place
+	AppInstance string `json:"-"`
+}
+
+// Restore rolls the app instance, storage instance or volume the snapshot was taken
+// of back to it, which the server only allows while it's offline.  When
+// ro.AppInstance is set the parent is left alone and a new app instance is cloned
+// from the snapshot instead and returned
+func (e *Snapshot) Restore(ro *SnapshotRestoreRequest) (*AppInstance, *ApiErrorResponse, error) {
+	if ro.AppInstance != "" {
+		return newAppInstances("/").Create(&AppInstancesCreateRequest{
+			Ctxt:             ro.Ctxt,
+			Name:             ro.AppInstance,
+			CloneSnapshotSrc: &Snapshot{Path: e.Path},
+		})
+	}
+	gro := &greq.RequestOptions{JSON: map[string]string{"restore_point": e.Timestamp}}
+	_, apierr, err := GetConn(ro.Ctxt).Put(ro.Ctxt, _path.Dir(_path.Dir(e.Path)), gro)
+	return nil, apierr, err
+}
@@ -0,0 +1,8 @@
+package dsdk
+
+type SnmpPolicy struct {
+	Path     string `json:"path,omitempty" mapstructure:"path"`
+	Enabled  bool   `json:"enabled,omitempty" mapstructure:"enabled"`
+	Location string `json:"location,omitempty" mapstructure:"location"`
+	Contact  string `json:"contact,omitempty" mapstructure:"contact"`
+}
@@ -3,6 +3,7 @@ package dsdk
 import (
 	"context"
 	_path "path"
+	"reflect"
 
 	greq "github.com/levigross/grequests"
 )
@@ -27,11 +28,13 @@ type StorageInstance struct {
 	Volumes              []*Volume             `json:"volumes,omitempty" mapstructure:"volumes"`
 	VolumesEp            *Volumes              `json:"-"`
 	IpPoolEp             *AccessNetworkIpPools `json:"-"`
+	SnapshotsEp          *Snapshots            `json:"-"`
 }
 
 func RegisterStorageInstanceEndpoints(a *StorageInstance) {
 	a.VolumesEp = newVolumes(a.Path)
 	a.IpPoolEp = newAccessNetworkIpPools(a.Path)
+	a.SnapshotsEp = newSnapshots(a.Path)
 	for _, vol := range a.Volumes {
 		RegisterVolumeEndpoints(vol)
 	}
@@ -162,7 +165,16 @@ type StorageInstanceDeleteRequest struct {
 }
 
 func (e *StorageInstance) Delete(ro *StorageInstanceDeleteRequest) (*StorageInstance, *ApiErrorResponse, error) {
-	rs, apierr, err := GetConn(ro.Ctxt).Delete(ro.Ctxt, e.Path, nil)
+	if ro == nil {
+		return nil, nil, badStatus[InvalidRequest]
+	}
+	v := reflect.ValueOf(*ro)
+	t := reflect.TypeOf(*ro)
+	gro := &greq.RequestOptions{
+		JSON: ro,
+	}
+	formatQueryParams(gro, v, t)
+	rs, apierr, err := GetConn(ro.Ctxt).Delete(ro.Ctxt, e.Path, gro)
 	if apierr != nil {
 		return nil, apierr, err
 	}
@@ -2,7 +2,9 @@ package dsdk
 
 import (
 	"context"
+	"fmt"
 	_path "path"
+	"time"
 
 	greq "github.com/levigross/grequests"
 )
@@ -53,7 +55,7 @@ type StorageNode struct {
 	Uuid                string                 `json:"uuid,omitempty" mapstructure:"uuid"`
 	Vendor              string                 `json:"vendor,omitempty" mapstructure:"vendor"`
 	Volumes             []*Volume              `json:"volumes,omitempty" mapstructure:"volumes"`
-	BootDrivesEp        *BootDrives
+	BootDrivesEp        *BootDrives            `json:"-"`
 }
 
 func RegisterStorageNodeEndpoints(a *StorageNode) {
@@ -171,3 +173,52 @@ func (e *StorageNode) Reload(ro *StorageNodeReloadRequest) (*StorageNode, *ApiEr
 	RegisterStorageNodeEndpoints(resp)
 	return resp, nil, nil
 }
+
+// Storage node admin states SetMaintenance switches between, a drained node's op_state
+// is NodeMaintenance too
+const (
+	NodeOnline      = "online"
+	NodeMaintenance = "maintenance"
+)
+
+// SetMaintenance puts the storage node with uuid nodeUuid into maintenance, which
+// drains its IO, or brings it back online.  It refuses to put the cluster's last healthy
+// online node into maintenance.  Use WaitForDrain to wait for the node to be drained
+func (e *StorageNodes) SetMaintenance(ctxt context.Context, nodeUuid string, on bool) (*StorageNode, *ApiErrorResponse, error) {
+	state := NodeOnline
+	if on {
+		state = NodeMaintenance
+		nodes, apierr, err := e.List(&StorageNodesListRequest{Ctxt: ctxt})
+		if apierr != nil || err != nil {
+			return nil, apierr, err
+		}
+		others := 0
+		for _, n := range nodes {
+			if n.Uuid != nodeUuid && n.AdminState == NodeOnline && n.Health == "ok" {
+				others++
+			}
+		}
+		if others == 0 {
+			return nil, nil, fmt.Errorf("%w: storage node %s is the last healthy online node", ErrInvalidRequest, nodeUuid)
+		}
+	}
+	node := &StorageNode{Path: _path.Join(e.Path, nodeUuid)}
+	return node.Set(&StorageNodeSetRequest{Ctxt: ctxt, AdminState: state})
+}
+
+// WaitForDrain polls the storage node with uuid nodeUuid until its op_state is
+// NodeMaintenance and returns it.  Polls are spaced out like retries are, using the
+// connection's backoff.  If timeout passes first the last version seen is returned with
+// ErrWaitTimeout
+func (e *StorageNodes) WaitForDrain(ctxt context.Context, nodeUuid string, timeout time.Duration) (*StorageNode, *ApiErrorResponse, error) {
+	var last *StorageNode
+	apierr, err := pollUntil(ctxt, timeout, "storage node "+nodeUuid, NodeMaintenance, func(ctxt context.Context) (string, *ApiErrorResponse, error) {
+		node, apierr, err := e.Get(&StorageNodesGetRequest{Ctxt: ctxt, Uuid: nodeUuid})
+		if apierr != nil || err != nil {
+			return "", apierr, err
+		}
+		last = node
+		return node.OpState, nil, nil
+	})
+	return last, apierr, err
+}
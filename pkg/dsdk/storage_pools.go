@@ -2,25 +2,31 @@ package dsdk
 
 import (
 	"context"
+	"fmt"
 	_path "path"
+	"reflect"
 
 	greq "github.com/levigross/grequests"
 )
 
 type StoragePool struct {
-	Path    string         `json:"path,omitempty" mapstructure:"path"`
-	Members []*StorageNode `json:"members,omitempty" mapstructure:"members"`
-	Name    string         `json:"name,omitempty" mapstructure:"name"`
+	Path      string         `json:"path,omitempty" mapstructure:"path"`
+	MediaType string         `json:"media_type,omitempty" mapstructure:"media_type"`
+	Members   []*StorageNode `json:"members,omitempty" mapstructure:"members"`
+	Name      string         `json:"name,omitempty" mapstructure:"name"`
 }
 
 type StoragePools struct {
 	Path string
 }
 
+// StoragePoolsCreateRequest creates a pool of the given storage nodes, members only
+// need their Path set
 type StoragePoolsCreateRequest struct {
-	Ctxt    context.Context `json:"-"`
-	Members []*StorageNode  `json:"members,omitempty" mapstructure:"members"`
-	Name    string          `json:"name,omitempty" mapstructure:"name"`
+	Ctxt      context.Context `json:"-"`
+	MediaType string          `json:"media_type,omitempty" mapstructure:"media_type"`
+	Members   []*StorageNode  `json:"members,omitempty" mapstructure:"members"`
+	Name      string          `json:"name,omitempty" mapstructure:"name"`
 }
 
 func newStoragePools(path string) *StoragePools {
@@ -116,12 +122,24 @@ func (e *StoragePool) Set(ro *StoragePoolSetRequest) (*StoragePool, *ApiErrorRes
 
 }
 
+// StoragePoolDeleteRequest deletes a pool.  Force removes an empty pool the cluster
+// would otherwise refuse to delete, eg one that still lists member nodes
 type StoragePoolDeleteRequest struct {
-	Ctxt context.Context `json:"-"`
+	Ctxt  context.Context `json:"-"`
+	Force bool            `json:"force,omitempty" mapstructure:"force"`
 }
 
 func (e *StoragePool) Delete(ro *StoragePoolDeleteRequest) (*StoragePool, *ApiErrorResponse, error) {
-	rs, apierr, err := GetConn(ro.Ctxt).Delete(ro.Ctxt, e.Path, nil)
+	if ro == nil {
+		return nil, nil, badStatus[InvalidRequest]
+	}
+	v := reflect.ValueOf(*ro)
+	t := reflect.TypeOf(*ro)
+	gro := &greq.RequestOptions{
+		JSON: ro,
+	}
+	formatQueryParams(gro, v, t)
+	rs, apierr, err := GetConn(ro.Ctxt).Delete(ro.Ctxt, e.Path, gro)
 	if apierr != nil {
 		return nil, apierr, err
 	}
@@ -134,3 +152,70 @@ func (e *StoragePool) Delete(ro *StoragePoolDeleteRequest) (*StoragePool, *ApiEr
 	}
 	return resp, nil, nil
 }
+
+// PoolUsage is how full a storage pool is, summed across its member storage nodes in
+// the units the API reports capacity in
+type PoolUsage struct {
+	Name     string
+	Path     string
+	Capacity int
+	Used     int
+	Free     int
+	UsedPct  float64
+	FreePct  float64
+	// Severity is SeverityInfo, SeverityWarning or SeverityCritical depending on which
+	// of the report's thresholds UsedPct reached
+	Severity string
+}
+
+// UsageReport reports how full every storage pool is.  Pools at least warnPct percent
+// used are SeverityWarning and those at least critPct percent used SeverityCritical.
+// Pools don't report capacity themselves so it's taken from their member nodes, a pool
+// without capacity is reported as 0% used
+func (e *StoragePools) UsageReport(ctxt context.Context, warnPct, critPct float64) ([]*PoolUsage, *ApiErrorResponse, error) {
+	if warnPct < 0 || critPct > 100 || warnPct > critPct {
+		return nil, nil, fmt.Errorf("%w: usage thresholds must satisfy 0 <= warning (%v) <= critical (%v) <= 100",
+			ErrInvalidRequest, warnPct, critPct)
+	}
+	pools, apierr, err := e.List(&StoragePoolsListRequest{Ctxt: ctxt})
+	if apierr != nil || err != nil {
+		return nil, apierr, err
+	}
+	nodes, apierr, err := newStorageNodes("/").List(&StorageNodesListRequest{Ctxt: ctxt})
+	if apierr != nil || err != nil {
+		return nil, apierr, err
+	}
+	byPath := map[string]*StorageNode{}
+	for _, n := range nodes {
+		byPath[n.Path] = n
+		byPath[_path.Join("/storage_nodes", n.Uuid)] = n
+	}
+	report := []*PoolUsage{}
+	for _, p := range pools {
+		u := &PoolUsage{Name: p.Name, Path: p.Path, Severity: SeverityInfo}
+		for _, m := range p.Members {
+			n := byPath[m.Path]
+			if n == nil && m.Uuid != "" {
+				n = byPath[_path.Join("/storage_nodes", m.Uuid)]
+			}
+			if n == nil {
+				continue
+			}
+			u.Capacity += n.TotalCapacity
+			u.Free += n.AvailableCapacity
+		}
+		u.Used = u.Capacity - u.Free
+		if u.Capacity > 0 {
+			u.UsedPct = float64(u.Used) * 100 / float64(u.Capacity)
+			u.FreePct = 100 - u.UsedPct
+		}
+		switch {
+		case u.Capacity > 0 && u.UsedPct >= critPct:
+			u.Severity = SeverityCritical
+		case u.Capacity > 0 && u.UsedPct >= warnPct:
+			u.Severity = SeverityWarning
+		}
+		report = append(report, u)
+	}
+	return report, nil, nil
+}
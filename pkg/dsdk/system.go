@@ -34,6 +34,7 @@ type System struct {
 	NetworkDevices              []*NetworkDevice `json:"network_devices,omitempty" mapstructure:"network_devices"`
 	NtpServers                  []string         `json:"ntp_servers,omitempty" mapstructure:"ntp_servers"`
 	OpState                     string           `json:"op_state,omitempty" mapstructure:"op_state"`
+	SnmpPolicy                  *SnmpPolicy      `json:"snmp_policy,omitempty" mapstructure:"snmp_policy"`
 	SwVersion                   string           `json:"sw_version,omitempty" mapstructure:"sw_version"`
 	Timezone                    string           `json:"timezone,omitempty" mapstructure:"timezone"`
 	TotalCapacity               int              `json:"total_capacity,omitempty" mapstructure:"total_capacity"`
@@ -74,14 +75,20 @@ func (e *System) Get(ro *SystemGetRequest) (*System, *ApiErrorResponse, error) {
 	return resp, nil, nil
 }
 
+// SystemSetRequest holds the system settings to change.  Fields left empty are
+// left out of the request, so the server keeps their current values
 type SystemSetRequest struct {
 	Ctxt                             context.Context  `json:"-"`
 	AccessInterfaceAggrType          string           `json:"access_interface_aggr_type,omitempty" mapstructure:"access_interface_aggr_type"`
 	CallhomeEnabled                  bool             `json:"callhome_enabled,omitempty" mapstructure:"callhome_enabled"`
 	CompressionEnabled               bool             `json:"compression_enabled,omitempty" mapstructure:"compression_enabled"`
+	Dns                              *Dns             `json:"dns,omitempty" mapstructure:"dns"`
 	InterfaceAggregationMode         string           `json:"interface_aggregation_mode,omitempty" mapstructure:"interface_aggregation_mode"`
 	InternalInterfaceAggregationType string           `json:"internal_interface_aggr_type,omitempty" mapstructure:"internal_interface_aggr_type"`
 	NetworkDevices                   []*NetworkDevice `json:"network_devices,omitempty" mapstructure:"network_devices"`
+	NtpServers                       []string         `json:"ntp_servers,omitempty" mapstructure:"ntp_servers"`
+	SnmpPolicy                       *SnmpPolicy      `json:"snmp_policy,omitempty" mapstructure:"snmp_policy"`
+	Timezone                         string           `json:"timezone,omitempty" mapstructure:"timezone"`
 }
 
 func (e *System) Set(ro *SystemSetRequest) (*System, *ApiErrorResponse, error) {
@@ -122,3 +129,44 @@ func (e *System) Reload(ro *SystemReloadRequest) (*System, *ApiErrorResponse, er
 	RegisterSystemEndpoints(resp)
 	return resp, nil, nil
 }
+
+// CapacitySummary is the cluster's capacity summed across its storage nodes, in the
+// units the API reports capacity in
+type CapacitySummary struct {
+	// Raw is the capacity of all the nodes' media
+	Raw int
+	// Usable is what's left of Raw for data after the cluster's overhead
+	Usable int
+	// Used and Free split Usable into what's written and what's available
+	Used int
+	Free int
+	// Provisioned is the capacity of every volume, which may exceed Usable when
+	// volumes are thin provisioned
+	Provisioned int
+}
+
+// CapacitySummary rolls the capacity of every storage node up into a single summary
+func (e *System) CapacitySummary(ctxt context.Context) (*CapacitySummary, *ApiErrorResponse, error) {
+	sys, apierr, err := e.Get(&SystemGetRequest{Ctxt: ctxt})
+	if apierr != nil {
+		return nil, apierr, err
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	nodes, apierr, err := newStorageNodes("/").List(&StorageNodesListRequest{Ctxt: ctxt})
+	if apierr != nil {
+		return nil, apierr, err
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	summary := &CapacitySummary{Provisioned: sys.TotalProvisionedCapacity}
+	for _, node := range nodes {
+		summary.Raw += node.TotalRawCapacity
+		summary.Usable += node.TotalCapacity
+		summary.Free += node.AvailableCapacity
+	}
+	summary.Used = summary.Usable - summary.Free
+	return summary, nil, nil
+}
@@ -2,7 +2,9 @@ package dsdk
 
 import (
 	"context"
+	"fmt"
 	_path "path"
+	"strings"
 
 	greq "github.com/levigross/grequests"
 )
@@ -149,3 +151,71 @@ func (e *Tenant) Delete(ro *TenantDeleteRequest) (*Tenant, *ApiErrorResponse, er
 	}
 	return resp, nil, nil
 }
+
+// CreateSubTenant creates a tenant named name under the tenant at parent and returns
+// it.  parent is a tenant path like "/root/customer", the leading "/root" may be
+// left out.  The parent is looked up first so a missing one fails with an error
+// satisfying IsNotFound
+func (e *Tenants) CreateSubTenant(ctxt context.Context, parent, name string) (*Tenant, *ApiErrorResponse, error) {
+	parent = tenantPath(parent)
+	if _, apierr, err := e.Get(&TenantsGetRequest{Ctxt: ctxt, Path: strings.TrimPrefix(parent, "/")}); apierr != nil || err != nil {
+		return nil, apierr, err
+	}
+	// tenants are created in the tenant the request is made in
+	return e.Create(&TenantsCreateRequest{Ctxt: WithRequestTenant(ctxt, parent), Name: name})
+}
+
+// tenantPath returns the full path of the tenant at path, adding the "/root" prefix
+// if it's missing
+func tenantPath(path string) string {
+	p := strings.Trim(path, "/")
+	if p != "root" && !strings.HasPrefix(p, "root/") {
+		p = _path.Join("root", p)
+	}
+	return "/" + p
+}
+
+// maxTenantTreeDepth bounds how many levels of sub-tenants ListTree descends
+const maxTenantTreeDepth = 16
+
+// TenantNode is a tenant and its sub-tenants in the tree returned by ListTree
+type TenantNode struct {
+	Tenant   *Tenant
+	Children []*TenantNode
+}
+
+// ListTree returns the tenant at the path root, which may leave out the leading
+// "/root", with all of its sub-tenants below it.  A sub-tenant that has already been
+// visited is left out rather than looping forever, and trees deeper than 16 levels
+// fail
+func (e *Tenants) ListTree(ctxt context.Context, root string) (*TenantNode, *ApiErrorResponse, error) {
+	return e.listTree(ctxt, tenantPath(root), 0, NewStringSet(0))
+}
+
+func (e *Tenants) listTree(ctxt context.Context, path string, depth int, seen *StringSet) (*TenantNode, *ApiErrorResponse, error) {
+	if depth >= maxTenantTreeDepth {
+		return nil, nil, fmt.Errorf("tenant %s is more than %d levels deep", path, maxTenantTreeDepth)
+	}
+	seen.Add(path)
+	tenant, apierr, err := e.Get(&TenantsGetRequest{Ctxt: ctxt, Path: strings.TrimPrefix(path, "/")})
+	if apierr != nil || err != nil {
+		return nil, apierr, err
+	}
+	node := &TenantNode{Tenant: tenant}
+	for _, sub := range tenant.Subtenants {
+		// sub-tenants may be listed by path or by name
+		if !strings.HasPrefix(sub, "/") {
+			sub = _path.Join(path, sub)
+		}
+		if seen.Contains(sub) {
+			GetConn(ctxt).logFor(ctxt).Debug(fmt.Sprintf("skipping tenant %s listed again under %s", sub, path), nil)
+			continue
+		}
+		child, apierr, err := e.listTree(ctxt, sub, depth+1, seen)
+		if apierr != nil || err != nil {
+			return nil, apierr, err
+		}
+		node.Children = append(node.Children, child)
+	}
+	return node, nil, nil
+}
@@ -0,0 +1,35 @@
+package dsdk
+
+import (
+	"context"
+)
+
+// Tracer starts a span for every request a connection sends, including retries and
+// logins.  It's shaped so an OpenTelemetry trace.Tracer can be adapted to it in a few
+// lines.  Connections don't trace unless one is set with WithTracer
+type Tracer interface {
+	// Start starts a span named name as a child of any span in ctx
+	Start(ctx context.Context, name string) Span
+}
+
+// Span is a single traced request
+type Span interface {
+	SetAttributes(attrs map[string]interface{})
+	RecordError(err error)
+	End()
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(map[string]interface{}) {}
+func (noopSpan) RecordError(error)                    {}
+func (noopSpan) End()                                 {}
+
+// startSpan starts a span with the connection's tracer, or a span that does nothing if
+// it has none
+func (c *ApiConnection) startSpan(ctxt context.Context, name string) Span {
+	if c.tracer == nil {
+		return noopSpan{}
+	}
+	return c.tracer.Start(ctxt, name)
+}
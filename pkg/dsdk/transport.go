@@ -0,0 +1,116 @@
+package dsdk
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+var (
+	// DefaultTLSMinVersion is the oldest TLS version secure connections accept unless
+	// configured otherwise with WithTLSMinVersion or WithTLSConfig
+	DefaultTLSMinVersion uint16 = tls.VersionTLS12
+)
+
+// newTransport builds the http.Transport used by a connection that wasn't given its own
+// http.Client.  It mirrors http.DefaultTransport, which is left untouched, with the
+// connection's TLS, proxy and connection pool settings applied
+func (c *ApiConnection) newTransport() *http.Transport {
+	cfg := &tls.Config{
+		// TODO(_alastor_): Disable this and do real certificate verification
+		InsecureSkipVerify: true,
+	}
+	if c.tlsConfig != nil {
+		cfg = c.tlsConfig.Clone()
+	}
+	if c.tlsMinVersion != 0 {
+		cfg.MinVersion = c.tlsMinVersion
+	} else if cfg.MinVersion == 0 {
+		cfg.MinVersion = DefaultTLSMinVersion
+	}
+	t := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		TLSClientConfig:       cfg,
+	}
+	if c.dialContext != nil {
+		t.DialContext = c.dialContext
+	}
+	if c.proxy != nil {
+		t.Proxy = c.proxy
+	}
+	if c.maxIdleConns != 0 {
+		t.MaxIdleConns = c.maxIdleConns
+	}
+	if c.maxIdleConnsPerHost != 0 {
+		t.MaxIdleConnsPerHost = c.maxIdleConnsPerHost
+	}
+	if c.idleConnTimeout != 0 {
+		t.IdleConnTimeout = c.idleConnTimeout
+	}
+	return t
+}
+
+// mutableTLSConfig returns the connection's TLS config for an option to update,
+// creating one with the default of not verifying certificates if none was set
+func (c *ApiConnection) mutableTLSConfig() *tls.Config {
+	if c.tlsConfig == nil {
+		c.tlsConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	return c.tlsConfig
+}
+
+// addCACerts trusts the PEM encoded certificates in pem in addition to the system
+// roots and turns on certificate verification
+func (c *ApiConnection) addCACerts(pem []byte) error {
+	cfg := c.mutableTLSConfig()
+	if cfg.RootCAs == nil {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			c.logFor(context.Background()).Info(fmt.Sprintf("failed to load system cert pool, only trusting the provided CA: %s", err), nil)
+			pool = x509.NewCertPool()
+		}
+		cfg.RootCAs = pool
+	}
+	if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+		return fmt.Errorf("no PEM encoded certificates found in CA bundle")
+	}
+	cfg.InsecureSkipVerify = false
+	return nil
+}
+
+// proxyFromURL returns a proxy function that sends every request through proxyURL
+// except those to hosts excluded by the NO_PROXY environment variable
+func proxyFromURL(proxyURL string) (func(*http.Request) (*url.URL, error), error) {
+	if _, err := url.Parse(proxyURL); err != nil {
+		return nil, fmt.Errorf("invalid proxy url: %w", err)
+	}
+	noProxy := os.Getenv("NO_PROXY")
+	if noProxy == "" {
+		noProxy = os.Getenv("no_proxy")
+	}
+	f := (&httpproxy.Config{
+		HTTPProxy:  proxyURL,
+		HTTPSProxy: proxyURL,
+		NoProxy:    noProxy,
+	}).ProxyFunc()
+	return func(r *http.Request) (*url.URL, error) {
+		return f(r.URL)
+	}, nil
+}
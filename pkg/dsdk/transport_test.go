@@ -0,0 +1,436 @@
+package dsdk
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	udc "github.com/Datera/go-udc/pkg/udc"
+)
+
+// testCA is a certificate authority for issuing test certificates
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{
+		cert: cert,
+		key:  key,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+}
+
+// issue signs a certificate for 127.0.0.1 that can be used by either end of a connection
+func (ca *testCA) issue(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// newTLSTestServer starts an HTTPS server that answers logins and system requests
+func newTLSTestServer() *httptest.Server {
+	return newTLSTestServerWithConfig(nil)
+}
+
+// newTLSTestServerWithConfig is like newTLSTestServer but uses cfg for TLS when
+// given instead of the httptest self-signed certificate
+func newTLSTestServerWithConfig(cfg *tls.Config) *httptest.Server {
+	srv := httptest.NewUnstartedServer(newTestHandler())
+	srv.TLS = cfg
+	srv.StartTLS()
+	return srv
+}
+
+// newTestHandler answers logins and system requests
+func newTestHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/login", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&ApiLogin{Key: "thekey"})
+	})
+	mux.HandleFunc("/v1/system", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&ApiOuter{Data: map[string]interface{}{"name": "the system"}})
+	})
+	return mux
+}
+
+// newSecureTestConnection returns a secure connection pointed at srv
+func newSecureTestConnection(t *testing.T, srv *httptest.Server, opts ...ApiConnectionOption) *ApiConnection {
+	return newSecureTestConnectionWithUDC(t, srv, &udc.UDC{
+		MgmtIp:     "127.0.0.1",
+		Username:   "foo",
+		Password:   "bar",
+		ApiVersion: "1",
+	}, opts...)
+}
+
+func newSecureTestConnectionWithUDC(t *testing.T, srv *httptest.Server, cfg *udc.UDC, opts ...ApiConnectionOption) *ApiConnection {
+	c := NewApiConnection(cfg, true, opts...)
+	if err := c.Err(); err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(srv.URL + "/v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.baseUrl = u
+	return c
+}
+
+func TestWithTLSConfigVerifiesCertificate(t *testing.T) {
+	srv := newTLSTestServer()
+	defer srv.Close()
+
+	c := newSecureTestConnection(t, srv, WithTLSConfig(&tls.Config{}))
+	if _, _, err := c.Get(context.Background(), "system", nil); err == nil {
+		t.Fatal("expected an untrusted self-signed certificate to be rejected")
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+	c = newSecureTestConnection(t, srv, WithTLSConfig(&tls.Config{RootCAs: pool}))
+	rs, apierr, err := c.Get(context.Background(), "system", nil)
+	if apierr != nil || err != nil {
+		t.Fatalf("expected the trusted certificate to be accepted, got %v %v", apierr, err)
+	}
+	if rs.Data["name"] != "the system" {
+		t.Errorf("unexpected response %+v", rs)
+	}
+}
+
+// getSystem makes an authenticated request through c
+func getSystem(c *ApiConnection) error {
+	_, apierr, err := c.Get(context.Background(), "system", nil)
+	if apierr != nil {
+		return fmt.Errorf("%s", Pretty(apierr))
+	}
+	return err
+}
+
+func TestWithCACert(t *testing.T) {
+	ca := newTestCA(t)
+	srv := newTLSTestServerWithConfig(&tls.Config{Certificates: []tls.Certificate{ca.issue(t)}})
+	defer srv.Close()
+
+	if err := getSystem(newSecureTestConnection(t, srv, WithCACertPEM(newTestCA(t).pem))); err == nil {
+		t.Error("expected a certificate from an untrusted CA to be rejected")
+	}
+	if err := getSystem(newSecureTestConnection(t, srv, WithCACertPEM(ca.pem))); err != nil {
+		t.Errorf("expected a certificate from the trusted CA to be accepted, got %s", err)
+	}
+
+	dir, err := ioutil.TempDir("", "dsdk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "ca.pem")
+	if err := ioutil.WriteFile(path, ca.pem, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := getSystem(newSecureTestConnection(t, srv, WithCACertPath(path))); err != nil {
+		t.Errorf("expected a certificate from the trusted CA to be accepted, got %s", err)
+	}
+}
+
+func TestWithCACertPEMInvalid(t *testing.T) {
+	if err := newTestConnection(WithCACertPEM([]byte("not a cert"))).Err(); err == nil {
+		t.Error("expected an error for a bundle without certificates")
+	}
+}
+
+func TestWithClientCertificate(t *testing.T) {
+	ca := newTestCA(t)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	srv := newTLSTestServerWithConfig(&tls.Config{
+		Certificates: []tls.Certificate{ca.issue(t)},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	})
+	defer srv.Close()
+
+	if err := getSystem(newSecureTestConnection(t, srv, WithCACertPEM(ca.pem))); err == nil {
+		t.Error("expected the server to reject a connection without a client certificate")
+	}
+	client := ca.issue(t)
+	if err := getSystem(newSecureTestConnection(t, srv, WithCACertPEM(ca.pem), WithClientCertificate(client))); err != nil {
+		t.Errorf("expected the client certificate to be accepted, got %s", err)
+	}
+
+	dir, err := ioutil.TempDir("", "dsdk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile := filepath.Join(dir, "client.pem"), filepath.Join(dir, "client.key")
+	keyDer, err := x509.MarshalECPrivateKey(client.PrivateKey.(*ecdsa.PrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: client.Certificate[0]}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := getSystem(newSecureTestConnection(t, srv, WithCACertPEM(ca.pem), WithClientCertFiles(certFile, keyFile))); err != nil {
+		t.Errorf("expected the client certificate loaded from files to be accepted, got %s", err)
+	}
+}
+
+func TestClientCertificateWithoutLogin(t *testing.T) {
+	ca := newTestCA(t)
+	srv := newTLSTestServerWithConfig(&tls.Config{Certificates: []tls.Certificate{ca.issue(t)}})
+	defer srv.Close()
+
+	c := newSecureTestConnectionWithUDC(t, srv, &udc.UDC{MgmtIp: "127.0.0.1", ApiVersion: "1"},
+		WithCACertPEM(ca.pem), WithClientCertificate(ca.issue(t)))
+	if err := getSystem(c); err != nil {
+		t.Fatal(err)
+	}
+	if c.IsLoggedIn() {
+		t.Error("expected a certificate only connection not to log in")
+	}
+}
+
+func TestWithTLSMinVersion(t *testing.T) {
+	ca := newTestCA(t)
+	srv := newTLSTestServerWithConfig(&tls.Config{
+		Certificates: []tls.Certificate{ca.issue(t)},
+		MaxVersion:   tls.VersionTLS12,
+	})
+	defer srv.Close()
+
+	if err := getSystem(newSecureTestConnection(t, srv, WithCACertPEM(ca.pem), WithTLSMinVersion(tls.VersionTLS13))); err == nil {
+		t.Error("expected the handshake with a TLS 1.2 server to fail")
+	}
+	if err := getSystem(newSecureTestConnection(t, srv, WithCACertPEM(ca.pem))); err != nil {
+		t.Errorf("expected the default minimum version to accept TLS 1.2, got %s", err)
+	}
+}
+
+func Test_newTransportDefaultMinVersion(t *testing.T) {
+	if v := newTestConnection().newTransport().TLSClientConfig.MinVersion; v != tls.VersionTLS12 {
+		t.Errorf("expected TLS 1.2 as the default minimum version, got %#x", v)
+	}
+	if err := newTestConnection(WithTLSMinVersion(0x0200)).Err(); err == nil {
+		t.Error("expected an error for an unknown TLS version")
+	}
+}
+
+func TestDefaultTransportUntouched(t *testing.T) {
+	srv := newTLSTestServer()
+	defer srv.Close()
+	c := newSecureTestConnection(t, srv)
+	if err := getSystem(c); err != nil {
+		t.Fatal(err)
+	}
+	if c.httpClient.Transport == http.DefaultTransport {
+		t.Error("expected the secure connection to use its own transport")
+	}
+	tr, ok := http.DefaultTransport.(*http.Transport)
+	if !ok {
+		t.Fatalf("http.DefaultTransport was replaced with %T", http.DefaultTransport)
+	}
+	if tr.TLSClientConfig != nil && tr.TLSClientConfig.InsecureSkipVerify {
+		t.Error("http.DefaultTransport has certificate verification disabled")
+	}
+}
+
+func TestConnectionPoolOptions(t *testing.T) {
+	if c := newTestConnection(); c.httpClient != nil {
+		t.Errorf("expected a plain HTTP connection to use the default client, got %+v", c.httpClient)
+	}
+	c := newTestConnection(WithMaxIdleConns(10), WithMaxIdleConnsPerHost(5), WithIdleConnTimeout(time.Minute))
+	if c.httpClient == nil {
+		t.Fatal("expected a dedicated client when pool options are given")
+	}
+	tr := c.httpClient.Transport.(*http.Transport)
+	if tr.MaxIdleConns != 10 || tr.MaxIdleConnsPerHost != 5 || tr.IdleConnTimeout != time.Minute {
+		t.Errorf("transport doesn't carry the pool settings: MaxIdleConns=%d MaxIdleConnsPerHost=%d IdleConnTimeout=%s",
+			tr.MaxIdleConns, tr.MaxIdleConnsPerHost, tr.IdleConnTimeout)
+	}
+}
+
+// newProxyTestServer starts a plain HTTP proxy stub that answers requests for the
+// cluster itself and records the hosts it was asked to reach
+func newProxyTestServer(hosts *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*hosts = append(*hosts, r.URL.Host)
+		switch r.URL.Path {
+		case "/v1/login":
+			json.NewEncoder(w).Encode(&ApiLogin{Key: "thekey"})
+		default:
+			json.NewEncoder(w).Encode(&ApiOuter{Data: map[string]interface{}{"name": "the system"}})
+		}
+	}))
+}
+
+func newProxiedTestConnection(opts ...ApiConnectionOption) *ApiConnection {
+	return NewApiConnection(&udc.UDC{
+		MgmtIp:     "cluster.invalid",
+		Username:   "foo",
+		Password:   "bar",
+		ApiVersion: "1",
+	}, false, opts...)
+}
+
+func TestWithProxyURL(t *testing.T) {
+	var hosts []string
+	proxy := newProxyTestServer(&hosts)
+	defer proxy.Close()
+
+	if err := getSystem(newProxiedTestConnection(WithProxyURL(proxy.URL), WithMaxAttempts(1))); err != nil {
+		t.Fatal(err)
+	}
+	if len(hosts) != 2 || hosts[0] != "cluster.invalid:7717" || hosts[1] != "cluster.invalid:7717" {
+		t.Errorf("expected the login and request to go through the proxy, got %v", hosts)
+	}
+
+	hosts = nil
+	os.Setenv("NO_PROXY", "cluster.invalid")
+	defer os.Unsetenv("NO_PROXY")
+	if err := getSystem(newProxiedTestConnection(WithProxyURL(proxy.URL), WithMaxAttempts(1))); err == nil {
+		t.Error("expected the unproxied request to an unresolvable host to fail")
+	}
+	if len(hosts) != 0 {
+		t.Errorf("expected NO_PROXY hosts to bypass the proxy, got %v", hosts)
+	}
+}
+
+func TestWithProxy(t *testing.T) {
+	var hosts []string
+	proxy := newProxyTestServer(&hosts)
+	defer proxy.Close()
+	u, err := url.Parse(proxy.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := getSystem(newProxiedTestConnection(WithProxy(http.ProxyURL(u)))); err != nil {
+		t.Fatal(err)
+	}
+	if len(hosts) != 2 {
+		t.Errorf("expected the login and request to go through the proxy, got %v", hosts)
+	}
+}
+
+// pipeListener is a net.Listener whose connections are created in memory by dial
+type pipeListener struct {
+	conns  chan net.Conn
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newPipeListener() *pipeListener {
+	return &pipeListener{conns: make(chan net.Conn), closed: make(chan struct{})}
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.closed:
+		return nil, fmt.Errorf("listener closed")
+	}
+}
+
+func (l *pipeListener) Close() error {
+	l.once.Do(func() { close(l.closed) })
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr {
+	return &net.UnixAddr{Name: "pipe", Net: "pipe"}
+}
+
+func (l *pipeListener) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	client, server := net.Pipe()
+	select {
+	case l.conns <- server:
+		return client, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func TestWithDialContext(t *testing.T) {
+	l := newPipeListener()
+	var addrs []string
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		addrs = append(addrs, addr)
+		return l.dial(ctx, network, addr)
+	}
+	srv := &http.Server{Handler: newTestHandler()}
+	go srv.Serve(l)
+	defer srv.Close()
+
+	c := NewApiConnection(&udc.UDC{
+		MgmtIp:     "cluster.invalid",
+		Username:   "foo",
+		Password:   "bar",
+		ApiVersion: "1",
+	}, false, WithDialContext(dial))
+	if err := getSystem(c); err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) == 0 || addrs[0] != "cluster.invalid:7717" {
+		t.Errorf("expected the custom dialer to be asked for cluster.invalid:7717, got %v", addrs)
+	}
+}
@@ -2,6 +2,7 @@ package dsdk
 
 import (
 	"context"
+	"fmt"
 	greq "github.com/levigross/grequests"
 	_path "path"
 )
@@ -98,3 +99,70 @@ func (e *UserDatas) Get(ud *UserDataGetRequest) (*UserData, *ApiErrorResponse, e
 	}
 	return resp, nil, nil
 }
+
+// GetKeys returns the user data of the object at objectPath, eg /app_instances/my-app,
+// as strings.  An object without user data has none rather than failing
+func (e *UserDatas) GetKeys(ctxt context.Context, objectPath string) (map[string]string, *ApiErrorResponse, error) {
+	data, apierr, err := e.getData(ctxt, objectPath)
+	if apierr != nil || err != nil {
+		return nil, apierr, err
+	}
+	return stringData(data), nil, nil
+}
+
+// SetKeys merges data into the user data of the object at objectPath, leaving keys
+// not in data as they are.  A key set to the empty string is deleted.  It returns the
+// merged user data.  It isn't atomic: the user data is read, merged and then written
+// back whole, so keys another client sets on the object in between are overwritten.
+// Callers sharing an object's user data must serialize their SetKeys calls
+func (e *UserDatas) SetKeys(ctxt context.Context, objectPath string, data map[string]string) (map[string]string, *ApiErrorResponse, error) {
+	merged, apierr, err := e.getData(ctxt, objectPath)
+	if apierr != nil || err != nil {
+		return nil, apierr, err
+	}
+	for k, v := range data {
+		if v == "" {
+			delete(merged, k)
+		} else {
+			merged[k] = v
+		}
+	}
+	gro := &greq.RequestOptions{JSON: map[string]interface{}{"data": merged}}
+	if _, apierr, err = GetConn(ctxt).Put(ctxt, _path.Join(objectPath, e.Path), gro); apierr != nil || err != nil {
+		return nil, apierr, err
+	}
+	return stringData(merged), nil, nil
+}
+
+// getData returns the raw user data of the object at objectPath
+func (e *UserDatas) getData(ctxt context.Context, objectPath string) (map[string]interface{}, *ApiErrorResponse, error) {
+	rs, apierr, err := GetConn(ctxt).Get(ctxt, _path.Join(objectPath, e.Path), nil)
+	if apierr != nil && apierr.Http == NotFound {
+		return map[string]interface{}{}, nil, nil
+	}
+	if apierr != nil || err != nil {
+		return nil, apierr, err
+	}
+	ud := &UserData{}
+	if err = FillStruct(rs.Data, ud); err != nil {
+		return nil, nil, err
+	}
+	if ud.Data == nil {
+		ud.Data = map[string]interface{}{}
+	}
+	return ud.Data, nil, nil
+}
+
+// stringData formats user data values that aren't strings, such as numbers set through
+// Set, as strings
+func stringData(data map[string]interface{}) map[string]string {
+	resp := make(map[string]string, len(data))
+	for k, v := range data {
+		if s, ok := v.(string); ok {
+			resp[k] = s
+		} else {
+			resp[k] = fmt.Sprint(v)
+		}
+	}
+	return resp
+}
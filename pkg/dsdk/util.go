@@ -22,6 +22,20 @@ import (
 
 type ContextKey string
 
+// sdkCtxKey keys the values the SDK keeps in request contexts.  It's unexported so no
+// other package can collide with them
+type sdkCtxKey int
+
+const (
+	connCtxKey sdkCtxKey = iota
+	traceIDCtxKey
+	quietCtxKey
+	retryStatsCtxKey
+	limitAsTotalCtxKey
+	pageFuncCtxKey
+	tenantCtxKey
+)
+
 // No vowels so no accidental profanity :P
 const letterBytes = "bcdfghjklmnpqrstvwxyzBCDFGHJKLMNPQRSTVWXYZ"
 const (
@@ -54,6 +68,8 @@ func Log() *log.Entry {
 	return DecorateRuntimeContext(log.WithFields(log.Fields{}))
 }
 
+// WithUserFields adds the fields stored in ctx under UserLogFieldsCtxKey to l.
+// Connections add them to whatever Logger they use on their own
 func WithUserFields(ctx context.Context, l *log.Entry) *log.Entry {
 	userFields, ok := ctx.Value(UserLogFieldsCtxKey).(map[string]interface{})
 	if !ok {
@@ -62,6 +78,43 @@ func WithUserFields(ctx context.Context, l *log.Entry) *log.Entry {
 	return l.WithFields(log.Fields(userFields))
 }
 
+// WithRequestTenant returns a copy of ctx whose requests are made in tenant rather than
+// the connection's default tenant
+func WithRequestTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantCtxKey, tenant)
+}
+
+// WithTraceID returns a copy of ctx whose requests are logged with id as their trace_id,
+// so they can be correlated with the upstream request that caused them
+func WithTraceID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, traceIDCtxKey, id)
+}
+
+// traceIDFromContext returns the trace id of requests made with ctx
+func traceIDFromContext(ctx context.Context) (string, bool) {
+	if tid, ok := ctx.Value(traceIDCtxKey).(string); ok {
+		return tid, true
+	}
+	// contexts built by hand before the typed keys
+	tid, ok := ctx.Value("tid").(string)
+	return tid, ok
+}
+
+// WithQuiet returns a copy of ctx whose requests are logged without their request and
+// response payloads, for bulk or sensitive operations
+func WithQuiet(ctx context.Context) context.Context {
+	return context.WithValue(ctx, quietCtxKey, true)
+}
+
+// isQuiet reports whether payloads of requests made with ctx are kept out of the logs
+func isQuiet(ctx context.Context) bool {
+	if quiet, ok := ctx.Value(quietCtxKey).(bool); ok {
+		return quiet
+	}
+	quiet, _ := ctx.Value("quiet").(bool)
+	return quiet
+}
+
 // Args have the form "name=value"
 func parseTemplate(fstring string, args ...interface{}) (string, error) {
 	tpl, err := template.New("format").Parse(fstring)
@@ -330,7 +383,11 @@ func FillStruct(m map[string]interface{}, s interface{}) error {
 
 func GetConn(ctxt context.Context) *ApiConnection {
 	defer recoverConn()
-	conn := ctxt.Value("conn")
+	conn := ctxt.Value(connCtxKey)
+	if conn == nil {
+		// contexts built by hand before the typed keys
+		conn = ctxt.Value("conn")
+	}
 	return conn.(*ApiConnection)
 }
 
@@ -420,3 +477,25 @@ func formatQueryParams(gro *greq.RequestOptions, v reflect.Value, t reflect.Type
 	}
 	gro.Params = params
 }
+
+// runConcurrently calls fn with each index below n, with at most concurrency calls
+// running at once
+func runConcurrently(n, concurrency int, fn func(i int)) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
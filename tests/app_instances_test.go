@@ -0,0 +1,280 @@
+package dsdk_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	udc "github.com/Datera/go-udc/pkg/udc"
+	dsdk "github.com/tjcelaya/go-datera/pkg/dsdk"
+	"gopkg.in/h2non/gock.v1"
+)
+
+func TestAppInstancesClone(t *testing.T) {
+	defer gock.OffAll()
+	gock.New("http://127.0.0.1:7717").
+		Put("/v1/login").
+		Reply(200).
+		JSON(&dsdk.ApiLogin{Key: "thekey"})
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/app_instances/src").
+		Reply(200).
+		JSON(map[string]interface{}{"data": map[string]interface{}{
+			"name":            "src",
+			"path":            "/app_instances/src-uuid",
+			"uuid":            "src-uuid",
+			"descr":           "the source",
+			"op_state":        "available",
+			"create_time":     "2020-01-01T00:00:00Z",
+			"repair_priority": "high",
+			"storage_instances": []interface{}{map[string]interface{}{
+				"name":                "storage-1",
+				"path":                "/app_instances/src-uuid/storage_instances/storage-1",
+				"uuid":                "si-uuid",
+				"access_control_mode": "deny_all",
+				"active_initiators":   []string{"iqn.1993-08.org.debian:01:abcdef"},
+				"volumes": []interface{}{map[string]interface{}{
+					"name":          "volume-1",
+					"path":          "/app_instances/src-uuid/storage_instances/storage-1/volumes/volume-1",
+					"uuid":          "vol-uuid",
+					"size":          16,
+					"replica_count": 3,
+					"op_state":      "available",
+				}},
+			}},
+		}})
+
+	var created map[string]interface{}
+	gock.New("http://127.0.0.1:7717").
+		Post("/v1/app_instances").
+		AddMatcher(func(req *http.Request, _ *gock.Request) (bool, error) {
+			body, err := ioutil.ReadAll(req.Body)
+			if err != nil {
+				return false, err
+			}
+			return true, json.Unmarshal(body, &created)
+		}).
+		Reply(200).
+		JSON(map[string]interface{}{"data": map[string]interface{}{
+			"name": "copy",
+			"path": "/app_instances/copy-uuid",
+			"uuid": "copy-uuid",
+		}})
+
+	sdk, err := dsdk.NewSDK(&udc.UDC{
+		MgmtIp:     "127.0.0.1",
+		Username:   "foo",
+		Password:   "bar",
+		ApiVersion: "1",
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ai, aer, err := sdk.AppInstances.Clone(sdk.NewContext(), "src", "copy", &dsdk.AppInstanceCloneOptions{StorageInstances: true})
+	if aer != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	if ai.Name != "copy" || ai.Uuid != "copy-uuid" {
+		t.Errorf("expected the created instance, got %+v", ai)
+	}
+
+	if created["name"] != "copy" || created["descr"] != "the source" || created["repair_priority"] != "high" {
+		t.Errorf("expected the new name and the source's configuration, got %v", created)
+	}
+	raw, _ := json.Marshal(created)
+	for _, field := range []string{"uuid", "path", "op_state", "create_time", "active_initiators", "src-uuid"} {
+		if strings.Contains(string(raw), field) {
+			t.Errorf("expected %q to be stripped from %s", field, raw)
+		}
+	}
+	sis, _ := created["storage_instances"].([]interface{})
+	if len(sis) != 1 {
+		t.Fatalf("expected the storage instance to be cloned, got %s", raw)
+	}
+	vols, _ := sis[0].(map[string]interface{})["volumes"].([]interface{})
+	if len(vols) != 1 || vols[0].(map[string]interface{})["size"] != float64(16) {
+		t.Errorf("expected the volume configuration to be cloned, got %s", raw)
+	}
+}
+
+// mockOpState answers times GETs of the app instance named name with state
+func mockOpState(name, state string, times int) {
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/app_instances/" + name).
+		Times(times).
+		Reply(200).
+		JSON(map[string]interface{}{"data": map[string]interface{}{
+			"name":     name,
+			"path":     "/app_instances/" + name,
+			"op_state": state,
+		}})
+}
+
+func TestAppInstancesWaitForState(t *testing.T) {
+	defer gock.OffAll()
+	backoff := &constantBackoff{interval: 10 * time.Millisecond}
+	sdk := newTestSDK(t, dsdk.WithBackoffStrategy(backoff))
+	mockOpState("my-app", "offline", 3)
+	mockOpState("my-app", "available", 1)
+
+	ai, aer, err := sdk.AppInstances.WaitForState(sdk.NewContext(), "my-app", "available", 5*time.Second)
+	if aer != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	if ai.OpState != "available" {
+		t.Errorf("expected the available app instance, got %+v", ai)
+	}
+	if fmt.Sprint(backoff.attempts) != "[1 2 3]" {
+		t.Errorf("expected to back off between each of the 4 polls, got %v", backoff.attempts)
+	}
+	if !gock.IsDone() {
+		t.Errorf("unmatched requests: %v", gock.Pending())
+	}
+}
+
+func TestAppInstancesWaitForStateTimeout(t *testing.T) {
+	defer gock.OffAll()
+	sdk := newTestSDK(t, dsdk.WithBackoffStrategy(&constantBackoff{interval: 10 * time.Millisecond}))
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/app_instances/my-app").
+		Persist().
+		Reply(200).
+		JSON(map[string]interface{}{"data": map[string]interface{}{"name": "my-app", "op_state": "offline"}})
+
+	ai, aer, err := sdk.AppInstances.WaitForState(sdk.NewContext(), "my-app", "available", 100*time.Millisecond)
+	if aer != nil {
+		t.Fatalf("unexpected API error: %v", aer)
+	}
+	if !errors.Is(err, dsdk.ErrWaitTimeout) {
+		t.Errorf("expected %v, got %v", dsdk.ErrWaitTimeout, err)
+	}
+	if ai == nil || ai.OpState != "offline" {
+		t.Errorf("expected the last app instance seen, got %+v", ai)
+	}
+}
+
+func TestAppInstancesDeleteWhere(t *testing.T) {
+	defer gock.OffAll()
+	gock.CleanUnmatchedRequest()
+	sdk := newTestSDK(t)
+	ai := func(name, state string) map[string]interface{} {
+		return map[string]interface{}{"name": name, "path": "/app_instances/" + name, "admin_state": state}
+	}
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/app_instances").
+		MatchParam("filter", `^match\(name,test-\.\*\)$`).
+		Reply(200).
+		JSON(map[string]interface{}{"data": []interface{}{
+			ai("test-1", "online"),
+			ai("test-2", "offline"),
+			ai("test-3", "offline"),
+		}})
+	gock.New("http://127.0.0.1:7717").
+		Put("/v1/app_instances/test-1").
+		JSON(map[string]interface{}{"admin_state": "offline", "force": true}).
+		Reply(200).
+		JSON(map[string]interface{}{"data": ai("test-1", "offline")})
+	for _, name := range []string{"test-1", "test-2"} {
+		gock.New("http://127.0.0.1:7717").
+			Delete("/v1/app_instances/"+name).
+			MatchParam("force", "^true$").
+			JSON(map[string]interface{}{"force": true}).
+			Reply(200).
+			JSON(map[string]interface{}{"data": ai(name, "offline")})
+	}
+	gock.New("http://127.0.0.1:7717").
+		Delete("/v1/app_instances/test-3").
+		Reply(400).
+		JSON(dsdk.ApiErrorResponse{Name: "InvalidRequestError", Message: "in use", Http: 400})
+
+	deleted, aer, err := sdk.AppInstances.DeleteWhere(sdk.NewContext(), "match(name,test-.*)", 2)
+	if aer != nil {
+		t.Fatalf("unexpected API error: %v", aer)
+	}
+	sort.Strings(deleted)
+	if fmt.Sprint(deleted) != "[test-1 test-2]" {
+		t.Errorf("expected test-1 and test-2 to be deleted, got %v", deleted)
+	}
+	var bulk *dsdk.BulkError
+	if !errors.As(err, &bulk) || len(bulk.Errors) != 1 || !errors.Is(bulk.Errors["test-3"], dsdk.ErrInvalidRequest) {
+		t.Errorf("expected test-3 to fail, got %v", err)
+	}
+	if !gock.IsDone() {
+		t.Errorf("unmatched mocks: %v", gock.Pending())
+	}
+	if gock.HasUnmatchedRequest() {
+		t.Errorf("unexpected requests: %v", gock.GetUnmatchedRequests())
+	}
+}
+
+func TestAppInstancesDeleteWhereEmptyFilter(t *testing.T) {
+	defer gock.OffAll()
+	gock.CleanUnmatchedRequest()
+	sdk := newTestSDK(t)
+
+	_, _, err := sdk.AppInstances.DeleteWhere(sdk.NewContext(), "", 2)
+	if !errors.Is(err, dsdk.ErrInvalidRequest) {
+		t.Errorf("expected ErrInvalidRequest, got %v", err)
+	}
+	if gock.HasUnmatchedRequest() {
+		t.Errorf("unexpected requests: %v", gock.GetUnmatchedRequests())
+	}
+}
+
+func TestAppInstancesSetOnline(t *testing.T) {
+	tests := []struct {
+		name  string
+		state string
+		set   func(*dsdk.AppInstances, context.Context, string) (*dsdk.AppInstance, *dsdk.ApiErrorResponse, error)
+		from  string
+	}{
+		{"online", "online", (*dsdk.AppInstances).SetOnline, "offline"},
+		{"offline", "offline", (*dsdk.AppInstances).SetOffline, "online"},
+		{"already online", "online", (*dsdk.AppInstances).SetOnline, "online"},
+		{"already offline", "offline", (*dsdk.AppInstances).SetOffline, "offline"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer gock.OffAll()
+			gock.CleanUnmatchedRequest()
+			sdk := newTestSDK(t)
+			gock.New("http://127.0.0.1:7717").
+				Get("/v1/app_instances/my-app").
+				Reply(200).
+				JSON(map[string]interface{}{"data": map[string]interface{}{
+					"name": "my-app", "path": "/app_instances/my-app", "admin_state": tt.from,
+				}})
+			if tt.from != tt.state {
+				gock.New("http://127.0.0.1:7717").
+					Put("/v1/app_instances/my-app").
+					JSON(map[string]interface{}{"admin_state": tt.state}).
+					Reply(200).
+					JSON(map[string]interface{}{"data": map[string]interface{}{
+						"name": "my-app", "path": "/app_instances/my-app", "admin_state": tt.state,
+					}})
+			}
+
+			ai, aer, err := tt.set(sdk.AppInstances, sdk.NewContext(), "my-app")
+			if aer != nil || err != nil {
+				t.Fatalf("unexpected error: %v %v", aer, err)
+			}
+			if ai.AdminState != tt.state {
+				t.Errorf("expected the app instance to be %s, got %+v", tt.state, ai)
+			}
+			if !gock.IsDone() {
+				t.Errorf("unmatched mocks: %v", gock.Pending())
+			}
+			if gock.HasUnmatchedRequest() {
+				t.Errorf("unexpected requests: %v", gock.GetUnmatchedRequests())
+			}
+		})
+	}
+}
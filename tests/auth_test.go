@@ -0,0 +1,471 @@
+package dsdk_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	udc "github.com/Datera/go-udc/pkg/udc"
+	dsdk "github.com/tjcelaya/go-datera/pkg/dsdk"
+	"gopkg.in/h2non/gock.v1"
+)
+
+func TestAPIKeyAuthentication(t *testing.T) {
+	defer gock.OffAll()
+	// no login is mocked, so logging in shows up as an unmatched request
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/system").
+		MatchHeader("Auth-Token", "seeded").
+		Reply(200).
+		JSON(dsdk.ApiOuter{Data: map[string]interface{}{"name": "the system"}})
+
+	sdk, err := dsdk.NewSDK(&udc.UDC{
+		MgmtIp:     "127.0.0.1",
+		ApiVersion: "1",
+	}, false, dsdk.WithAPIKey("seeded"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sys, aer, err := sdk.System.Get(&dsdk.SystemGetRequest{Ctxt: sdk.NewContext()})
+	if err != nil || aer != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	if sys.Name != "the system" {
+		t.Errorf("unexpected system %+v", sys)
+	}
+	if gock.HasUnmatchedRequest() {
+		t.Error("received unexpected requests")
+	}
+}
+
+func TestAPIKeyRejectedWithoutCredentials(t *testing.T) {
+	defer gock.OffAll()
+	apiErr401 := &dsdk.ApiErrorResponse{Name: "AuthFailedError", Message: "invalid key", Http: dsdk.PermissionDenied}
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/system").
+		Reply(dsdk.PermissionDenied).
+		JSON(apiErr401)
+
+	sdk, err := dsdk.NewSDK(&udc.UDC{
+		MgmtIp:     "127.0.0.1",
+		ApiVersion: "1",
+	}, false, dsdk.WithAPIKey("expired"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, aer, err := sdk.System.Get(&dsdk.SystemGetRequest{Ctxt: sdk.NewContext()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aer == nil || aer.Http != dsdk.PermissionDenied {
+		t.Errorf("expected the 401 to be returned, got %+v", aer)
+	}
+	if gock.HasUnmatchedRequest() {
+		t.Error("attempted to log in without credentials")
+	}
+}
+
+func TestSetCredentials(t *testing.T) {
+	defer gock.OffAll()
+	gock.New("http://127.0.0.1:7717").
+		Put("/v1/login").
+		BodyString("password=old").
+		Reply(200).
+		JSON(&dsdk.ApiLogin{Key: "oldkey"})
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/system").
+		MatchHeader("Auth-Token", "oldkey").
+		Reply(200).
+		Delay(200 * time.Millisecond).
+		JSON(dsdk.ApiOuter{Data: map[string]interface{}{"name": "the system"}})
+	gock.New("http://127.0.0.1:7717").
+		Put("/v1/login").
+		BodyString("password=new").
+		Reply(200).
+		JSON(&dsdk.ApiLogin{Key: "newkey"})
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/system").
+		MatchHeader("Auth-Token", "newkey").
+		Reply(200).
+		JSON(dsdk.ApiOuter{Data: map[string]interface{}{"name": "the system"}})
+
+	sdk, err := dsdk.NewSDK(&udc.UDC{
+		MgmtIp:     "127.0.0.1",
+		Username:   "foo",
+		Password:   "old",
+		ApiVersion: "1",
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// rotate while the first request is waiting on its response
+	rotated := make(chan struct{})
+	time.AfterFunc(100*time.Millisecond, func() {
+		sdk.Conn.SetCredentials("foo", "new", "")
+		close(rotated)
+	})
+	if _, aer, err := sdk.System.Get(&dsdk.SystemGetRequest{Ctxt: sdk.NewContext()}); err != nil || aer != nil {
+		t.Fatalf("in flight request failed: %v %v", aer, err)
+	}
+	<-rotated
+	if _, aer, err := sdk.System.Get(&dsdk.SystemGetRequest{Ctxt: sdk.NewContext()}); err != nil || aer != nil {
+		t.Fatalf("request after rotation failed: %v %v", aer, err)
+	}
+	if gock.HasUnmatchedRequest() {
+		t.Error("received unexpected requests")
+	}
+	if !gock.IsDone() {
+		t.Error("expected a second login with the new password")
+	}
+}
+
+func TestSessionRefreshedBeforeTTL(t *testing.T) {
+	defer gock.OffAll()
+	gock.New("http://127.0.0.1:7717").
+		Put("/v1/login").
+		Reply(200).
+		JSON(&dsdk.ApiLogin{Key: "firstkey"})
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/system").
+		MatchHeader("Auth-Token", "firstkey").
+		Reply(200).
+		JSON(dsdk.ApiOuter{Data: map[string]interface{}{"name": "the system"}})
+	gock.New("http://127.0.0.1:7717").
+		Put("/v1/login").
+		Reply(200).
+		JSON(&dsdk.ApiLogin{Key: "secondkey"})
+	// no 401 is mocked, the refresh has to happen before the session expires
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/system").
+		MatchHeader("Auth-Token", "secondkey").
+		Reply(200).
+		JSON(dsdk.ApiOuter{Data: map[string]interface{}{"name": "the system"}})
+
+	sdk, err := dsdk.NewSDK(&udc.UDC{
+		MgmtIp:     "127.0.0.1",
+		Username:   "foo",
+		Password:   "bar",
+		ApiVersion: "1",
+	}, false, dsdk.WithSessionTTL(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, aer, err := sdk.System.Get(&dsdk.SystemGetRequest{Ctxt: sdk.NewContext()}); err != nil || aer != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	time.Sleep(950 * time.Millisecond)
+	if _, aer, err := sdk.System.Get(&dsdk.SystemGetRequest{Ctxt: sdk.NewContext()}); err != nil || aer != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	if gock.HasUnmatchedRequest() {
+		t.Error("received unexpected requests")
+	}
+	if !gock.IsDone() {
+		t.Error("expected the session to be refreshed")
+	}
+}
+
+func TestOnReauth(t *testing.T) {
+	defer gock.OffAll()
+	gock.New("http://127.0.0.1:7717").
+		Put("/v1/login").
+		Times(2).
+		Reply(200).
+		JSON(&dsdk.ApiLogin{Key: "thekey"})
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/system").
+		Reply(dsdk.PermissionDenied).
+		JSON(&dsdk.ApiErrorResponse{Name: "AuthFailedError", Message: "session expired", Http: dsdk.PermissionDenied})
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/system").
+		Reply(200).
+		JSON(dsdk.ApiOuter{Data: map[string]interface{}{"name": "the system"}})
+
+	var reasons []string
+	onReauth := func(reason string, err error) {
+		if err != nil {
+			t.Errorf("unexpected re-login error: %s", err)
+		}
+		reasons = append(reasons, reason)
+	}
+	sdk, err := dsdk.NewSDK(&udc.UDC{
+		MgmtIp:     "127.0.0.1",
+		Username:   "foo",
+		Password:   "bar",
+		ApiVersion: "1",
+	}, false, dsdk.WithOnReauth(onReauth))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, aer, err := sdk.System.Get(&dsdk.SystemGetRequest{Ctxt: sdk.NewContext()}); err != nil || aer != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	if len(reasons) != 1 {
+		t.Fatalf("expected OnReauth to be called once, got %d calls", len(reasons))
+	}
+	if reasons[0] != "GET /system was denied" {
+		t.Errorf("unexpected reason %q", reasons[0])
+	}
+}
+
+func TestOnReauthFailure(t *testing.T) {
+	defer gock.OffAll()
+	apiErr401 := &dsdk.ApiErrorResponse{Name: "AuthFailedError", Message: "bad password", Http: dsdk.PermissionDenied}
+	gock.New("http://127.0.0.1:7717").
+		Put("/v1/login").
+		Reply(200).
+		JSON(&dsdk.ApiLogin{Key: "thekey"})
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/system").
+		Reply(dsdk.PermissionDenied).
+		JSON(apiErr401)
+	gock.New("http://127.0.0.1:7717").
+		Put("/v1/login").
+		Reply(dsdk.PermissionDenied).
+		JSON(apiErr401)
+
+	var errs []error
+	sdk, err := dsdk.NewSDK(&udc.UDC{
+		MgmtIp:     "127.0.0.1",
+		Username:   "foo",
+		Password:   "bar",
+		ApiVersion: "1",
+	}, false, dsdk.WithOnReauth(func(reason string, err error) { errs = append(errs, err) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sdk.System.Get(&dsdk.SystemGetRequest{Ctxt: sdk.NewContext()})
+	if len(errs) != 1 || errs[0] == nil {
+		t.Errorf("expected OnReauth to be called once with the login failure, got %v", errs)
+	}
+}
+
+func TestIsLoggedIn(t *testing.T) {
+	defer gock.OffAll()
+	gock.New("http://127.0.0.1:7717").
+		Put("/v1/login").
+		Reply(200).
+		JSON(&dsdk.ApiLogin{Key: "thekey"})
+
+	conn := dsdk.NewApiConnection(&udc.UDC{
+		MgmtIp:     "127.0.0.1",
+		Username:   "foo",
+		Password:   "bar",
+		ApiVersion: "1",
+	}, false)
+	if conn.IsLoggedIn() {
+		t.Error("expected a new connection not to be logged in")
+	}
+	if aer, err := conn.Login(context.Background()); err != nil || aer != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	if !conn.IsLoggedIn() {
+		t.Error("expected the connection to be logged in after Login")
+	}
+	conn.Logout()
+	if conn.IsLoggedIn() {
+		t.Error("expected the connection not to be logged in after Logout")
+	}
+}
+
+func TestExportAndRestoreSession(t *testing.T) {
+	defer gock.OffAll()
+	gock.New("http://127.0.0.1:7717").
+		Put("/v1/login").
+		Reply(200).
+		JSON(&dsdk.ApiLogin{Key: "exported"})
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/system").
+		MatchHeader("Auth-Token", "exported").
+		Reply(200).
+		JSON(dsdk.ApiOuter{Data: map[string]interface{}{"name": "the system"}})
+
+	cfg := &udc.UDC{
+		MgmtIp:     "127.0.0.1",
+		Username:   "foo",
+		Password:   "bar",
+		ApiVersion: "1",
+	}
+	first := dsdk.NewApiConnection(cfg, false, dsdk.WithSessionTTL(time.Hour))
+	if aer, err := first.Login(context.Background()); err != nil || aer != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	token, expiry := first.ExportSession()
+	if token != "exported" {
+		t.Errorf("unexpected token %q", token)
+	}
+	if until := time.Until(expiry); until <= 0 || until > time.Hour {
+		t.Errorf("expected the session to expire within the hour, got %s", expiry)
+	}
+
+	// the login mock was consumed, so logging in again shows up as an unmatched request
+	second, err := dsdk.NewSDK(cfg, false, dsdk.WithSession(token, expiry))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, aer, err := second.System.Get(&dsdk.SystemGetRequest{Ctxt: second.NewContext()}); err != nil || aer != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	if gock.HasUnmatchedRequest() {
+		t.Error("the restored session logged in again")
+	}
+}
+
+func TestRestoredSessionReauthenticates(t *testing.T) {
+	defer gock.OffAll()
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/system").
+		MatchHeader("Auth-Token", "stale").
+		Reply(dsdk.PermissionDenied).
+		JSON(&dsdk.ApiErrorResponse{Name: "AuthFailedError", Message: "session expired", Http: dsdk.PermissionDenied})
+	gock.New("http://127.0.0.1:7717").
+		Put("/v1/login").
+		Reply(200).
+		JSON(&dsdk.ApiLogin{Key: "fresh"})
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/system").
+		MatchHeader("Auth-Token", "fresh").
+		Reply(200).
+		JSON(dsdk.ApiOuter{Data: map[string]interface{}{"name": "the system"}})
+
+	sdk, err := dsdk.NewSDK(&udc.UDC{
+		MgmtIp:     "127.0.0.1",
+		Username:   "foo",
+		Password:   "bar",
+		ApiVersion: "1",
+	}, false, dsdk.WithSession("stale", time.Time{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, aer, err := sdk.System.Get(&dsdk.SystemGetRequest{Ctxt: sdk.NewContext()}); err != nil || aer != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	if !gock.IsDone() {
+		t.Error("expected the rejected session to be replaced by a new login")
+	}
+}
+
+// countLogins counts the login requests sent until the returned function is called
+func countLogins() (*int32, func()) {
+	var logins int32
+	gock.Observe(func(req *http.Request, mock gock.Mock) {
+		if req.URL.Path == "/v1/login" {
+			atomic.AddInt32(&logins, 1)
+		}
+	})
+	return &logins, func() { gock.Observe(nil) }
+}
+
+// getSystemConcurrently makes n concurrent system requests and returns the first failure
+func getSystemConcurrently(sdk *dsdk.SDK, n int) error {
+	errs := make(chan error, n)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, aer, err := sdk.System.Get(&dsdk.SystemGetRequest{Ctxt: sdk.NewContext()})
+			if aer != nil {
+				err = fmt.Errorf("%s", dsdk.Pretty(aer))
+			}
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestConcurrentLoginsCoalesced(t *testing.T) {
+	defer gock.OffAll()
+	logins, stop := countLogins()
+	defer stop()
+	gock.New("http://127.0.0.1:7717").
+		Put("/v1/login").
+		Persist().
+		Reply(200).
+		Delay(100 * time.Millisecond).
+		JSON(&dsdk.ApiLogin{Key: "thekey"})
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/system").
+		Persist().
+		Reply(200).
+		JSON(dsdk.ApiOuter{Data: map[string]interface{}{"name": "the system"}})
+
+	sdk, err := dsdk.NewSDK(&udc.UDC{
+		MgmtIp:     "127.0.0.1",
+		Username:   "foo",
+		Password:   "bar",
+		ApiVersion: "1",
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := getSystemConcurrently(sdk, 50); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(logins); n != 1 {
+		t.Errorf("expected exactly 1 login, got %d", n)
+	}
+}
+
+func TestConcurrentReloginsCoalesced(t *testing.T) {
+	defer gock.OffAll()
+	logins, stop := countLogins()
+	defer stop()
+	gock.New("http://127.0.0.1:7717").
+		Put("/v1/login").
+		Reply(200).
+		JSON(&dsdk.ApiLogin{Key: "expired"})
+	gock.New("http://127.0.0.1:7717").
+		Put("/v1/login").
+		Persist().
+		Reply(200).
+		Delay(100 * time.Millisecond).
+		JSON(&dsdk.ApiLogin{Key: "fresh"})
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/system").
+		MatchHeader("Auth-Token", "expired").
+		Persist().
+		Reply(dsdk.PermissionDenied).
+		JSON(&dsdk.ApiErrorResponse{Name: "AuthFailedError", Message: "session expired", Http: dsdk.PermissionDenied})
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/system").
+		MatchHeader("Auth-Token", "fresh").
+		Persist().
+		Reply(200).
+		JSON(dsdk.ApiOuter{Data: map[string]interface{}{"name": "the system"}})
+
+	sdk, err := dsdk.NewSDK(&udc.UDC{
+		MgmtIp:     "127.0.0.1",
+		Username:   "foo",
+		Password:   "bar",
+		ApiVersion: "1",
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aer, err := sdk.Conn.Login(context.Background()); err != nil || aer != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	// every request is rejected with the expired session, but only one re-login happens
+	if err := getSystemConcurrently(sdk, 50); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(logins); n != 2 {
+		t.Errorf("expected the initial login and a single re-login, got %d logins", n)
+	}
+}
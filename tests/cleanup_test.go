@@ -0,0 +1,154 @@
+package dsdk_test
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	dsdk "github.com/tjcelaya/go-datera/pkg/dsdk"
+	"gopkg.in/h2non/gock.v1"
+)
+
+// mockTenantResources serves the listings of tenant /root/t1, which sees an initiator of
+// root as well as its own
+func mockTenantResources() {
+	list := func(path string, data []map[string]interface{}) {
+		gock.New("http://127.0.0.1:7717").
+			Get("/v1/"+path+"$").
+			MatchHeader("tenant", "^/root/t1$").
+			Reply(200).
+			JSON(map[string]interface{}{"data": data})
+	}
+	list("app_instances", []map[string]interface{}{{
+		"path":        "/app_instances/ai-1",
+		"name":        "ai-1",
+		"admin_state": "online",
+		"storage_instances": []map[string]interface{}{
+			{"path": "/app_instances/ai-1/storage_instances/si-1", "name": "si-1"},
+		},
+	}})
+	list("app_templates", []map[string]interface{}{{"path": "/app_templates/at-1", "name": "at-1"}})
+	list("initiator_groups", []map[string]interface{}{{"path": "/initiator_groups/ig-1", "name": "ig-1"}})
+	list("initiators", []map[string]interface{}{
+		{"path": "/initiators/iqn.1993-08.org.debian:01:t1", "id": "iqn.1993-08.org.debian:01:t1", "tenant": "/root/t1"},
+		{"path": "/initiators/iqn.1993-08.org.debian:01:root", "id": "iqn.1993-08.org.debian:01:root", "tenant": "/root"},
+	})
+}
+
+// observeMethods records the method of every request made after it's called
+func observeMethods() func() []string {
+	var (
+		m       sync.Mutex
+		methods []string
+	)
+	gock.Observe(func(req *http.Request, _ gock.Mock) {
+		m.Lock()
+		defer m.Unlock()
+		methods = append(methods, req.Method+" "+req.URL.Path)
+	})
+	return func() []string {
+		m.Lock()
+		defer m.Unlock()
+		return append([]string(nil), methods...)
+	}
+}
+
+func TestCleanup(t *testing.T) {
+	defer gock.OffAll()
+	sdk := newTestSDKInTenant(t, "/root/t1")
+	mockTenantResources()
+	gock.New("http://127.0.0.1:7717").
+		Put("/v1/app_instances/ai-1$").
+		MatchHeader("tenant", "^/root/t1$").
+		JSON(map[string]interface{}{"admin_state": "offline", "force": true}).
+		Reply(200).
+		JSON(map[string]interface{}{"data": map[string]interface{}{"path": "/app_instances/ai-1", "admin_state": "offline"}})
+	// storage instances, app instances and app templates are deleted with force
+	for _, path := range []string{
+		"app_instances/ai-1/storage_instances/si-1",
+		"app_instances/ai-1",
+		"app_templates/at-1",
+	} {
+		gock.New("http://127.0.0.1:7717").
+			Delete("/v1/"+path+"$").
+			MatchHeader("tenant", "^/root/t1$").
+			MatchParam("force", "^true$").
+			JSON(map[string]interface{}{"force": true}).
+			Reply(200).
+			JSON(map[string]interface{}{"data": map[string]interface{}{"path": "/" + path}})
+	}
+	for _, path := range []string{
+		"initiator_groups/ig-1",
+		"initiators/iqn.1993-08.org.debian:01:t1",
+	} {
+		gock.New("http://127.0.0.1:7717").
+			Delete("/v1/"+path+"$").
+			MatchHeader("tenant", "^/root/t1$").
+			Reply(200).
+			JSON(map[string]interface{}{"data": map[string]interface{}{"path": "/" + path}})
+	}
+	defer gock.Observe(nil)
+	methods := observeMethods()
+
+	// a tenant on the context doesn't move the cleanup out of the configured tenant
+	deleted, apierr, err := sdk.Cleanup(dsdk.WithRequestTenant(sdk.NewContext(), "/root/other"), nil)
+	if apierr != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", apierr, err)
+	}
+	expected := []string{
+		"/app_instances/ai-1/storage_instances/si-1",
+		"/app_instances/ai-1",
+		"/app_templates/at-1",
+		"/initiator_groups/ig-1",
+		"/initiators/iqn.1993-08.org.debian:01:t1",
+	}
+	if !reflect.DeepEqual(deleted, expected) {
+		t.Errorf("expected %v deleted, got %v", expected, deleted)
+	}
+	for _, m := range methods() {
+		if m == "DELETE /v1/initiators/iqn.1993-08.org.debian:01:root" {
+			t.Errorf("the root tenant's initiator was deleted")
+		}
+	}
+	if !gock.IsDone() {
+		t.Errorf("pending mocks: %v", gock.Pending())
+	}
+}
+
+func TestCleanupDryRun(t *testing.T) {
+	defer gock.OffAll()
+	sdk := newTestSDKInTenant(t, "/root/t1")
+	mockTenantResources()
+	defer gock.Observe(nil)
+	methods := observeMethods()
+
+	deleted, apierr, err := sdk.Cleanup(sdk.NewContext(), &dsdk.CleanupOptions{DryRun: true})
+	if apierr != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", apierr, err)
+	}
+	if len(deleted) != 5 {
+		t.Errorf("expected 5 paths to be listed, got %v", deleted)
+	}
+	for _, m := range methods() {
+		if !strings.HasPrefix(m, "GET ") && m != "PUT /v1/login" {
+			t.Errorf("dry run made request %s", m)
+		}
+	}
+	if !gock.IsDone() {
+		t.Errorf("pending mocks: %v", gock.Pending())
+	}
+}
+
+func TestCleanupRootTenant(t *testing.T) {
+	defer gock.OffAll()
+	for _, tenant := range []string{"", "/root", "root"} {
+		sdk := newTestSDKInTenant(t, tenant)
+		_, _, err := sdk.Cleanup(sdk.NewContext(), nil)
+		if !errors.Is(err, dsdk.ErrInvalidRequest) {
+			t.Errorf("expected ErrInvalidRequest cleaning tenant %q, got %v", tenant, err)
+		}
+	}
+}
@@ -2,14 +2,20 @@ package dsdk_test
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	udc "github.com/Datera/go-udc/pkg/udc"
 	greq "github.com/levigross/grequests"
 	"github.com/sirupsen/logrus"
 	dsdk "github.com/tjcelaya/go-datera/pkg/dsdk"
+	"gopkg.in/h2non/gock.v1"
 )
 
 func init() {
@@ -95,3 +101,121 @@ func TestCreateAi(t *testing.T) {
 		t.Errorf("%s", err)
 	}
 }
+
+func TestDoRaw(t *testing.T) {
+	defer gock.OffAll()
+	gock.New("http://127.0.0.1:7717").
+		Put("/v1/login").
+		Reply(200).
+		JSON(&dsdk.ApiLogin{Key: "thekey"})
+	csv := "time,read_iops\n1600000000,42\n1600000060,{not json\n"
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/metrics/io/export").
+		MatchHeader("Auth-Token", "^thekey$").
+		Reply(200).
+		SetHeader("Content-Type", "text/csv").
+		BodyString(csv)
+	sdk, err := dsdk.NewSDK(&udc.UDC{
+		MgmtIp:     "127.0.0.1",
+		Username:   "foo",
+		Password:   "bar",
+		ApiVersion: "1",
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, aer, err := sdk.Conn.DoRaw(sdk.NewContext(), "GET", "metrics/io/export", nil)
+	if aer != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	if string(body) != csv {
+		t.Errorf("expected the body verbatim, got %q", body)
+	}
+}
+
+func TestDownload(t *testing.T) {
+	defer gock.OffAll()
+	bundle := strings.Repeat("support bundle contents\n", 4096)
+	sum := sha256.Sum256([]byte(bundle))
+	dir, err := ioutil.TempDir("", "dsdk-download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name     string
+		checksum string
+		existing string
+		wantErr  bool
+	}{
+		{"verified", hex.EncodeToString(sum[:]), "", false},
+		{"no checksum", "", "", false},
+		{"replaces existing", hex.EncodeToString(sum[:]), "previous bundle", false},
+		{"mismatch", strings.Repeat("0", 64), "", true},
+		{"mismatch keeps existing", strings.Repeat("0", 64), "previous bundle", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gock.New("http://127.0.0.1:7717").
+				Put("/v1/login").
+				Reply(200).
+				JSON(&dsdk.ApiLogin{Key: "thekey"})
+			reply := gock.New("http://127.0.0.1:7717").
+				Get("/v1/logs_upload/bundle").
+				MatchHeader("Auth-Token", "^thekey$").
+				Reply(200).
+				BodyString(bundle)
+			if tt.checksum != "" {
+				reply.SetHeader(dsdk.ChecksumHeader, tt.checksum)
+			}
+			sdk, err := dsdk.NewSDK(&udc.UDC{
+				MgmtIp:     "127.0.0.1",
+				Username:   "foo",
+				Password:   "bar",
+				ApiVersion: "1",
+			}, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			dest := filepath.Join(dir, tt.name)
+			if tt.existing != "" {
+				if err := ioutil.WriteFile(dest, []byte(tt.existing), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			aer, err := sdk.Conn.Download(sdk.NewContext(), "logs_upload/bundle", dest, nil)
+			if aer != nil {
+				t.Fatalf("unexpected API error: %v", aer)
+			}
+			if matches, _ := filepath.Glob(filepath.Join(dir, ".*")); len(matches) != 0 {
+				t.Errorf("temporary files left behind: %v", matches)
+			}
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected a checksum mismatch")
+				}
+				got, rerr := ioutil.ReadFile(dest)
+				if tt.existing == "" && !os.IsNotExist(rerr) {
+					t.Errorf("expected nothing at dest, got %v", rerr)
+				}
+				if tt.existing != "" && string(got) != tt.existing {
+					t.Errorf("expected the existing file to be kept, got %q %v", got, rerr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := ioutil.ReadFile(dest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if gotSum := sha256.Sum256(got); string(got) != bundle || gotSum != sum {
+				t.Errorf("downloaded %d bytes that don't match the %d served", len(got), len(bundle))
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package dsdk_test
+
+import (
+	"context"
+	"testing"
+
+	greq "github.com/levigross/grequests"
+	dsdk "github.com/tjcelaya/go-datera/pkg/dsdk"
+	"gopkg.in/h2non/gock.v1"
+)
+
+func TestContextKeysDontCollide(t *testing.T) {
+	defer gock.OffAll()
+	sdk := newTestSDK(t)
+
+	// another package storing its own value under the same string
+	ctxt := context.WithValue(sdk.NewContext(), "conn", "someone else's connection")
+	if conn := dsdk.GetConn(ctxt); conn != sdk.Conn {
+		t.Errorf("expected the SDK's connection, got %v", conn)
+	}
+	if v := ctxt.Value("conn"); v != "someone else's connection" {
+		t.Errorf("expected the other package's value to be untouched, got %v", v)
+	}
+}
+
+func TestGetConnLegacyKey(t *testing.T) {
+	defer gock.OffAll()
+	sdk := newTestSDK(t)
+
+	ctxt := context.WithValue(context.Background(), "conn", sdk.Conn)
+	if conn := dsdk.GetConn(ctxt); conn != sdk.Conn {
+		t.Errorf("expected contexts built with the old string key to keep working, got %v", conn)
+	}
+}
+
+func TestContextKeysCantBeForged(t *testing.T) {
+	defer gock.OffAll()
+	mockCollection("/v1/initiators", 3, 2)
+	sdk := newTestSDK(t)
+
+	// values stored under the exported key type with the names the SDK used to use
+	called := false
+	ctxt := context.WithValue(sdk.NewContext(), dsdk.ContextKey("page_func"), dsdk.PageFunc(func(*dsdk.ApiListOuter) error {
+		called = true
+		return nil
+	}))
+	stats := &dsdk.RetryStats{}
+	ctxt = context.WithValue(ctxt, dsdk.ContextKey("retry_stats"), stats)
+	ctxt = context.WithValue(ctxt, dsdk.ContextKey("limit_as_total"), true)
+	rs, aer, err := sdk.Conn.GetList(ctxt, "initiators", &greq.RequestOptions{Params: map[string]string{"limit": "2"}})
+	if aer != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	if called || stats.Attempts != 0 {
+		t.Errorf("expected forged page func and retry stats to be ignored, called %v, stats %+v", called, stats)
+	}
+	if len(rs.Data) != 2 {
+		t.Errorf("expected a forged limit as total to be ignored and a single page, got %d items", len(rs.Data))
+	}
+}
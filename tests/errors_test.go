@@ -0,0 +1,294 @@
+package dsdk_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	udc "github.com/Datera/go-udc/pkg/udc"
+	dsdk "github.com/tjcelaya/go-datera/pkg/dsdk"
+	"gopkg.in/h2non/gock.v1"
+)
+
+func TestApiErrorResponseIsError(t *testing.T) {
+	apierr := &dsdk.ApiErrorResponse{
+		Name:    "NotFoundError",
+		Code:    1234,
+		Http:    404,
+		Message: "app_instance not found",
+		Op:      "GET",
+		Path:    "/v2.2/app_instances/my-app",
+		Errors:  []string{"no such app_instance", "check the name"},
+	}
+	msg := apierr.Error()
+	for _, want := range []string{"NotFoundError", "app_instance not found", "1234", "404", "GET", "/v2.2/app_instances/my-app", "no such app_instance", "check the name"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("expected %q in %q", want, msg)
+		}
+	}
+
+	var err error = fmt.Errorf("listing app instances: %w", apierr)
+	var target *dsdk.ApiErrorResponse
+	if !errors.As(err, &target) || target != apierr {
+		t.Errorf("expected errors.As to recover the ApiErrorResponse, got %v", target)
+	}
+}
+
+func TestStatusSentinels(t *testing.T) {
+	noRetries := dsdk.WithRetryableStatuses()
+	testCases := []struct {
+		desc string
+		mock func()
+		opts []dsdk.ApiConnectionOption
+		// apiKeyOnly leaves the UDC without credentials so a 401 isn't retried
+		apiKeyOnly bool
+		target     error
+	}{
+		{
+			desc: "invalid request",
+			mock: func() {
+				gock.New("http://127.0.0.1:7717").Get("/v1/system").Reply(400).JSON(dsdk.ApiErrorResponse{Http: 400})
+			},
+			target: dsdk.ErrInvalidRequest,
+		},
+		{
+			desc: "conflict",
+			mock: func() {
+				gock.New("http://127.0.0.1:7717").Get("/v1/system").Reply(409).JSON(dsdk.ApiErrorResponse{Http: 409})
+			},
+			target: dsdk.ErrConflict,
+		},
+		{
+			desc: "permission denied",
+			mock: func() {
+				gock.New("http://127.0.0.1:7717").Get("/v1/system").Reply(401).JSON(dsdk.ApiErrorResponse{Http: 401})
+			},
+			opts:       []dsdk.ApiConnectionOption{dsdk.WithAPIKey("stale")},
+			apiKeyOnly: true,
+			target:     dsdk.ErrPermissionDenied,
+		},
+		{
+			desc: "too many requests",
+			mock: func() {
+				gock.New("http://127.0.0.1:7717").Get("/v1/system").Reply(429).JSON(dsdk.ApiErrorResponse{Http: 429})
+			},
+			opts:   []dsdk.ApiConnectionOption{noRetries},
+			target: dsdk.ErrTooManyRequests,
+		},
+		{
+			desc: "service unavailable",
+			mock: func() {
+				gock.New("http://127.0.0.1:7717").Get("/v1/system").Reply(503).JSON(dsdk.ApiErrorResponse{Http: 503})
+			},
+			opts:   []dsdk.ApiConnectionOption{noRetries},
+			target: dsdk.ErrServiceUnavailable,
+		},
+		{
+			desc: "connection error",
+			mock: func() {
+				gock.New("http://127.0.0.1:7717").Get("/v1/system").ReplyError(errors.New("connect: connection refused"))
+			},
+			opts:   []dsdk.ApiConnectionOption{noRetries},
+			target: dsdk.ErrConnectionError,
+		},
+		{
+			desc: "retry timeout",
+			mock: func() {
+				gock.New("http://127.0.0.1:7717").Get("/v1/system").Persist().Reply(503).JSON(dsdk.ApiErrorResponse{Http: 503})
+			},
+			opts: []dsdk.ApiConnectionOption{
+				dsdk.WithRetryTimeout(50 * time.Millisecond),
+				dsdk.WithBackoffStrategy(&constantBackoff{interval: 10 * time.Millisecond}),
+			},
+			target: dsdk.ErrRetryTimeout,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			defer gock.OffAll()
+			gock.New("http://127.0.0.1:7717").
+				Put("/v1/login").
+				Reply(200).
+				JSON(&dsdk.ApiLogin{Key: "thekey"})
+			tC.mock()
+			conf := &udc.UDC{MgmtIp: "127.0.0.1", ApiVersion: "1"}
+			if !tC.apiKeyOnly {
+				conf.Username, conf.Password = "foo", "bar"
+			}
+			sdk, err := dsdk.NewSDK(conf, false, tC.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, aer, err := sdk.System.Get(&dsdk.SystemGetRequest{Ctxt: sdk.NewContext()})
+			if !errors.Is(err, tC.target) && !(aer != nil && errors.Is(aer, tC.target)) {
+				t.Errorf("expected %v to match, got %v %v", tC.target, aer, err)
+			}
+			if aer != nil && tC.target != dsdk.ErrPermissionDenied && errors.Is(aer, dsdk.ErrPermissionDenied) {
+				t.Errorf("expected %v not to match %v", aer, dsdk.ErrPermissionDenied)
+			}
+		})
+	}
+}
+
+func TestRetryTimeoutKeepsStatus(t *testing.T) {
+	defer gock.OffAll()
+	mockAlways503("http://127.0.0.1:7717")
+	sdk, err := dsdk.NewSDK(&udc.UDC{
+		MgmtIp:     "127.0.0.1",
+		Username:   "foo",
+		Password:   "bar",
+		ApiVersion: "1",
+	}, false,
+		dsdk.WithRetryTimeout(50*time.Millisecond),
+		dsdk.WithBackoffStrategy(&constantBackoff{interval: 10 * time.Millisecond}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, aer, err := sdk.System.Get(&dsdk.SystemGetRequest{Ctxt: sdk.NewContext()})
+	if !errors.Is(err, dsdk.ErrRetryTimeout) || !errors.Is(aer, dsdk.ErrServiceUnavailable) {
+		t.Errorf("expected a retry timeout after 503s, got %v %v", aer, err)
+	}
+}
+
+func TestIsNotFound(t *testing.T) {
+	defer gock.OffAll()
+	gock.New("http://127.0.0.1:7717").
+		Put("/v1/login").
+		Reply(200).
+		JSON(&dsdk.ApiLogin{Key: "thekey"})
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/app_instances/gone").
+		Reply(404).
+		JSON(dsdk.ApiErrorResponse{Name: "NotFoundError", Http: 404, Message: "app_instance gone not found"})
+	sdk, err := dsdk.NewSDK(&udc.UDC{
+		MgmtIp:     "127.0.0.1",
+		Username:   "foo",
+		Password:   "bar",
+		ApiVersion: "1",
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, aer, err := sdk.Conn.Get(sdk.NewContext(), "app_instances/gone", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !dsdk.IsNotFound(aer) {
+		t.Errorf("expected %v to be not found", aer)
+	}
+	if !dsdk.IsNotFound(fmt.Errorf("deleting app instance: %w", aer)) {
+		t.Error("expected a wrapped not found response to be not found")
+	}
+	if dsdk.IsNotFound(dsdk.ErrPermissionDenied) || dsdk.IsNotFound(nil) {
+		t.Error("expected other errors not to be not found")
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	testCases := []struct {
+		desc      string
+		err       error
+		retryable bool
+	}{
+		{"invalid request", &dsdk.ApiErrorResponse{Http: 400}, false},
+		{"permission denied", &dsdk.ApiErrorResponse{Http: 401}, false},
+		{"not found", &dsdk.ApiErrorResponse{Http: 404}, false},
+		{"too many requests", &dsdk.ApiErrorResponse{Http: 429}, true},
+		{"internal error", &dsdk.ApiErrorResponse{Http: 500}, false},
+		{"service unavailable", &dsdk.ApiErrorResponse{Http: 503}, true},
+		{"wrapped service unavailable", fmt.Errorf("creating volume: %w", &dsdk.ApiErrorResponse{Http: 503}), true},
+		{"connection error", dsdk.ErrConnectionError, true},
+		{"connection refused", errors.New("dial tcp 127.0.0.1:7717: connect: connection refused"), true},
+		{"permission denied sentinel", dsdk.ErrPermissionDenied, false},
+		{"other error", errors.New("boom"), false},
+		{"nil", nil, false},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			if got := dsdk.IsRetryable(tC.err); got != tC.retryable {
+				t.Errorf("expected IsRetryable(%v) to be %v", tC.err, tC.retryable)
+			}
+		})
+	}
+}
+
+func TestUnmarshalError(t *testing.T) {
+	defer gock.OffAll()
+	gock.New("http://127.0.0.1:7717").
+		Put("/v1/login").
+		Reply(200).
+		JSON(&dsdk.ApiLogin{Key: "thekey"})
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/system").
+		Reply(200).
+		BodyString("<html><body>502 Bad Gateway</body></html>")
+	sdk, err := dsdk.NewSDK(&udc.UDC{
+		MgmtIp:     "127.0.0.1",
+		Username:   "foo",
+		Password:   "bar",
+		ApiVersion: "1",
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, aer, err := sdk.Conn.Get(sdk.NewContext(), "system", nil)
+	if aer != nil {
+		t.Fatalf("unexpected api error: %v", aer)
+	}
+	var uerr *dsdk.UnmarshalError
+	if !errors.As(err, &uerr) {
+		t.Fatalf("expected an UnmarshalError, got %v", err)
+	}
+	if string(uerr.Body) != "<html><body>502 Bad Gateway</body></html>" || uerr.Status != 200 || uerr.Route != "/v1/system" {
+		t.Errorf("unexpected error details: %d %s %q", uerr.Status, uerr.Route, uerr.Body)
+	}
+	if uerr.Err == nil || errors.Unwrap(err) != uerr.Err {
+		t.Errorf("expected the decoding error to be wrapped, got %v", uerr.Err)
+	}
+}
+
+func TestHealthCheckErrorIncludesErrors(t *testing.T) {
+	defer gock.OffAll()
+	gock.New("http://127.0.0.1:7717").
+		Put("/v1/login").
+		Reply(200).
+		JSON(&dsdk.ApiLogin{Key: "thekey"})
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/storage_nodes").
+		Reply(400).
+		JSON(dsdk.ApiErrorResponse{
+			Name:    "ValidationFailedError",
+			Http:    400,
+			Message: "invalid request",
+			Errors:  []string{"limit must be positive", "sort field unknown", "filter is malformed"},
+		})
+	sdk, err := dsdk.NewSDK(&udc.UDC{
+		MgmtIp:     "127.0.0.1",
+		Username:   "foo",
+		Password:   "bar",
+		ApiVersion: "1",
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = sdk.HealthCheck()
+	if err == nil {
+		t.Fatal("expected the health check to fail")
+	}
+	for _, want := range []string{"ValidationFailedError", "limit must be positive", "sort field unknown", "filter is malformed"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q in %q", want, err.Error())
+		}
+	}
+	var apierr *dsdk.ApiErrorResponse
+	if !errors.As(err, &apierr) || len(apierr.Errors) != 3 {
+		t.Errorf("expected the structured errors to be kept, got %v", apierr)
+	}
+}
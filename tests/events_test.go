@@ -0,0 +1,238 @@
+package dsdk_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	dsdk "github.com/tjcelaya/go-datera/pkg/dsdk"
+	"gopkg.in/h2non/gock.v1"
+)
+
+func subscribeEvent(uuid, ts string) map[string]interface{} {
+	return map[string]interface{}{"uuid": uuid, "time": ts, "message": "event " + uuid}
+}
+
+// mockEventPolls expects polls for the events since 1600000001, the first listing e1
+// and e2, the second e2 and e3 and the rest just e3
+func mockEventPolls() {
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/events/system").
+		MatchParam("since", "^1600000001$").
+		Reply(200).
+		JSON(map[string]interface{}{"data": []interface{}{
+			subscribeEvent("e1", "1600000001"),
+			subscribeEvent("e2", "1600000002"),
+		}})
+	// the next poll starts from the last event delivered, so lists it again
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/events/system").
+		MatchParam("since", "^1600000002$").
+		Reply(200).
+		JSON(map[string]interface{}{"data": []interface{}{
+			subscribeEvent("e2", "1600000002"),
+			subscribeEvent("e3", "1600000003"),
+		}})
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/events/system").
+		MatchParam("since", "^1600000003$").
+		Persist().
+		Reply(200).
+		JSON(map[string]interface{}{"data": []interface{}{subscribeEvent("e3", "1600000003")}})
+}
+
+// collectEvents reads n events from events, then cancels and drains it
+func collectEvents(t *testing.T, events <-chan *dsdk.SystemEvent, cancel func(), n int) []string {
+	got := []string{}
+	timeout := time.After(5 * time.Second)
+	for len(got) < n {
+		select {
+		case ev := <-events:
+			got = append(got, ev.Uuid)
+		case <-timeout:
+			t.Fatalf("timed out waiting for events, got %v", got)
+		}
+	}
+	// let a few more polls happen, none of which have anything new
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	for ev := range events {
+		got = append(got, ev.Uuid)
+	}
+	return got
+}
+
+func TestSystemEventsSubscribe(t *testing.T) {
+	defer gock.OffAll()
+	// without a since, subscribing starts from the latest event rather than the history
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/events/system").
+		MatchParam("sort", "^-time$").
+		MatchParam("limit", "^1$").
+		Reply(200).
+		JSON(map[string]interface{}{"data": []interface{}{subscribeEvent("e1", "1600000001")}})
+	mockEventPolls()
+	sdk := newTestSDK(t)
+
+	ctxt, cancel := context.WithCancel(sdk.NewContext())
+	got := collectEvents(t, sdk.SystemEvents.Subscribe(ctxt, "", 10*time.Millisecond), cancel, 2)
+	if fmt.Sprint(got) != "[e2 e3]" {
+		t.Errorf("expected each new event once in order, got %v", got)
+	}
+}
+
+func TestSystemEventsSubscribeSince(t *testing.T) {
+	defer gock.OffAll()
+	gock.CleanUnmatchedRequest()
+	mockEventPolls()
+	sdk := newTestSDK(t)
+
+	ctxt, cancel := context.WithCancel(sdk.NewContext())
+	got := collectEvents(t, sdk.SystemEvents.Subscribe(ctxt, "1600000001", 10*time.Millisecond), cancel, 3)
+	if fmt.Sprint(got) != "[e1 e2 e3]" {
+		t.Errorf("expected each event from since once in order, got %v", got)
+	}
+	if gock.HasUnmatchedRequest() {
+		t.Errorf("unexpected requests: %v", gock.GetUnmatchedRequests())
+	}
+}
+
+func TestSystemEventsSubscribeMixedPrecision(t *testing.T) {
+	defer gock.OffAll()
+	gock.CleanUnmatchedRequest()
+	sdk := newTestSDK(t)
+	// 01.5Z sorts before 01Z as a string, the cursor must still move on to it
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/events/system").
+		MatchParam("since", `^2020-01-01T00:00:00Z$`).
+		Reply(200).
+		JSON(map[string]interface{}{"data": []interface{}{
+			subscribeEvent("e1", "2020-01-01T00:00:01Z"),
+			subscribeEvent("e2", "2020-01-01T00:00:01.5Z"),
+		}})
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/events/system").
+		MatchParam("since", `^2020-01-01T00:00:01.5Z$`).
+		Reply(200).
+		JSON(map[string]interface{}{"data": []interface{}{
+			subscribeEvent("e2", "2020-01-01T00:00:01.5Z"),
+			subscribeEvent("e3", "2020-01-01T00:00:02+00:00"),
+		}})
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/events/system").
+		MatchParam("since", `^2020-01-01T00:00:02\+00:00$`).
+		Persist().
+		Reply(200).
+		JSON(map[string]interface{}{"data": []interface{}{subscribeEvent("e3", "2020-01-01T00:00:02+00:00")}})
+
+	ctxt, cancel := context.WithCancel(sdk.NewContext())
+	got := collectEvents(t, sdk.SystemEvents.Subscribe(ctxt, "2020-01-01T00:00:00Z", 10*time.Millisecond), cancel, 3)
+	if fmt.Sprint(got) != "[e1 e2 e3]" {
+		t.Errorf("expected each event once in order, got %v", got)
+	}
+	if gock.HasUnmatchedRequest() {
+		t.Errorf("unexpected requests: %v", gock.GetUnmatchedRequests())
+	}
+}
+
+func TestSystemEventsSeverity(t *testing.T) {
+	defer gock.OffAll()
+	for _, severity := range []string{"warning", "critical"} {
+		gock.New("http://127.0.0.1:7717").
+			Get("/v1/events/system").
+			MatchParam("filter", `^match\(severity,\^`+severity+`\$\)$`).
+			Reply(200).
+			JSON(map[string]interface{}{"data": []interface{}{
+				map[string]interface{}{"uuid": "e1", "severity": severity},
+			}})
+	}
+	sdk := newTestSDK(t)
+
+	events, aer, err := sdk.SystemEvents.List(&dsdk.SystemEventsRequest{Ctxt: sdk.NewContext(), Severity: dsdk.SeverityWarning})
+	if aer != nil || err != nil || len(events) != 1 || events[0].Severity != "warning" {
+		t.Errorf("unexpected result %v %v %v", events, aer, err)
+	}
+	events, aer, err = sdk.SystemEvents.ListCritical(sdk.NewContext())
+	if aer != nil || err != nil || len(events) != 1 || events[0].Severity != "critical" {
+		t.Errorf("unexpected result %v %v %v", events, aer, err)
+	}
+	if !gock.IsDone() {
+		t.Errorf("expected severity filters, pending: %v", gock.Pending())
+	}
+
+	for _, ro := range []*dsdk.SystemEventsRequest{
+		{Ctxt: sdk.NewContext(), Severity: "catastrophic"},
+		{Ctxt: sdk.NewContext(), Severity: dsdk.SeverityError, Params: dsdk.ListRangeParams{Filter: "match(code,^1$)"}},
+	} {
+		if _, _, err := sdk.SystemEvents.List(ro); !errors.Is(err, dsdk.ErrInvalidRequest) {
+			t.Errorf("expected %+v to be rejected, got %v", ro, err)
+		}
+	}
+}
+
+func TestSystemEventsDecode(t *testing.T) {
+	defer gock.OffAll()
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/events/system").
+		Reply(200).
+		BodyString(`{"data": [{
+			"uuid": "a7b3c6c2-3f1e-4c59-9c6e-1d2f0e6b7a10",
+			"time": "1600000000.123",
+			"severity": "critical",
+			"category": "storage",
+			"code": "VOLUME_DEGRADED",
+			"message": "volume-1 is degraded",
+			"object_path": "/app_instances/my-app/storage_instances/storage-1/volumes/volume-1",
+			"repeat_count": 2,
+			"node_id": "node-3",
+			"details": {"replicas_available": 2}
+		}]}`)
+	sdk := newTestSDK(t)
+
+	events, aer, err := sdk.SystemEvents.List(&dsdk.SystemEventsRequest{Ctxt: sdk.NewContext()})
+	if aer != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected a single event, got %v", events)
+	}
+	ev := events[0]
+	if ev.Uuid != "a7b3c6c2-3f1e-4c59-9c6e-1d2f0e6b7a10" || ev.Time != "1600000000.123" || ev.Severity != "critical" ||
+		ev.Category != "storage" || ev.Code != "VOLUME_DEGRADED" || ev.Message != "volume-1 is degraded" ||
+		ev.ObjectPath != "/app_instances/my-app/storage_instances/storage-1/volumes/volume-1" || ev.RepeatCount != 2 {
+		t.Errorf("unexpected event %+v", ev)
+	}
+	if len(ev.Extra) != 2 || ev.Extra["node_id"] != "node-3" || fmt.Sprint(ev.Extra["details"]) != "map[replicas_available:2]" {
+		t.Errorf("expected the unknown fields to be kept, got %v", ev.Extra)
+	}
+}
+
+func TestSystemEventsTail(t *testing.T) {
+	defer gock.OffAll()
+	latest := []interface{}{}
+	for i := 5; i > 0; i-- {
+		latest = append(latest, map[string]interface{}{"uuid": fmt.Sprintf("e%d", i), "time": fmt.Sprintf("160000000%d", i)})
+	}
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/events/system").
+		MatchParams(map[string]string{"sort": "^-time$", "limit": "^5$"}).
+		Reply(200).
+		JSON(map[string]interface{}{
+			"data":     latest,
+			"metadata": map[string]interface{}{"total_count": 1000},
+		})
+	sdk := newTestSDK(t)
+
+	events, aer, err := sdk.SystemEvents.Tail(sdk.NewContext(), 5)
+	if aer != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	if len(events) != 5 || events[0].Uuid != "e5" || events[4].Uuid != "e1" {
+		t.Errorf("expected the 5 latest events newest first, got %v", events)
+	}
+	if !gock.IsDone() {
+		t.Errorf("expected a single sorted and limited request, pending: %v", gock.Pending())
+	}
+}
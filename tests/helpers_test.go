@@ -0,0 +1,34 @@
+package dsdk_test
+
+import (
+	"testing"
+
+	udc "github.com/Datera/go-udc/pkg/udc"
+	dsdk "github.com/tjcelaya/go-datera/pkg/dsdk"
+	"gopkg.in/h2non/gock.v1"
+)
+
+// newTestSDK returns an SDK, made with opts, for the cluster gock mocks at
+// 127.0.0.1:7717, mocking the login its first request makes
+func newTestSDK(t *testing.T, opts ...dsdk.ApiConnectionOption) *dsdk.SDK {
+	return newTestSDKInTenant(t, "", opts...)
+}
+
+// newTestSDKInTenant is newTestSDK with the SDK configured to use tenant
+func newTestSDKInTenant(t *testing.T, tenant string, opts ...dsdk.ApiConnectionOption) *dsdk.SDK {
+	gock.New("http://127.0.0.1:7717").
+		Put("/v1/login").
+		Reply(200).
+		JSON(&dsdk.ApiLogin{Key: "thekey"})
+	sdk, err := dsdk.NewSDK(&udc.UDC{
+		MgmtIp:     "127.0.0.1",
+		Username:   "foo",
+		Password:   "bar",
+		ApiVersion: "1",
+		Tenant:     tenant,
+	}, false, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sdk
+}
@@ -0,0 +1,286 @@
+package dsdk_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	dsdk "github.com/tjcelaya/go-datera/pkg/dsdk"
+	"gopkg.in/h2non/gock.v1"
+)
+
+const (
+	iqn1 = "iqn.1993-08.org.debian:01:host1"
+	iqn2 = "iqn.1993-08.org.debian:01:host2"
+	iqn3 = "iqn.1993-08.org.debian:01:host3"
+)
+
+// mockGroup answers a GET of the initiator group my-group with the given members
+func mockGroup(iqns ...string) {
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/initiator_groups/my-group").
+		Reply(200).
+		JSON(map[string]interface{}{"data": groupData(iqns...)})
+}
+
+// mockGroupSet expects a PUT setting the members of my-group and replies with status
+func mockGroupSet(status int, iqns ...string) {
+	reply := gock.New("http://127.0.0.1:7717").
+		Put("/v1/initiator_groups/my-group").
+		JSON(map[string]interface{}{"members": memberRefs(iqns...)}).
+		Reply(status)
+	if status != 200 {
+		reply.JSON(dsdk.ApiErrorResponse{Name: "ConflictError", Message: "modified concurrently", Http: status})
+		return
+	}
+	reply.JSON(map[string]interface{}{"data": groupData(iqns...)})
+}
+
+func groupData(iqns ...string) map[string]interface{} {
+	return map[string]interface{}{
+		"name":    "my-group",
+		"path":    "/initiator_groups/my-group",
+		"members": memberRefs(iqns...),
+	}
+}
+
+func memberRefs(iqns ...string) []map[string]string {
+	refs := []map[string]string{}
+	for _, iqn := range iqns {
+		refs = append(refs, map[string]string{"path": "/initiators/" + iqn})
+	}
+	return refs
+}
+
+// groupIQNs returns the IQNs of the members of ig
+func groupIQNs(ig *dsdk.InitiatorGroup) []string {
+	iqns := []string{}
+	for _, m := range ig.Members {
+		iqns = append(iqns, m.Path[len("/initiators/"):])
+	}
+	return iqns
+}
+
+func TestInitiatorGroupsMembers(t *testing.T) {
+	tests := []struct {
+		name    string
+		mock    func()
+		update  func(*dsdk.SDK) (*dsdk.InitiatorGroup, *dsdk.ApiErrorResponse, error)
+		members []string
+	}{
+		{
+			name: "add",
+			mock: func() {
+				mockGroup(iqn1)
+				mockGroupSet(200, iqn1, iqn2)
+			},
+			update: func(sdk *dsdk.SDK) (*dsdk.InitiatorGroup, *dsdk.ApiErrorResponse, error) {
+				return sdk.InitiatorGroups.AddMembers(sdk.NewContext(), "my-group", []string{iqn1, iqn2}, 0)
+			},
+			members: []string{iqn1, iqn2},
+		},
+		{
+			name: "add existing",
+			mock: func() {
+				mockGroup(iqn1, iqn2)
+			},
+			update: func(sdk *dsdk.SDK) (*dsdk.InitiatorGroup, *dsdk.ApiErrorResponse, error) {
+				return sdk.InitiatorGroups.AddMembers(sdk.NewContext(), "my-group", []string{iqn2}, 0)
+			},
+			members: []string{iqn1, iqn2},
+		},
+		{
+			name: "remove",
+			mock: func() {
+				mockGroup(iqn1, iqn2)
+				mockGroupSet(200, iqn2)
+			},
+			update: func(sdk *dsdk.SDK) (*dsdk.InitiatorGroup, *dsdk.ApiErrorResponse, error) {
+				return sdk.InitiatorGroups.RemoveMembers(sdk.NewContext(), "my-group", []string{iqn1, iqn3}, 0)
+			},
+			members: []string{iqn2},
+		},
+		{
+			name: "remove all",
+			mock: func() {
+				mockGroup(iqn1)
+				mockGroupSet(200)
+			},
+			update: func(sdk *dsdk.SDK) (*dsdk.InitiatorGroup, *dsdk.ApiErrorResponse, error) {
+				return sdk.InitiatorGroups.RemoveMembers(sdk.NewContext(), "my-group", []string{iqn1}, 0)
+			},
+			members: []string{},
+		},
+		{
+			name: "conflict retried",
+			mock: func() {
+				mockGroup(iqn1)
+				mockGroupSet(409, iqn1, iqn2)
+				// another client added iqn3 in the meantime
+				mockGroup(iqn1, iqn3)
+				mockGroupSet(200, iqn1, iqn3, iqn2)
+				mockGroup(iqn1, iqn3, iqn2)
+			},
+			update: func(sdk *dsdk.SDK) (*dsdk.InitiatorGroup, *dsdk.ApiErrorResponse, error) {
+				return sdk.InitiatorGroups.AddMembers(sdk.NewContext(), "my-group", []string{iqn2}, 1)
+			},
+			members: []string{iqn1, iqn3, iqn2},
+		},
+		{
+			name: "concurrent modification",
+			mock: func() {
+				mockGroup(iqn1)
+				mockGroupSet(200, iqn1, iqn2)
+				// another client wrote the members it read before ours landed
+				mockGroup(iqn1, iqn3)
+				mockGroupSet(200, iqn1, iqn3, iqn2)
+				mockGroup(iqn1, iqn3, iqn2)
+			},
+			update: func(sdk *dsdk.SDK) (*dsdk.InitiatorGroup, *dsdk.ApiErrorResponse, error) {
+				return sdk.InitiatorGroups.AddMembers(sdk.NewContext(), "my-group", []string{iqn2}, 1)
+			},
+			members: []string{iqn1, iqn3, iqn2},
+		},
+		{
+			name: "concurrent re-add",
+			mock: func() {
+				mockGroup(iqn1, iqn2)
+				mockGroupSet(200, iqn2)
+				mockGroup(iqn1, iqn2)
+				mockGroupSet(200, iqn2)
+				mockGroup(iqn2)
+			},
+			update: func(sdk *dsdk.SDK) (*dsdk.InitiatorGroup, *dsdk.ApiErrorResponse, error) {
+				return sdk.InitiatorGroups.RemoveMembers(sdk.NewContext(), "my-group", []string{iqn1}, 2)
+			},
+			members: []string{iqn2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer gock.OffAll()
+			gock.CleanUnmatchedRequest()
+			sdk := newTestSDK(t)
+			tt.mock()
+
+			ig, aer, err := tt.update(sdk)
+			if aer != nil || err != nil {
+				t.Fatalf("unexpected error: %v %v", aer, err)
+			}
+			if got := groupIQNs(ig); fmt.Sprint(got) != fmt.Sprint(tt.members) {
+				t.Errorf("expected members %v, got %v", tt.members, got)
+			}
+			if !gock.IsDone() {
+				t.Errorf("unmatched mocks: %v", gock.Pending())
+			}
+			if gock.HasUnmatchedRequest() {
+				t.Errorf("unexpected requests: %v", gock.GetUnmatchedRequests())
+			}
+		})
+	}
+}
+
+func TestInitiatorGroupsMembersConflict(t *testing.T) {
+	defer gock.OffAll()
+	sdk := newTestSDK(t)
+	mockGroup(iqn1)
+	mockGroupSet(409, iqn1, iqn2)
+
+	_, aer, err := sdk.InitiatorGroups.AddMembers(sdk.NewContext(), "my-group", []string{iqn2}, 0)
+	if err != nil || !errors.Is(aer, dsdk.ErrConflict) {
+		t.Errorf("expected the conflict to be returned, got %v %v", aer, err)
+	}
+
+	// a write undone by every re-read gives up once the retries run out
+	mockGroup(iqn1)
+	mockGroupSet(200, iqn1, iqn2)
+	mockGroup(iqn1)
+	mockGroupSet(200, iqn1, iqn2)
+	mockGroup(iqn1)
+	ig, aer, err := sdk.InitiatorGroups.AddMembers(sdk.NewContext(), "my-group", []string{iqn2}, 1)
+	if aer != nil || !errors.Is(err, dsdk.ErrConflict) {
+		t.Errorf("expected ErrConflict once the retries ran out, got %v %v", aer, err)
+	}
+	if ig == nil || fmt.Sprint(groupIQNs(ig)) != fmt.Sprint([]string{iqn1}) {
+		t.Errorf("expected the group as last read, got %+v", ig)
+	}
+	if !gock.IsDone() {
+		t.Errorf("unmatched mocks: %v", gock.Pending())
+	}
+}
+
+func TestInitiatorGroupsSyncMembers(t *testing.T) {
+	tests := []struct {
+		name    string
+		current []string
+		desired []string
+		members []string
+		added   []string
+		removed []string
+	}{
+		{
+			name:    "overlapping",
+			current: []string{iqn1, iqn2},
+			desired: []string{iqn2, iqn3},
+			members: []string{iqn2, iqn3},
+			added:   []string{iqn3},
+			removed: []string{iqn1},
+		},
+		{
+			name:    "in sync",
+			current: []string{iqn1, iqn2},
+			desired: []string{iqn2, iqn1, iqn1},
+		},
+		{
+			name:    "empty",
+			current: []string{iqn1},
+			desired: []string{},
+			members: []string{},
+			removed: []string{iqn1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer gock.OffAll()
+			gock.CleanUnmatchedRequest()
+			sdk := newTestSDK(t)
+			mockGroup(tt.current...)
+			if tt.members != nil {
+				mockGroupSet(200, tt.members...)
+			}
+
+			diff, aer, err := sdk.InitiatorGroups.SyncMembers(sdk.NewContext(), "my-group", tt.desired)
+			if aer != nil || err != nil {
+				t.Fatalf("unexpected error: %v %v", aer, err)
+			}
+			if fmt.Sprint(diff.Added) != fmt.Sprint(tt.added) || fmt.Sprint(diff.Removed) != fmt.Sprint(tt.removed) {
+				t.Errorf("expected +%v -%v, got +%v -%v", tt.added, tt.removed, diff.Added, diff.Removed)
+			}
+			if !gock.IsDone() {
+				t.Errorf("unmatched mocks: %v", gock.Pending())
+			}
+			if gock.HasUnmatchedRequest() {
+				t.Errorf("unexpected requests: %v", gock.GetUnmatchedRequests())
+			}
+		})
+	}
+}
+
+func TestInitiatorGroupSetWithoutMembers(t *testing.T) {
+	defer gock.OffAll()
+	sdk := newTestSDK(t)
+	// a Set that doesn't mention members mustn't clear them
+	gock.New("http://127.0.0.1:7717").
+		Put("/v1/initiator_groups/my-group").
+		JSON(map[string]interface{}{}).
+		Reply(200).
+		JSON(map[string]interface{}{"data": groupData(iqn1)})
+
+	ig := &dsdk.InitiatorGroup{Path: "/initiator_groups/my-group"}
+	if _, aer, err := ig.Set(&dsdk.InitiatorGroupSetRequest{Ctxt: sdk.NewContext()}); aer != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	if !gock.IsDone() {
+		t.Errorf("unmatched mocks: %v", gock.Pending())
+	}
+}
@@ -0,0 +1,111 @@
+package dsdk_test
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+
+	dsdk "github.com/tjcelaya/go-datera/pkg/dsdk"
+	"gopkg.in/h2non/gock.v1"
+)
+
+func TestInitiatorsCreateMany(t *testing.T) {
+	defer gock.OffAll()
+	sdk := newTestSDK(t)
+	specs := []dsdk.InitiatorSpec{
+		{IQN: "iqn.1993-08.org.debian:01:host1", Name: "host1"},
+		{IQN: "iqn.1993-08.org.debian:01:host2", Name: "host2"},
+		{IQN: "iqn.1993-08.org.debian:01:host3", Name: "host3"},
+	}
+	for i, spec := range specs {
+		req := gock.New("http://127.0.0.1:7717").
+			Post("/v1/initiators").
+			JSON(map[string]string{"id": spec.IQN, "name": spec.Name})
+		if i == 1 {
+			req.Reply(409).JSON(dsdk.ApiErrorResponse{Name: "ConflictError", Message: "initiator already exists", Http: 409})
+			continue
+		}
+		req.Reply(200).JSON(map[string]interface{}{"data": map[string]string{
+			"id":   spec.IQN,
+			"name": spec.Name,
+			"path": "/initiators/" + spec.IQN,
+		}})
+	}
+
+	results, err := sdk.Initiators.CreateMany(sdk.NewContext(), specs, 2)
+	if err != nil {
+		t.Fatalf("expected the existing initiator not to fail the batch, got %v", err)
+	}
+	if len(results) != len(specs) {
+		t.Fatalf("expected %d results, got %d", len(specs), len(results))
+	}
+	for i, res := range results {
+		if res.Spec != specs[i] || res.Err != nil {
+			t.Errorf("unexpected result %d %+v", i, res)
+		}
+		if existed := i == 1; res.Existed != existed || (res.Initiator == nil) != existed {
+			t.Errorf("expected result %d existed to be %t, got %+v", i, existed, res)
+		}
+	}
+	if !gock.IsDone() {
+		t.Errorf("unmatched mocks: %v", gock.Pending())
+	}
+}
+
+func TestInitiatorsCreateManyFailure(t *testing.T) {
+	defer gock.OffAll()
+	sdk := newTestSDK(t)
+	gock.New("http://127.0.0.1:7717").
+		Post("/v1/initiators").
+		Reply(400).
+		JSON(dsdk.ApiErrorResponse{Name: "ValidationFailedError", Message: "bad iqn", Http: 400})
+
+	results, err := sdk.Initiators.CreateMany(sdk.NewContext(), []dsdk.InitiatorSpec{{IQN: "not-an-iqn", Name: "bad"}}, 1)
+	var bulk *dsdk.BulkError
+	if !errors.As(err, &bulk) || !errors.Is(bulk.Errors["not-an-iqn"], dsdk.ErrInvalidRequest) {
+		t.Fatalf("expected the failure to be reported, got %v", err)
+	}
+	if len(results) != 1 || results[0].Err == nil {
+		t.Errorf("expected the failed result, got %+v", results)
+	}
+}
+
+func TestInitiatorsGetByIQN(t *testing.T) {
+	const iqn = "iqn.1993-08.org.debian:01:host1"
+	initiator := map[string]string{"id": iqn, "name": "host1", "path": "/initiators/" + iqn}
+	tests := []struct {
+		name     string
+		data     []interface{}
+		notFound bool
+		wantErr  bool
+	}{
+		{"found", []interface{}{initiator}, false, false},
+		{"not found", []interface{}{}, true, true},
+		{"ambiguous", []interface{}{initiator, initiator}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer gock.OffAll()
+			sdk := newTestSDK(t)
+			gock.New("http://127.0.0.1:7717").
+				Get("/v1/initiators").
+				MatchParam("filter", regexp.QuoteMeta(`match(id,^iqn\.1993-08\.org\.debian:01:host1$)`)).
+				Reply(200).
+				JSON(map[string]interface{}{"data": tt.data})
+
+			init, aer, err := sdk.Initiators.GetByIQN(sdk.NewContext(), iqn)
+			if aer != nil {
+				t.Fatalf("unexpected API error: %v", aer)
+			}
+			if (err != nil) != tt.wantErr || dsdk.IsNotFound(err) != tt.notFound {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if !tt.wantErr && (init == nil || init.Id != iqn) {
+				t.Errorf("expected initiator %s, got %+v", iqn, init)
+			}
+			if !gock.IsDone() {
+				t.Errorf("expected a filtered list, pending: %v", gock.Pending())
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package dsdk_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	dsdk "github.com/tjcelaya/go-datera/pkg/dsdk"
+	"gopkg.in/h2non/gock.v1"
+)
+
+// mockIpPool serves pool-1 with the range start-end and a storage instance using the
+// addresses in use
+func mockIpPool(start, end string, inUse ...string) {
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/access_network_ip_pools/pool-1$").
+		Persist().
+		Reply(200).
+		JSON(map[string]interface{}{"data": map[string]interface{}{
+			"path": "/access_network_ip_pools/pool-1",
+			"name": "pool-1",
+			"network_paths": []map[string]interface{}{
+				{"name": "eth1", "start_ip": start, "end_ip": end, "netmask": 24},
+			},
+		}})
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/app_instances$").
+		Persist().
+		Reply(200).
+		JSON(map[string]interface{}{"data": []map[string]interface{}{
+			{
+				"path": "/app_instances/ai-1",
+				"name": "ai-1",
+				"storage_instances": []map[string]interface{}{
+					{
+						"path":    "/app_instances/ai-1/storage_instances/si-1",
+						"name":    "si-1",
+						"ip_pool": map[string]interface{}{"path": "/access_network_ip_pools/pool-1"},
+						"access":  map[string]interface{}{"ips": inUse},
+					},
+					{
+						"path":    "/app_instances/ai-1/storage_instances/si-2",
+						"name":    "si-2",
+						"ip_pool": map[string]interface{}{"path": "/access_network_ip_pools/other"},
+						"access":  map[string]interface{}{"ips": []string{start}},
+					},
+				},
+			},
+		}})
+}
+
+func TestIpPoolCreate(t *testing.T) {
+	defer gock.OffAll()
+	sdk := newTestSDK(t)
+	gock.New("http://127.0.0.1:7717").
+		Post("/v1/access_network_ip_pools$").
+		JSON(map[string]interface{}{
+			"name": "pool-1",
+			"network_paths": []map[string]interface{}{
+				{"name": "eth1", "start_ip": "10.0.0.10", "end_ip": "10.0.0.20", "netmask": 24},
+			},
+		}).
+		Reply(200).
+		JSON(map[string]interface{}{"data": map[string]interface{}{
+			"path": "/access_network_ip_pools/pool-1", "name": "pool-1",
+		}})
+
+	pool, apierr, err := sdk.AccessNetworkIpPools.Create(&dsdk.AccessNetworkIpPoolsCreateRequest{
+		Ctxt: sdk.NewContext(),
+		Name: "pool-1",
+		NetworkPaths: []*dsdk.IpPoolNetworkPath{
+			{Name: "eth1", StartIp: "10.0.0.10", EndIp: "10.0.0.20", Netmask: 24},
+		},
+	})
+	if apierr != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", apierr, err)
+	}
+	if pool.Path != "/access_network_ip_pools/pool-1" {
+		t.Errorf("unexpected pool: %+v", pool)
+	}
+	if !gock.IsDone() {
+		t.Errorf("pending mocks: %v", gock.Pending())
+	}
+}
+
+func TestIpPoolAllocate(t *testing.T) {
+	defer gock.OffAll()
+	sdk := newTestSDK(t)
+	mockIpPool("10.0.0.10", "10.0.0.13", "10.0.0.10", "10.0.0.12")
+
+	var got []string
+	for i := 0; i < 2; i++ {
+		ip, apierr, err := sdk.AccessNetworkIpPools.Allocate(sdk.NewContext(), "pool-1")
+		if apierr != nil || err != nil {
+			t.Fatalf("unexpected error: %v %v", apierr, err)
+		}
+		got = append(got, ip)
+	}
+	if got[0] != "10.0.0.11" || got[1] != "10.0.0.13" {
+		t.Errorf("expected the free addresses 10.0.0.11 and 10.0.0.13, got %v", got)
+	}
+
+	sdk.AccessNetworkIpPools.Release("pool-1", "10.0.0.11")
+	ip, _, err := sdk.AccessNetworkIpPools.Allocate(sdk.NewContext(), "pool-1")
+	if err != nil || ip != "10.0.0.11" {
+		t.Errorf("expected released 10.0.0.11 to be allocated again, got %q %v", ip, err)
+	}
+}
+
+func TestIpPoolAllocateExhausted(t *testing.T) {
+	defer gock.OffAll()
+	sdk := newTestSDK(t)
+	mockIpPool("10.0.0.10", "10.0.0.11", "10.0.0.10")
+
+	if _, _, err := sdk.AccessNetworkIpPools.Allocate(sdk.NewContext(), "pool-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, apierr, err := sdk.AccessNetworkIpPools.Allocate(sdk.NewContext(), "pool-1")
+	if apierr != nil || !errors.Is(err, dsdk.ErrIpPoolExhausted) {
+		t.Errorf("expected ErrIpPoolExhausted, got %v %v", apierr, err)
+	}
+}
+
+func TestIpPoolAllocateConcurrent(t *testing.T) {
+	defer gock.OffAll()
+	sdk := newTestSDK(t)
+	mockIpPool("10.0.0.1", "10.0.0.8")
+
+	var wg sync.WaitGroup
+	ips := make(chan string, 10)
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ip, _, err := sdk.AccessNetworkIpPools.Allocate(sdk.NewContext(), "pool-1")
+			if err != nil {
+				errs <- err
+				return
+			}
+			ips <- ip
+		}()
+	}
+	wg.Wait()
+	close(ips)
+	close(errs)
+
+	seen := map[string]bool{}
+	for ip := range ips {
+		if seen[ip] {
+			t.Errorf("%s allocated twice", ip)
+		}
+		seen[ip] = true
+	}
+	if len(seen) != 8 {
+		t.Errorf("expected all 8 addresses allocated, got %d", len(seen))
+	}
+	for err := range errs {
+		if !errors.Is(err, dsdk.ErrIpPoolExhausted) {
+			t.Errorf("expected ErrIpPoolExhausted, got %v", err)
+		}
+	}
+}
+
+func TestIpPoolReleaseTenantPath(t *testing.T) {
+	defer gock.OffAll()
+	sdk := newTestSDK(t)
+	// the pool's path isn't the one the SDK would build from its name
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/access_network_ip_pools/pool-1$").
+		Persist().
+		Reply(200).
+		JSON(map[string]interface{}{"data": map[string]interface{}{
+			"path": "/root/t1/access_network_ip_pools/pool-1",
+			"name": "pool-1",
+			"network_paths": []map[string]interface{}{
+				{"name": "eth1", "start_ip": "10.0.0.1", "end_ip": "10.0.0.4", "netmask": 24},
+			},
+		}})
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/app_instances$").
+		Persist().
+		Reply(200).
+		JSON(map[string]interface{}{"data": []map[string]interface{}{}})
+
+	first, _, err := sdk.AccessNetworkIpPools.Allocate(sdk.NewContext(), "pool-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sdk.AccessNetworkIpPools.Release("pool-1", first)
+	again, _, err := sdk.AccessNetworkIpPools.Allocate(sdk.NewContext(), "pool-1")
+	if err != nil || again != first {
+		t.Errorf("expected released %s to be allocated again, got %q %v", first, again, err)
+	}
+}
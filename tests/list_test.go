@@ -0,0 +1,397 @@
+package dsdk_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+
+	greq "github.com/levigross/grequests"
+	dsdk "github.com/tjcelaya/go-datera/pkg/dsdk"
+	"gopkg.in/h2non/gock.v1"
+)
+
+// mockCollection serves a collection of total items at path in pages of pageSize.
+// Every page can be fetched at most once
+func mockCollection(path string, total, pageSize int) {
+	for offset := 0; offset < total; offset += pageSize {
+		data := []interface{}{}
+		for i := offset; i < offset+pageSize && i < total; i++ {
+			data = append(data, map[string]interface{}{"name": fmt.Sprintf("item-%d", i)})
+		}
+		want := ""
+		if offset > 0 {
+			want = strconv.Itoa(offset)
+		}
+		gock.New("http://127.0.0.1:7717").
+			Get(path).
+			AddMatcher(func(req *http.Request, _ *gock.Request) (bool, error) {
+				return req.URL.Query().Get("offset") == want, nil
+			}).
+			Reply(200).
+			JSON(dsdk.ApiListOuter{
+				Data:     data,
+				Metadata: map[string]interface{}{"total_count": total},
+			})
+	}
+}
+
+func TestGetListIter(t *testing.T) {
+	defer gock.OffAll()
+	mockCollection("/v1/initiators", 5, 2)
+	sdk := newTestSDK(t)
+
+	var names []string
+	it := sdk.Conn.GetListIter(sdk.NewContext(), "initiators", nil)
+	for it.Next() {
+		names = append(names, it.Item().(map[string]interface{})["name"].(string))
+	}
+	if aer, err := it.Err(); aer != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	if len(names) != 5 || names[0] != "item-0" || names[4] != "item-4" {
+		t.Errorf("unexpected items %v", names)
+	}
+	if !gock.IsDone() {
+		t.Error("expected every page to be fetched")
+	}
+}
+
+func TestGetListIterStopsWhenCancelled(t *testing.T) {
+	defer gock.OffAll()
+	mockCollection("/v1/initiators", 6, 2)
+	sdk := newTestSDK(t)
+
+	ctxt, cancel := context.WithCancel(sdk.NewContext())
+	defer cancel()
+	it := sdk.Conn.GetListIter(ctxt, "initiators", nil)
+	for i := 0; i < 2; i++ {
+		if !it.Next() {
+			t.Fatalf("expected item %d from the first page", i)
+		}
+	}
+	cancel()
+	if it.Next() {
+		t.Error("expected iteration to stop once the context was cancelled")
+	}
+	if _, err := it.Err(); err != context.Canceled {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+	if pending := len(gock.Pending()); pending != 2 {
+		t.Errorf("expected the 2 remaining pages not to be fetched, %d are pending", pending)
+	}
+}
+
+func TestGetListPageFunc(t *testing.T) {
+	defer gock.OffAll()
+	mockCollection("/v1/initiators", 5, 2)
+	sdk := newTestSDK(t)
+
+	var sizes []int
+	ctxt := dsdk.WithPageFunc(sdk.NewContext(), func(page *dsdk.ApiListOuter) error {
+		sizes = append(sizes, len(page.Data))
+		return nil
+	})
+	rs, aer, err := sdk.Conn.GetList(ctxt, "initiators", &greq.RequestOptions{})
+	if aer != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	if fmt.Sprint(sizes) != "[2 2 1]" {
+		t.Errorf("expected one call per page, got page sizes %v", sizes)
+	}
+	if len(rs.Data) != 5 {
+		t.Errorf("expected all 5 items to be returned, got %d", len(rs.Data))
+	}
+}
+
+func TestGetListPageFuncAborts(t *testing.T) {
+	defer gock.OffAll()
+	mockCollection("/v1/initiators", 6, 2)
+	sdk := newTestSDK(t)
+
+	stop := errors.New("stop")
+	calls := 0
+	ctxt := dsdk.WithPageFunc(sdk.NewContext(), func(page *dsdk.ApiListOuter) error {
+		calls++
+		if calls == 2 {
+			return stop
+		}
+		return nil
+	})
+	rs, aer, err := sdk.Conn.GetList(ctxt, "initiators", &greq.RequestOptions{})
+	if aer != nil || err != stop {
+		t.Fatalf("expected %v, got %v %v", stop, aer, err)
+	}
+	if calls != 2 {
+		t.Errorf("expected pagination to stop after the second page, got %d calls", calls)
+	}
+	if len(rs.Data) != 4 {
+		t.Errorf("expected the 4 items fetched so far, got %d", len(rs.Data))
+	}
+	if pending := len(gock.Pending()); pending != 1 {
+		t.Errorf("expected the last page not to be fetched, %d are pending", pending)
+	}
+}
+
+func TestGetListLimitAsTotal(t *testing.T) {
+	defer gock.OffAll()
+	mockCollection("/v1/initiators", 1000, 100)
+	sdk := newTestSDK(t)
+
+	ctxt := dsdk.WithLimitAsTotal(sdk.NewContext())
+	ro := &greq.RequestOptions{Params: dsdk.ListParams{Limit: 250}.ToMap()}
+	rs, aer, err := sdk.Conn.GetList(ctxt, "initiators", ro)
+	if aer != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	if len(rs.Data) != 250 {
+		t.Errorf("expected 250 items, got %d", len(rs.Data))
+	}
+	if name := rs.Data[249].(map[string]interface{})["name"]; name != "item-249" {
+		t.Errorf("expected the last item to be item-249, got %v", name)
+	}
+	if pending := len(gock.Pending()); pending != 7 {
+		t.Errorf("expected only the first 3 pages to be fetched, %d are pending", pending)
+	}
+}
+
+func TestGetListLimitIsPageSize(t *testing.T) {
+	defer gock.OffAll()
+	mockCollection("/v1/initiators", 1000, 100)
+	sdk := newTestSDK(t)
+
+	ro := &greq.RequestOptions{Params: dsdk.ListParams{Limit: 250}.ToMap()}
+	rs, aer, err := sdk.Conn.GetList(sdk.NewContext(), "initiators", ro)
+	if aer != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	if len(rs.Data) != 100 {
+		t.Errorf("expected a single page without WithLimitAsTotal, got %d items", len(rs.Data))
+	}
+}
+
+func TestGetListPageBoundaries(t *testing.T) {
+	for _, total := range []int{5, 6, 7, 2, 1} {
+		t.Run(strconv.Itoa(total), func(t *testing.T) {
+			defer gock.OffAll()
+			mockCollection("/v1/initiators", total, 2)
+			sdk := newTestSDK(t)
+
+			rs, aer, err := sdk.Conn.GetList(sdk.NewContext(), "initiators", &greq.RequestOptions{})
+			if aer != nil || err != nil {
+				t.Fatalf("unexpected error: %v %v", aer, err)
+			}
+			if len(rs.Data) != total {
+				t.Errorf("expected %d items, got %d", total, len(rs.Data))
+			}
+			if !gock.IsDone() {
+				t.Error("expected every page to be fetched exactly once")
+			}
+		})
+	}
+}
+
+func TestGetListStopsWhenCancelled(t *testing.T) {
+	defer gock.OffAll()
+	mockCollection("/v1/initiators", 6, 2)
+	sdk := newTestSDK(t)
+
+	ctxt, cancel := context.WithCancel(sdk.NewContext())
+	defer cancel()
+	ctxt = dsdk.WithPageFunc(ctxt, func(page *dsdk.ApiListOuter) error {
+		cancel()
+		return nil
+	})
+	rs, aer, err := sdk.Conn.GetList(ctxt, "initiators", &greq.RequestOptions{})
+	if aer != nil || err != context.Canceled {
+		t.Fatalf("expected %v, got %v %v", context.Canceled, aer, err)
+	}
+	if len(rs.Data) != 2 {
+		t.Errorf("expected the 2 items from the first page, got %d", len(rs.Data))
+	}
+	if pending := len(gock.Pending()); pending != 2 {
+		t.Errorf("expected the 2 remaining pages not to be fetched, %d are pending", pending)
+	}
+}
+
+func TestGetListBadTotalCount(t *testing.T) {
+	for name, metadata := range map[string]map[string]interface{}{
+		"missing": {"request_id": "abc"},
+		"string":  {"total_count": "4"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer gock.OffAll()
+			gock.New("http://127.0.0.1:7717").
+				Get("/v1/initiators").
+				Reply(200).
+				JSON(dsdk.ApiListOuter{
+					Data:     []interface{}{map[string]interface{}{"name": "item-0"}, map[string]interface{}{"name": "item-1"}},
+					Metadata: metadata,
+				})
+			sdk := newTestSDK(t)
+
+			rs, aer, err := sdk.Conn.GetList(sdk.NewContext(), "initiators", &greq.RequestOptions{})
+			if aer != nil || err != nil {
+				t.Fatalf("unexpected error: %v %v", aer, err)
+			}
+			if len(rs.Data) != 2 {
+				t.Errorf("expected the single page of 2 items, got %d", len(rs.Data))
+			}
+		})
+	}
+}
+
+// observeLimits records the limit param of every request made to path
+func observeLimits(path string) (*[]string, func()) {
+	limits := []string{}
+	gock.Observe(func(req *http.Request, mock gock.Mock) {
+		if req.URL.Path == path {
+			limits = append(limits, req.URL.Query().Get("limit"))
+		}
+	})
+	return &limits, func() { gock.Observe(nil) }
+}
+
+func TestGetListPageSize(t *testing.T) {
+	defer gock.OffAll()
+	mockCollection("/v1/initiators", 5, 2)
+	limits, stop := observeLimits("/v1/initiators")
+	defer stop()
+	sdk := newTestSDK(t, dsdk.WithPageSize(2))
+
+	rs, aer, err := sdk.Conn.GetList(sdk.NewContext(), "initiators", &greq.RequestOptions{})
+	if aer != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	if len(rs.Data) != 5 {
+		t.Errorf("expected 5 items, got %d", len(rs.Data))
+	}
+	if fmt.Sprint(*limits) != "[2 2 2]" {
+		t.Errorf("expected every page to be requested with limit 2, got %v", *limits)
+	}
+}
+
+func TestGetListPageSizeWithLimitAsTotal(t *testing.T) {
+	defer gock.OffAll()
+	mockCollection("/v1/initiators", 1000, 100)
+	limits, stop := observeLimits("/v1/initiators")
+	defer stop()
+	sdk := newTestSDK(t, dsdk.WithPageSize(100))
+
+	ctxt := dsdk.WithLimitAsTotal(sdk.NewContext())
+	ro := &greq.RequestOptions{Params: dsdk.ListParams{Limit: 250}.ToMap()}
+	rs, aer, err := sdk.Conn.GetList(ctxt, "initiators", ro)
+	if aer != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	if len(rs.Data) != 250 {
+		t.Errorf("expected 250 items, got %d", len(rs.Data))
+	}
+	if fmt.Sprint(*limits) != "[100 100 50]" {
+		t.Errorf("expected the last page to ask only for what's left, got %v", *limits)
+	}
+}
+
+func TestGetListIterPageSize(t *testing.T) {
+	defer gock.OffAll()
+	mockCollection("/v1/initiators", 3, 2)
+	limits, stop := observeLimits("/v1/initiators")
+	defer stop()
+	sdk := newTestSDK(t, dsdk.WithPageSize(2))
+
+	it := sdk.Conn.GetListIter(sdk.NewContext(), "initiators", nil)
+	n := 0
+	for it.Next() {
+		n++
+	}
+	if aer, err := it.Err(); aer != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	if n != 3 || fmt.Sprint(*limits) != "[2 2]" {
+		t.Errorf("expected 3 items in pages of 2, got %d items with limits %v", n, *limits)
+	}
+}
+
+func TestGetListRange(t *testing.T) {
+	defer gock.OffAll()
+	mockCollection("/v1/events/system", 6, 2)
+	var queries []url.Values
+	gock.Observe(func(req *http.Request, mock gock.Mock) {
+		if req.URL.Path == "/v1/events/system" {
+			queries = append(queries, req.URL.Query())
+		}
+	})
+	defer gock.Observe(nil)
+	sdk := newTestSDK(t)
+
+	events, aer, err := sdk.SystemEvents.List(&dsdk.SystemEventsRequest{
+		Ctxt: sdk.NewContext(),
+		Params: dsdk.ListRangeParams{
+			Since:  "2020-01-01T00:00:00Z",
+			From:   "2020-01-01T00:00:00Z",
+			To:     "2020-01-02T00:00:00Z",
+			Filter: "match(severity,warning)",
+		},
+	})
+	if aer != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	if len(events) != 6 {
+		t.Errorf("expected 6 events, got %d", len(events))
+	}
+	if len(queries) != 3 {
+		t.Fatalf("expected 3 page requests, got %d", len(queries))
+	}
+	for i, q := range queries {
+		if q.Get("since") != "2020-01-01T00:00:00Z" || q.Get("from") != "2020-01-01T00:00:00Z" ||
+			q.Get("to") != "2020-01-02T00:00:00Z" || q.Get("filter") != "match(severity,warning)" {
+			t.Errorf("page %d lost its range bounds: %v", i, q)
+		}
+	}
+}
+
+func TestGetListTotalCount(t *testing.T) {
+	defer gock.OffAll()
+	mockCollection("/v1/initiators", 5, 2)
+	sdk := newTestSDK(t)
+
+	rs, aer, err := sdk.Conn.GetList(sdk.NewContext(), "initiators", &greq.RequestOptions{})
+	if aer != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	total, ok := rs.TotalCount()
+	if !ok || total != len(rs.Data) {
+		t.Errorf("expected a total count of %d, got %d (%v)", len(rs.Data), total, ok)
+	}
+}
+
+func TestGetListKeepsFirstPageMetadata(t *testing.T) {
+	defer gock.OffAll()
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/initiators").
+		MatchParam("offset", "2").
+		Reply(200).
+		JSON(dsdk.ApiListOuter{
+			Data:     []interface{}{map[string]interface{}{"name": "item-2"}},
+			Metadata: map[string]interface{}{"total_count": 3},
+		})
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/initiators").
+		Reply(200).
+		JSON(dsdk.ApiListOuter{
+			Data:     []interface{}{map[string]interface{}{"name": "item-0"}, map[string]interface{}{"name": "item-1"}},
+			Metadata: map[string]interface{}{"total_count": 3, "request_id": "first"},
+		})
+	sdk := newTestSDK(t)
+
+	rs, aer, err := sdk.Conn.GetList(sdk.NewContext(), "initiators", &greq.RequestOptions{})
+	if aer != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	if len(rs.Data) != 3 || rs.Metadata["request_id"] != "first" {
+		t.Errorf("expected 3 items with the first page's metadata, got %d items and %v", len(rs.Data), rs.Metadata)
+	}
+}
@@ -0,0 +1,33 @@
+//go:build go1.21
+// +build go1.21
+
+package dsdk_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+
+	greq "github.com/levigross/grequests"
+	dsdk "github.com/tjcelaya/go-datera/pkg/dsdk"
+	"gopkg.in/h2non/gock.v1"
+)
+
+func TestSlogLogger(t *testing.T) {
+	defer gock.OffAll()
+	buf := &bytes.Buffer{}
+	logger := slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	mockSystem()
+	sdk := newTestSDK(t, dsdk.WithLogger(dsdk.NewSlogLogger(logger)))
+
+	ctxt := context.WithValue(sdk.NewContext(), dsdk.UserLogFieldsCtxKey, map[string]interface{}{"job": "nightly"})
+	if _, aer, err := sdk.Conn.Get(ctxt, "system", &greq.RequestOptions{}); aer != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, `"msg":"Datera SDK response received"`) || !strings.Contains(out, `"job":"nightly"`) {
+		t.Errorf("expected the response to be logged with the user fields, got %s", out)
+	}
+}
@@ -0,0 +1,180 @@
+package dsdk_test
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+
+	greq "github.com/levigross/grequests"
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	dsdk "github.com/tjcelaya/go-datera/pkg/dsdk"
+	"gopkg.in/h2non/gock.v1"
+)
+
+type logEntry struct {
+	level  string
+	msg    string
+	fields map[string]interface{}
+}
+
+// fakeLogger records everything logged through it
+type fakeLogger struct {
+	m       sync.Mutex
+	entries []logEntry
+	debug   bool
+}
+
+func (f *fakeLogger) log(level, msg string, fields map[string]interface{}) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	f.entries = append(f.entries, logEntry{level: level, msg: msg, fields: fields})
+}
+
+func (f *fakeLogger) Debug(msg string, fields map[string]interface{}) { f.log("debug", msg, fields) }
+func (f *fakeLogger) Info(msg string, fields map[string]interface{})  { f.log("info", msg, fields) }
+func (f *fakeLogger) Error(msg string, fields map[string]interface{}) { f.log("error", msg, fields) }
+func (f *fakeLogger) DebugEnabled() bool                              { return f.debug }
+
+// find returns the first entry logged with msg for a request to route
+func (f *fakeLogger) find(msg, route string) (logEntry, bool) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	for _, e := range f.entries {
+		if e.msg == msg && e.fields["request_route"] == route {
+			return e, true
+		}
+	}
+	return logEntry{}, false
+}
+
+// mockSystem expects a single request for the system
+func mockSystem() {
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/system").
+		Reply(200).
+		JSON(dsdk.ApiOuter{Data: map[string]interface{}{"name": "the system"}})
+}
+
+func TestWithLogger(t *testing.T) {
+	defer gock.OffAll()
+	logger := &fakeLogger{debug: true}
+	mockSystem()
+	sdk := newTestSDK(t, dsdk.WithLogger(logger))
+
+	ctxt := context.WithValue(sdk.NewContext(), dsdk.UserLogFieldsCtxKey, map[string]interface{}{"job": "nightly"})
+	if _, aer, err := sdk.Conn.Get(ctxt, "system", &greq.RequestOptions{}); aer != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	for _, msg := range []string{"Datera SDK making request", "Datera SDK response received"} {
+		e, ok := logger.find(msg, "/v1/system")
+		if !ok {
+			t.Errorf("expected %q to be logged", msg)
+			continue
+		}
+		if e.level != "debug" || e.fields["job"] != "nightly" || e.fields["request_method"] != "GET" {
+			t.Errorf("expected %q at debug with the user and request fields, got %s %v", msg, e.level, e.fields)
+		}
+	}
+}
+
+func TestWithLoggerDebugDisabled(t *testing.T) {
+	defer gock.OffAll()
+	logger := &fakeLogger{}
+	mockSystem()
+	sdk := newTestSDK(t, dsdk.WithLogger(logger))
+
+	if _, aer, err := sdk.Conn.Get(sdk.NewContext(), "system", &greq.RequestOptions{}); aer != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	if _, ok := logger.find("Datera SDK making request", "/v1/system"); ok {
+		t.Error("expected the request details not to be built when debug logging is off")
+	}
+}
+
+func TestWithTraceID(t *testing.T) {
+	defer gock.OffAll()
+	logger := &fakeLogger{debug: true}
+	mockSystem()
+	sdk := newTestSDK(t, dsdk.WithLogger(logger))
+
+	ctxt := sdk.WithContext(dsdk.WithTraceID(context.Background(), "upstream-trace"))
+	if _, aer, err := sdk.Conn.Get(ctxt, "system", &greq.RequestOptions{}); aer != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	e, ok := logger.find("Datera SDK response received", "/v1/system")
+	if !ok || e.fields["trace_id"] != "upstream-trace" {
+		t.Errorf("expected the upstream trace id to be logged, got %v", e.fields["trace_id"])
+	}
+}
+
+func TestWithContextGeneratesTraceID(t *testing.T) {
+	defer gock.OffAll()
+	logger := &fakeLogger{debug: true}
+	mockSystem()
+	sdk := newTestSDK(t, dsdk.WithLogger(logger))
+
+	if _, aer, err := sdk.Conn.Get(sdk.WithContext(context.Background()), "system", &greq.RequestOptions{}); aer != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	e, ok := logger.find("Datera SDK response received", "/v1/system")
+	if tid, _ := e.fields["trace_id"].(string); !ok || tid == "" || tid == "nil" {
+		t.Errorf("expected a generated trace id, got %q", tid)
+	}
+}
+
+func TestWithQuiet(t *testing.T) {
+	defer gock.OffAll()
+	logger := &fakeLogger{debug: true}
+	mockSystem()
+	sdk := newTestSDK(t, dsdk.WithLogger(logger))
+
+	ctxt := dsdk.WithQuiet(sdk.NewContext())
+	if _, aer, err := sdk.Conn.Get(ctxt, "system", &greq.RequestOptions{JSON: map[string]string{"name": "bulk"}}); aer != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	req, ok := logger.find("Datera SDK making request", "/v1/system")
+	if !ok || req.fields["request_payload"] != "<muted>" {
+		t.Errorf("expected the request payload to be muted, got %v", req.fields["request_payload"])
+	}
+	resp, ok := logger.find("Datera SDK response received", "/v1/system")
+	if !ok || resp.fields["response_payload"] != "<muted>" {
+		t.Errorf("expected the response payload to be muted, got %v", resp.fields["response_payload"])
+	}
+}
+
+func TestLogrusLoggerCaller(t *testing.T) {
+	defer gock.OffAll()
+	logger := logrus.New()
+	logger.SetLevel(logrus.DebugLevel)
+	logger.Out = ioutil.Discard
+	hook := logtest.NewLocal(logger)
+	l := dsdk.NewLogrusLogger(logrus.NewEntry(logger))
+
+	// used directly, the caller is the one logging
+	l.Info("direct", nil)
+	if fn, _ := hook.LastEntry().Data["func"].(string); !strings.HasSuffix(fn, ".TestLogrusLoggerCaller") {
+		t.Errorf("expected the test as the caller, got %q", fn)
+	}
+	if file, _ := hook.LastEntry().Data["file"].(string); !strings.HasSuffix(file, "logger_test.go") {
+		t.Errorf("expected logger_test.go as the file, got %q", file)
+	}
+
+	// through the SDK it's the SDK code that logged, not its logger wrappers
+	hook.Reset()
+	mockSystem()
+	sdk := newTestSDK(t, dsdk.WithLogger(l))
+	if _, _, err := sdk.System.Get(&dsdk.SystemGetRequest{Ctxt: sdk.NewContext()}); err != nil {
+		t.Fatal(err)
+	}
+	if len(hook.AllEntries()) == 0 {
+		t.Fatal("expected the SDK to log the request")
+	}
+	for _, e := range hook.AllEntries() {
+		if fn, _ := e.Data["func"].(string); !strings.HasPrefix(fn, "github.com/tjcelaya/go-datera/pkg/dsdk.(*ApiConnection).") {
+			t.Errorf("expected %q to be attributed to SDK code, got %q", e.Message, fn)
+		}
+	}
+}
@@ -0,0 +1,356 @@
+package dsdk_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	udc "github.com/Datera/go-udc/pkg/udc"
+	dsdk "github.com/tjcelaya/go-datera/pkg/dsdk"
+	"gopkg.in/h2non/gock.v1"
+)
+
+// writeBundle writes a fake support bundle of size bytes and returns its name
+func writeBundle(t *testing.T, size int) string {
+	f, err := ioutil.TempFile("", "logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err = f.WriteString(strings.Repeat("x", size)); err != nil {
+		t.Fatal(err)
+	}
+	return f.Name()
+}
+
+func TestLogsUploadProgress(t *testing.T) {
+	defer gock.OffAll()
+	gock.New("http://127.0.0.1:7717").
+		Put("/v1/login").
+		Reply(200).
+		JSON(&dsdk.ApiLogin{Key: "thekey"})
+	var body string
+	gock.New("http://127.0.0.1:7717").
+		Put("/v1/logs_upload").
+		AddMatcher(func(req *http.Request, _ *gock.Request) (bool, error) {
+			b, err := ioutil.ReadAll(req.Body)
+			body = string(b)
+			return err == nil, err
+		}).
+		Reply(200)
+
+	bundle := writeBundle(t, 1<<20)
+	defer os.Remove(bundle)
+	sdk, err := dsdk.NewSDK(&udc.UDC{MgmtIp: "127.0.0.1", Username: "foo", Password: "bar", ApiVersion: "1"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sent []int64
+	var total int64
+	_, apierr, err := sdk.LogsUpload.Upload(&dsdk.LogsUploadRequest{
+		Ctxt:  sdk.NewContext(),
+		Files: []string{bundle},
+		Progress: func(s, tot int64) {
+			sent = append(sent, s)
+			total = tot
+		},
+	})
+	if apierr != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", apierr, err)
+	}
+	if !strings.Contains(body, strings.Repeat("x", 1<<20)) || !strings.Contains(body, `name="ecosystem"`) {
+		t.Fatalf("expected the bundle in a multipart form, got %d bytes", len(body))
+	}
+	if len(sent) < 2 || total != int64(len(body)) || sent[len(sent)-1] != total {
+		t.Fatalf("expected progress up to the %d byte body, got %v of %d", len(body), sent, total)
+	}
+	for i := 1; i < len(sent); i++ {
+		if sent[i] <= sent[i-1] {
+			t.Fatalf("expected increasing progress, got %v", sent)
+		}
+	}
+}
+
+func TestLogsUploadCancel(t *testing.T) {
+	defer gock.OffAll()
+	gock.New("http://127.0.0.1:7717").
+		Put("/v1/login").
+		Reply(200).
+		JSON(&dsdk.ApiLogin{Key: "thekey"})
+	gock.New("http://127.0.0.1:7717").
+		Put("/v1/logs_upload").
+		AddMatcher(func(req *http.Request, _ *gock.Request) (bool, error) {
+			_, err := ioutil.ReadAll(req.Body)
+			return err == nil, err
+		}).
+		Reply(200)
+
+	bundle := writeBundle(t, 8<<20)
+	defer os.Remove(bundle)
+	sdk, err := dsdk.NewSDK(&udc.UDC{MgmtIp: "127.0.0.1", Username: "foo", Password: "bar", ApiVersion: "1"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctxt, cancel := context.WithCancel(sdk.NewContext())
+	defer cancel()
+	var sent int64
+	t1 := time.Now()
+	_, _, err = sdk.LogsUpload.Upload(&dsdk.LogsUploadRequest{
+		Ctxt:  ctxt,
+		Files: []string{bundle},
+		Progress: func(s, _ int64) {
+			sent = s
+			cancel()
+		},
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the upload to be cancelled, got %v", err)
+	}
+	if sent >= 8<<20 || time.Since(t1) > time.Second {
+		t.Errorf("expected the upload to stop promptly, sent %d bytes in %s", sent, time.Since(t1))
+	}
+}
+
+func TestLogsUploadReader(t *testing.T) {
+	bundle := []byte(strings.Repeat("bundle", 1000))
+	for _, size := range []int64{int64(len(bundle)), -1} {
+		gock.New("http://127.0.0.1:7717").
+			Put("/v1/login").
+			Reply(200).
+			JSON(&dsdk.ApiLogin{Key: "thekey"})
+		var (
+			got    []byte
+			length int64
+		)
+		gock.New("http://127.0.0.1:7717").
+			Put("/v1/logs_upload").
+			AddMatcher(func(req *http.Request, _ *gock.Request) (bool, error) {
+				length = req.ContentLength
+				mr, err := req.MultipartReader()
+				if err != nil {
+					return false, err
+				}
+				for {
+					part, err := mr.NextPart()
+					if err != nil {
+						return false, err
+					}
+					if part.FileName() == "support.tar.gz" {
+						got, err = ioutil.ReadAll(part)
+						return err == nil, err
+					}
+				}
+			}).
+			Reply(200)
+
+		sdk, err := dsdk.NewSDK(&udc.UDC{MgmtIp: "127.0.0.1", Username: "foo", Password: "bar", ApiVersion: "1"}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		apierr, err := sdk.LogsUpload.UploadReader(sdk.NewContext(), "support.tar.gz", bytes.NewReader(bundle), size)
+		if apierr != nil || err != nil {
+			t.Fatalf("size %d: unexpected error: %v %v", size, apierr, err)
+		}
+		if !bytes.Equal(got, bundle) {
+			t.Errorf("size %d: expected the server to receive the bundle, got %d bytes", size, len(got))
+		}
+		if size < 0 && length != -1 {
+			t.Errorf("expected an unknown size to be sent chunked, got length %d", length)
+		}
+		if size >= 0 && length <= size {
+			t.Errorf("expected a known size to set the content length, got %d", length)
+		}
+		gock.OffAll()
+	}
+}
+
+func TestLogsUploadChunked(t *testing.T) {
+	defer gock.OffAll()
+	gock.New("http://127.0.0.1:7717").
+		Put("/v1/logs_upload").
+		MatchParam("part", "^2$").
+		Reply(503)
+	var (
+		sent     []string
+		received = map[string]string{}
+	)
+	gock.New("http://127.0.0.1:7717").
+		Put("/v1/logs_upload").
+		MatchParam("parts", "^3$").
+		AddMatcher(func(req *http.Request, _ *gock.Request) (bool, error) {
+			f, _, err := req.FormFile("logs.tar.gz")
+			if err != nil {
+				return false, err
+			}
+			b, err := ioutil.ReadAll(f)
+			received[req.URL.Query().Get("part")] = string(b)
+			return err == nil, err
+		}).
+		Persist().
+		Reply(200)
+	gock.Observe(func(req *http.Request, _ gock.Mock) {
+		if req.URL.Path == "/v1/logs_upload" {
+			sent = append(sent, req.URL.Query().Get("part"))
+		}
+	})
+	defer gock.Observe(nil)
+
+	bundle := writeBundle(t, 25)
+	defer os.Remove(bundle)
+	sdk := newTestSDK(t, dsdk.WithBackoffStrategy(&constantBackoff{interval: time.Millisecond}))
+	state, apierr, err := sdk.LogsUpload.UploadChunked(&dsdk.LogsUploadChunkedRequest{
+		Ctxt:      sdk.NewContext(),
+		File:      bundle,
+		ChunkSize: 10,
+	})
+	if apierr != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", apierr, err)
+	}
+	if strings.Join(sent, ",") != "1,2,2,3" {
+		t.Errorf("expected only part 2 to be re-sent, got parts %v", sent)
+	}
+	if received["1"] != strings.Repeat("x", 10) || received["2"] != strings.Repeat("x", 10) || received["3"] != strings.Repeat("x", 5) {
+		t.Errorf("unexpected parts: %v", received)
+	}
+	if state.Parts != 3 || len(state.Uploaded) != 3 {
+		t.Errorf("expected all 3 parts uploaded, got %+v", state)
+	}
+
+	// resuming a finished upload has nothing left to send
+	sent = nil
+	if _, apierr, err = sdk.LogsUpload.UploadChunked(&dsdk.LogsUploadChunkedRequest{
+		Ctxt:      sdk.NewContext(),
+		File:      bundle,
+		ChunkSize: 10,
+		Resume:    state,
+	}); apierr != nil || err != nil || len(sent) != 0 {
+		t.Errorf("expected resuming to send nothing, sent %v: %v %v", sent, apierr, err)
+	}
+}
+
+func TestLogsUploadChunkedRetryBudget(t *testing.T) {
+	defer gock.OffAll()
+	for _, part := range []string{"1", "1", "2"} {
+		gock.New("http://127.0.0.1:7717").
+			Put("/v1/logs_upload").
+			MatchParam("part", "^"+part+"$").
+			Reply(503)
+	}
+	gock.New("http://127.0.0.1:7717").
+		Put("/v1/logs_upload").
+		Persist().
+		Reply(200)
+	var sent []string
+	gock.Observe(func(req *http.Request, _ gock.Mock) {
+		if req.URL.Path == "/v1/logs_upload" {
+			sent = append(sent, req.URL.Query().Get("part"))
+		}
+	})
+	defer gock.Observe(nil)
+
+	bundle := writeBundle(t, 30)
+	defer os.Remove(bundle)
+	// part 1 spends both banked retries, and the parts uploaded so far don't earn part 2
+	// another
+	sdk := newTestSDK(t,
+		dsdk.WithBackoffStrategy(&constantBackoff{interval: time.Millisecond}),
+		dsdk.WithRetryBudget(1, 2))
+	_, _, err := sdk.LogsUpload.UploadChunked(&dsdk.LogsUploadChunkedRequest{
+		Ctxt:      sdk.NewContext(),
+		File:      bundle,
+		ChunkSize: 10,
+	})
+	if !errors.Is(err, dsdk.ErrRetryBudgetExhausted) {
+		t.Errorf("expected ErrRetryBudgetExhausted, got %v", err)
+	}
+	if strings.Join(sent, ",") != "1,1,1,2" {
+		t.Errorf("expected part 2 not to be retried, got parts %v", sent)
+	}
+}
+
+func TestLogsUploadChunkedFailsFast(t *testing.T) {
+	defer gock.OffAll()
+	gock.New("http://127.0.0.1:7717").
+		Put("/v1/logs_upload").
+		Reply(413).
+		JSON(map[string]interface{}{"name": "RequestEntityTooLarge", "message": "part too large"})
+	sent := 0
+	gock.Observe(func(req *http.Request, _ gock.Mock) {
+		if req.URL.Path == "/v1/logs_upload" {
+			sent++
+		}
+	})
+	defer gock.Observe(nil)
+
+	bundle := writeBundle(t, 25)
+	defer os.Remove(bundle)
+	sdk := newTestSDK(t, dsdk.WithBackoffStrategy(&constantBackoff{interval: time.Millisecond}))
+	state, apierr, err := sdk.LogsUpload.UploadChunked(&dsdk.LogsUploadChunkedRequest{
+		Ctxt:      sdk.NewContext(),
+		File:      bundle,
+		ChunkSize: 10,
+	})
+	if err != nil || apierr == nil || apierr.Http != 413 || apierr.Message != "part too large" {
+		t.Errorf("expected the 413 as an ApiErrorResponse, got %v %v", apierr, err)
+	}
+	if sent != 1 || len(state.Uploaded) != 0 {
+		t.Errorf("expected a single attempt and no parts uploaded, sent %d, state %+v", sent, state)
+	}
+}
+
+func TestLogsUploadChunkedReauth(t *testing.T) {
+	defer gock.OffAll()
+	sdk := newTestSDKInTenant(t, "/root/t1", dsdk.WithMaxAttempts(1))
+	// the session expires after part 1
+	gock.New("http://127.0.0.1:7717").
+		Put("/v1/logs_upload").
+		MatchHeader("Auth-Token", "^thekey$").
+		MatchHeader("tenant", "^/root/t1$").
+		MatchParam("part", "^1$").
+		Reply(200)
+	gock.New("http://127.0.0.1:7717").
+		Put("/v1/logs_upload").
+		MatchHeader("Auth-Token", "^thekey$").
+		Reply(401).
+		JSON(map[string]interface{}{"name": "AuthFailedError", "http": 401})
+	gock.New("http://127.0.0.1:7717").
+		Put("/v1/login").
+		Reply(200).
+		JSON(&dsdk.ApiLogin{Key: "newkey"})
+	gock.New("http://127.0.0.1:7717").
+		Put("/v1/logs_upload").
+		MatchHeader("Auth-Token", "^newkey$").
+		MatchHeader("tenant", "^/root/t1$").
+		Times(2).
+		Reply(200)
+	var sent []string
+	gock.Observe(func(req *http.Request, _ gock.Mock) {
+		if req.URL.Path == "/v1/logs_upload" {
+			sent = append(sent, req.URL.Query().Get("part"))
+		}
+	})
+	defer gock.Observe(nil)
+
+	bundle := writeBundle(t, 25)
+	defer os.Remove(bundle)
+	state, apierr, err := sdk.LogsUpload.UploadChunked(&dsdk.LogsUploadChunkedRequest{
+		Ctxt:      sdk.NewContext(),
+		File:      bundle,
+		ChunkSize: 10,
+	})
+	if apierr != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", apierr, err)
+	}
+	if strings.Join(sent, ",") != "1,2,2,3" || len(state.Uploaded) != 3 {
+		t.Errorf("expected part 2 re-sent with the new session, got parts %v, state %+v", sent, state)
+	}
+	if !gock.IsDone() {
+		t.Errorf("expected parts 2 and 3 sent after a second login, pending: %v", gock.Pending())
+	}
+}
@@ -0,0 +1,246 @@
+package dsdk_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	dsdk "github.com/tjcelaya/go-datera/pkg/dsdk"
+	"gopkg.in/h2non/gock.v1"
+)
+
+func TestIOMetricsRange(t *testing.T) {
+	defer gock.OffAll()
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/app_instances/ai-1/storage_instances/si-1/volumes/vol-1/metrics/io/iops_write$").
+		MatchParam("from", "^2020-01-01T00:00:00Z$").
+		MatchParam("to", "^2020-01-02T00:00:00Z$").
+		Reply(200).
+		JSON(map[string]interface{}{
+			"data": []map[string]interface{}{{
+				"entity_path": "/app_instances/ai-1/storage_instances/si-1/volumes/vol-1",
+				"points": []map[string]interface{}{
+					{"time": 1577840460, "value": 12.5},
+					{"time": 1577840400, "value": 10},
+				},
+			}},
+		})
+
+	sdk := newTestSDK(t)
+	vol := "/app_instances/ai-1/storage_instances/si-1/volumes/vol-1"
+	series, aer, err := sdk.IOMetrics.Range(sdk.NewContext(), dsdk.IOPSWrite, vol, dsdk.ListRangeParams{
+		From: "2020-01-01T00:00:00Z",
+		To:   "2020-01-02T00:00:00Z",
+	})
+	if aer != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	if series.Metric != dsdk.IOPSWrite || series.Object != vol || series.EntityPath != vol {
+		t.Errorf("unexpected series: %+v", series)
+	}
+	want := []dsdk.Point{{Time: 1577840400, Value: 10}, {Time: 1577840460, Value: 12.5}}
+	if len(series.Points) != len(want) {
+		t.Fatalf("expected %v, got %v", want, series.Points)
+	}
+	for i := range want {
+		if series.Points[i] != want[i] {
+			t.Errorf("expected %v, got %v", want, series.Points)
+		}
+	}
+
+	_, _, err = sdk.IOMetrics.Range(sdk.NewContext(), dsdk.IOPSWrite, vol, dsdk.ListRangeParams{
+		From: "1577923200",
+		To:   "2020-01-01T00:00:00Z",
+	})
+	if !errors.Is(err, dsdk.ErrInvalidRequest) {
+		t.Errorf("expected a reversed range to be rejected, got %v", err)
+	}
+	if gock.HasUnmatchedRequest() {
+		t.Errorf("unexpected requests: %v", gock.GetUnmatchedRequests())
+	}
+}
+
+func TestSummarizePoints(t *testing.T) {
+	hundred := make([]dsdk.Point, 100)
+	for i := range hundred {
+		// 100 down to 1, out of order on purpose
+		hundred[i] = dsdk.Point{Time: int64(i), Value: float64(100 - i)}
+	}
+	tests := []struct {
+		name   string
+		points []dsdk.Point
+		want   dsdk.MetricSummary
+	}{
+		{"empty", nil, dsdk.MetricSummary{}},
+		{"single", []dsdk.Point{{Time: 1, Value: 7}}, dsdk.MetricSummary{Count: 1, Avg: 7, Max: 7, P95: 7, P99: 7}},
+		{"small", []dsdk.Point{{Value: 4}, {Value: 1}, {Value: 3}, {Value: 2}},
+			dsdk.MetricSummary{Count: 4, Avg: 2.5, Max: 4, P95: 4, P99: 4}},
+		{"hundred", hundred, dsdk.MetricSummary{Count: 100, Avg: 50.5, Max: 100, P95: 95, P99: 99}},
+	}
+	for _, tc := range tests {
+		if got := dsdk.SummarizePoints(tc.points); got != tc.want {
+			t.Errorf("%s: expected %+v, got %+v", tc.name, tc.want, got)
+		}
+	}
+	series := &dsdk.MetricSeries{Points: hundred}
+	if got := series.Summary(); got.P95 != 95 {
+		t.Errorf("expected the series summary to match, got %+v", got)
+	}
+}
+
+func TestIOMetricsScoped(t *testing.T) {
+	defer gock.OffAll()
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/storage_nodes/sn-1/metrics/io/reads$").
+		Reply(200).
+		JSON(map[string]interface{}{"data": []map[string]interface{}{{
+			"entity_path": "/storage_nodes/sn-1",
+			"points":      []map[string]interface{}{{"time": 1, "value": 3}},
+		}}})
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/app_instances/ai-1/storage_instances/si-1/volumes/vol-1/metrics/hw/cpu_usage$").
+		Reply(200).
+		JSON(map[string]interface{}{"data": []map[string]interface{}{}})
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/storage_nodes/missing/metrics/io/reads$").
+		Reply(404).
+		JSON(map[string]interface{}{"name": "NotFoundError", "message": "not found", "code": 404})
+
+	sdk := newTestSDK(t)
+	ms, aer, err := sdk.IOMetrics.ForStorageNode("sn-1").List(&dsdk.IOMetricsRequest{Ctxt: sdk.NewContext(), Type: dsdk.Reads})
+	if aer != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	if len(ms) != 1 || ms[0].EntityPath != "/storage_nodes/sn-1" {
+		t.Errorf("unexpected storage node metrics: %+v", ms)
+	}
+	vol := "/app_instances/ai-1/storage_instances/si-1/volumes/vol-1"
+	if _, aer, err = sdk.HWMetrics.ForPath(vol).List(&dsdk.HWMetricsRequest{Ctxt: sdk.NewContext(), Type: dsdk.CPUUsage}); aer != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	_, aer, err = sdk.IOMetrics.ForStorageNode("missing").List(&dsdk.IOMetricsRequest{Ctxt: sdk.NewContext(), Type: dsdk.Reads})
+	if aer == nil || !dsdk.IsNotFound(err) || !strings.Contains(err.Error(), "/storage_nodes/missing/metrics/io/reads") {
+		t.Errorf("expected a missing storage node to be not found, got %v %v", aer, err)
+	}
+	// scopes nest, so an object under a storage node is relative to it
+	if got := sdk.IOMetrics.ForStorageNode("sn-1").ForPath("nics/nic-0").Path; got != "/storage_nodes/sn-1/nics/nic-0/metrics/io" {
+		t.Errorf("unexpected nested metrics path %s", got)
+	}
+	if gock.HasUnmatchedRequest() {
+		t.Errorf("unexpected requests: %v", gock.GetUnmatchedRequests())
+	}
+}
+
+// mockSlowMetrics mocks the reads metrics of n volumes, each taking delay to answer, and
+// returns the most requests that were in flight at once
+func mockSlowMetrics(n int, delay time.Duration) func() int {
+	var (
+		m        sync.Mutex
+		inflight int
+		peak     int
+	)
+	slow := func(res *http.Response) *http.Response {
+		m.Lock()
+		inflight++
+		if inflight > peak {
+			peak = inflight
+		}
+		m.Unlock()
+		time.Sleep(delay)
+		m.Lock()
+		inflight--
+		m.Unlock()
+		return res
+	}
+	for i := 0; i < n; i++ {
+		gock.New("http://127.0.0.1:7717").
+			Get(fmt.Sprintf("/v1/volumes/vol-%d/metrics/io/reads$", i)).
+			Reply(200).
+			Map(slow).
+			JSON(map[string]interface{}{"data": []map[string]interface{}{{
+				"entity_path": fmt.Sprintf("/volumes/vol-%d", i),
+				"points":      []map[string]interface{}{{"time": 1, "value": i}},
+			}}})
+	}
+	return func() int {
+		m.Lock()
+		defer m.Unlock()
+		return peak
+	}
+}
+
+func TestIOMetricsGetMany(t *testing.T) {
+	defer gock.OffAll()
+	peak := mockSlowMetrics(6, 20*time.Millisecond)
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/volumes/missing/metrics/io/reads$").
+		Reply(404).
+		JSON(map[string]interface{}{"name": "NotFoundError", "message": "not found", "code": 404})
+
+	sdk := newTestSDK(t)
+	objects := []string{"/volumes/missing"}
+	for i := 0; i < 6; i++ {
+		objects = append(objects, fmt.Sprintf("/volumes/vol-%d", i))
+	}
+	res, err := sdk.IOMetrics.GetMany(sdk.NewContext(), dsdk.Reads, objects, 2)
+	bulk, ok := err.(*dsdk.BulkError)
+	if !ok || len(bulk.Errors) != 1 || !dsdk.IsNotFound(bulk.Errors["/volumes/missing"]) {
+		t.Fatalf("expected only the missing volume to fail, got %v", err)
+	}
+	if len(res) != 6 {
+		t.Fatalf("expected metrics for 6 volumes, got %d", len(res))
+	}
+	for i := 0; i < 6; i++ {
+		obj := fmt.Sprintf("/volumes/vol-%d", i)
+		if ms := res[obj]; len(ms) != 1 || ms[0].Points[0].Value != float64(i) {
+			t.Errorf("unexpected metrics for %s: %+v", obj, ms)
+		}
+	}
+	if p := peak(); p > 2 {
+		t.Errorf("expected at most 2 requests in flight, got %d", p)
+	}
+}
+
+func TestIOMetricsGetManyCancel(t *testing.T) {
+	defer gock.OffAll()
+	mockSlowMetrics(20, 20*time.Millisecond)
+
+	sdk := newTestSDK(t)
+	objects := []string{}
+	for i := 0; i < 20; i++ {
+		objects = append(objects, fmt.Sprintf("/volumes/vol-%d", i))
+	}
+	ctxt, cancel := context.WithTimeout(sdk.NewContext(), 50*time.Millisecond)
+	defer cancel()
+	t1 := time.Now()
+	res, err := sdk.IOMetrics.GetMany(ctxt, dsdk.Reads, objects, 1)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the deadline to abort the fetch, got %v", err)
+	}
+	if len(res) >= len(objects) || time.Since(t1) > 200*time.Millisecond {
+		t.Errorf("expected the fetch to stop early, got %d results in %s", len(res), time.Since(t1))
+	}
+}
+
+func TestFormatPrometheus(t *testing.T) {
+	ms := []*dsdk.Metrics{
+		{EntityPath: "/storage_nodes/sn-1", Tenant: "/root", Points: []dsdk.Point{{Time: 1, Value: 1000}, {Time: 2, Value: 1500}}},
+		{EntityPath: "/app_instances/ai-1/storage_instances/si-1/volumes/vol-1", Tenant: "/root/sub",
+			Points: []dsdk.Point{{Time: 3, Value: 12.5}, {Time: 2, Value: 11}}},
+		{EntityPath: "/app_instances/ai-2/storage_instances/si-1/volumes/vol-1", Tenant: "/root"},
+		{Tenant: `/root/"odd"`, Points: []dsdk.Point{{Time: 1, Value: 0.25}}},
+	}
+	golden, err := ioutil.ReadFile("testdata/metrics.prom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := dsdk.FormatPrometheus(dsdk.IOPSWrite.PrometheusName(), ms); got != string(golden) {
+		t.Errorf("expected\n%s\ngot\n%s", golden, got)
+	}
+}
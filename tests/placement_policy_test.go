@@ -0,0 +1,78 @@
+package dsdk_test
+
+import (
+	"testing"
+
+	dsdk "github.com/tjcelaya/go-datera/pkg/dsdk"
+	"gopkg.in/h2non/gock.v1"
+)
+
+func TestPlacementPolicyCreate(t *testing.T) {
+	defer gock.OffAll()
+	gock.New("http://127.0.0.1:7717").
+		Post("/v1/placement_policies$").
+		JSON(map[string]interface{}{"name": "fast", "descr": "all flash", "max": []string{"all-flash"}, "min": []string{"all-flash"}}).
+		Reply(200).
+		JSON(map[string]interface{}{"data": map[string]interface{}{
+			"path": "/placement_policies/fast", "name": "fast", "descr": "all flash",
+			"max": []string{"all-flash"}, "min": []string{"all-flash"},
+		}})
+
+	sdk := newTestSDK(t)
+	pp, apierr, err := sdk.PlacementPolicies.Create(&dsdk.PlacementPoliciesCreateRequest{
+		Ctxt:  sdk.NewContext(),
+		Name:  "fast",
+		Descr: "all flash",
+		Max:   []string{"all-flash"},
+		Min:   []string{"all-flash"},
+	})
+	if apierr != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", apierr, err)
+	}
+	if pp.Path != "/placement_policies/fast" || pp.Name != "fast" {
+		t.Errorf("unexpected placement policy: %+v", pp)
+	}
+}
+
+func TestPlacementPolicyAttach(t *testing.T) {
+	defer gock.OffAll()
+	si := "/app_instances/ai-1/storage_instances/si-1"
+	mockSI := func(vol1Policy string) {
+		gock.New("http://127.0.0.1:7717").
+			Get("/v1" + si + "$").
+			Reply(200).
+			JSON(map[string]interface{}{"data": map[string]interface{}{
+				"path": si,
+				"name": "si-1",
+				"volumes": []map[string]interface{}{
+					{"path": si + "/volumes/vol-1", "name": "vol-1", "placement_policy": map[string]interface{}{"path": vol1Policy}},
+					{"path": si + "/volumes/vol-2", "name": "vol-2", "placement_policy": map[string]interface{}{"path": "/placement_policies/fast"}},
+				},
+			}})
+	}
+	mockSI("/placement_policies/default")
+	gock.New("http://127.0.0.1:7717").
+		Put("/v1" + si + "/volumes/vol-1$").
+		JSON(map[string]interface{}{"placement_policy": map[string]interface{}{
+			"path": "/placement_policies/fast", "resolved_path": "", "resolved_tenant": "",
+		}}).
+		Reply(200).
+		JSON(map[string]interface{}{"data": map[string]interface{}{"path": si + "/volumes/vol-1", "name": "vol-1"}})
+
+	sdk := newTestSDK(t)
+	if apierr, err := sdk.PlacementPolicies.Attach(sdk.NewContext(), "fast", si); apierr != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", apierr, err)
+	}
+	if !gock.IsDone() {
+		t.Errorf("expected vol-1 to be updated, pending mocks: %v", gock.Pending())
+	}
+
+	// attaching again finds every volume already using the policy
+	mockSI("/placement_policies/fast")
+	if apierr, err := sdk.PlacementPolicies.Attach(sdk.NewContext(), "fast", si); apierr != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", apierr, err)
+	}
+	if gock.HasUnmatchedRequest() {
+		t.Errorf("unexpected requests: %v", gock.GetUnmatchedRequests())
+	}
+}
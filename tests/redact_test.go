@@ -0,0 +1,49 @@
+package dsdk_test
+
+import (
+	"testing"
+
+	udc "github.com/Datera/go-udc/pkg/udc"
+	greq "github.com/levigross/grequests"
+	dsdk "github.com/tjcelaya/go-datera/pkg/dsdk"
+	"gopkg.in/h2non/gock.v1"
+)
+
+func TestWithRedactedFields(t *testing.T) {
+	defer gock.OffAll()
+	gock.New("http://127.0.0.1:7717").
+		Put("/v1/login").
+		Reply(200).
+		JSON(&dsdk.ApiLogin{Key: "thekey"})
+	gock.New("http://127.0.0.1:7717").
+		Post("/v1/app_instances").
+		Reply(200).
+		JSON(dsdk.ApiOuter{Data: map[string]interface{}{"name": "my-app"}})
+	logger := &fakeLogger{debug: true}
+	sdk, err := dsdk.NewSDK(&udc.UDC{
+		MgmtIp:     "127.0.0.1",
+		Username:   "foo",
+		Password:   "bar",
+		ApiVersion: "1",
+	}, false, dsdk.WithLogger(logger), dsdk.WithRedactedFields("api_token"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ro := &greq.RequestOptions{JSON: map[string]interface{}{
+		"name":      "my-app",
+		"api_token": "abc",
+		"password":  "hunter2",
+	}}
+	if _, aer, err := sdk.Conn.Post(sdk.NewContext(), "app_instances", ro); aer != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	e, ok := logger.find("Datera SDK making request", "/v1/app_instances")
+	if !ok {
+		t.Fatal("expected the request to be logged")
+	}
+	want := `{"api_token":"********","name":"my-app","password":"********"}`
+	if e.fields["request_payload"] != want {
+		t.Errorf("expected payload %s, got %v", want, e.fields["request_payload"])
+	}
+}
@@ -0,0 +1,141 @@
+package dsdk_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	dsdk "github.com/tjcelaya/go-datera/pkg/dsdk"
+	"gopkg.in/h2non/gock.v1"
+)
+
+func TestRemoteProviderCreate(t *testing.T) {
+	defer gock.OffAll()
+	gock.New("http://127.0.0.1:7717").
+		Post("/v1/remote_providers$").
+		JSON(map[string]interface{}{
+			"remote_type": dsdk.ProviderS3,
+			"label":       "dr",
+			"host":        "s3.example.com",
+			"port":        443,
+			"bucket":      "backups",
+			"access_key":  "AKID",
+			"secret_key":  "s3cr3t",
+		}).
+		Reply(200).
+		JSON(map[string]interface{}{"data": map[string]interface{}{
+			"path": "/remote_providers/rp-1", "uuid": "rp-1", "label": "dr", "remote_type": dsdk.ProviderS3,
+			"host": "s3.example.com", "port": 443, "bucket": "backups",
+		}})
+
+	logger := &fakeLogger{debug: true}
+	sdk := newTestSDK(t, dsdk.WithLogger(logger))
+	rp, apierr, err := sdk.RemoteProvider.Create(&dsdk.RemoteProvidersCreateRequest{
+		Ctxt:       sdk.NewContext(),
+		RemoteType: dsdk.ProviderS3,
+		Label:      "dr",
+		Host:       "s3.example.com",
+		Port:       443,
+		Bucket:     "backups",
+		AccessKey:  "AKID",
+		SecretKey:  "s3cr3t",
+	})
+	if apierr != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", apierr, err)
+	}
+	if rp.Uuid != "rp-1" || rp.Bucket != "backups" || rp.Host != "s3.example.com" {
+		t.Errorf("unexpected remote provider: %+v", rp)
+	}
+
+	e, ok := logger.find("Datera SDK making request", "/v1/remote_providers")
+	if !ok {
+		t.Fatal("expected the request to be logged")
+	}
+	payload := fmt.Sprint(e.fields["request_payload"])
+	if !strings.Contains(payload, `"secret_key":"********"`) || !strings.Contains(payload, `"bucket":"backups"`) {
+		t.Errorf("expected the secret key to be masked, got %s", payload)
+	}
+	logger.m.Lock()
+	defer logger.m.Unlock()
+	for _, e := range logger.entries {
+		if strings.Contains(fmt.Sprint(e.fields), "s3cr3t") {
+			t.Errorf("secret key logged in %q: %v", e.msg, e.fields)
+		}
+	}
+}
+
+func TestRemoteProviderTestConnection(t *testing.T) {
+	defer gock.OffAll()
+	gock.New("http://127.0.0.1:7717").
+		Put("/v1/remote_providers/rp-1/test_connection$").
+		Reply(200).
+		JSON(map[string]interface{}{"data": map[string]interface{}{"status": "ok"}})
+	gock.New("http://127.0.0.1:7717").
+		Put("/v1/remote_providers/rp-2/test_connection$").
+		Reply(200).
+		JSON(map[string]interface{}{"data": map[string]interface{}{"status": "failed", "message": "403 Forbidden from s3.example.com"}})
+	gock.New("http://127.0.0.1:7717").
+		Put("/v1/remote_providers/rp-3/test_connection$").
+		Reply(422).
+		JSON(map[string]interface{}{"name": "ValidationError", "message": "host unreachable", "code": 422})
+	sdk := newTestSDK(t)
+	res, apierr, err := sdk.RemoteProvider.TestConnection(sdk.NewContext(), "rp-1")
+	if apierr != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", apierr, err)
+	}
+	if !res.Ok || res.Error != "" || res.Latency <= 0 {
+		t.Errorf("expected a passing check, got %+v", res)
+	}
+
+	res, apierr, err = sdk.RemoteProvider.TestConnection(sdk.NewContext(), "rp-2")
+	if apierr != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", apierr, err)
+	}
+	if res.Ok || res.Error != "403 Forbidden from s3.example.com" {
+		t.Errorf("expected a failed check, got %+v", res)
+	}
+
+	res, apierr, _ = sdk.RemoteProvider.TestConnection(sdk.NewContext(), "rp-3")
+	if apierr == nil || res == nil || res.Ok || res.Error != "host unreachable" {
+		t.Errorf("expected a rejected check, got %+v %v", res, apierr)
+	}
+}
+
+func TestRemoteProviderTestConnectionTimeout(t *testing.T) {
+	// a real server, since gock doesn't abandon delayed replies when the request is cancelled
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/login" {
+			json.NewEncoder(w).Encode(&dsdk.ApiLogin{Key: "thekey"})
+			return
+		}
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer srv.Close()
+	port, err := strconv.Atoi(srv.URL[strings.LastIndex(srv.URL, ":")+1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sdk := newTestSDK(t, dsdk.WithPort(port))
+	// srv answers the login itself, so nothing should be intercepted
+	gock.OffAll()
+	ctxt, cancel := context.WithTimeout(sdk.NewContext(), 100*time.Millisecond)
+	defer cancel()
+	t1 := time.Now()
+	res, apierr, err := sdk.RemoteProvider.TestConnection(ctxt, "rp-1")
+	if !errors.Is(err, context.DeadlineExceeded) || res != nil {
+		t.Errorf("expected the check to time out, got %+v %v", res, apierr)
+	}
+	if elapsed := time.Since(t1); elapsed > 2*time.Second {
+		t.Errorf("expected the check to stop at the context deadline, took %s", elapsed)
+	}
+}
@@ -0,0 +1,85 @@
+package dsdk_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	udc "github.com/Datera/go-udc/pkg/udc"
+	greq "github.com/levigross/grequests"
+	dsdk "github.com/tjcelaya/go-datera/pkg/dsdk"
+	"gopkg.in/h2non/gock.v1"
+)
+
+// fakeSink counts requests and errors by method, route and status
+type fakeSink struct {
+	m        sync.Mutex
+	requests map[string]int
+	errors   map[string]int
+}
+
+func (f *fakeSink) ObserveRequest(m dsdk.RequestMetric) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	key := fmt.Sprintf("%s %s %d", m.Method, m.Route, m.Status)
+	f.requests[key]++
+	if m.Err != nil {
+		f.errors[key]++
+	}
+	if m.Duration <= 0 {
+		f.errors["no duration"]++
+	}
+}
+
+func TestWithMetricsSink(t *testing.T) {
+	defer gock.OffAll()
+	sink := &fakeSink{requests: map[string]int{}, errors: map[string]int{}}
+	gock.New("http://127.0.0.1:7717").
+		Put("/v1/login").
+		Reply(200).
+		JSON(&dsdk.ApiLogin{Key: "thekey"})
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/app_instances/.+").
+		Times(4).
+		Reply(200).
+		JSON(dsdk.ApiOuter{Data: map[string]interface{}{"name": "my-app"}})
+	gock.New("http://127.0.0.1:7717").
+		Delete("/v1/app_instances/.+").
+		Reply(400).
+		JSON(dsdk.ApiErrorResponse{Message: "bad request", Http: 400})
+	sdk, err := dsdk.NewSDK(&udc.UDC{
+		MgmtIp:     "127.0.0.1",
+		Username:   "foo",
+		Password:   "bar",
+		ApiVersion: "1",
+	}, false, dsdk.WithMetricsSink(sink))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, aer, err := sdk.Conn.Get(sdk.NewContext(), "app_instances/first", &greq.RequestOptions{}); aer != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sdk.Conn.Get(sdk.NewContext(), fmt.Sprintf("app_instances/app-%d", i), &greq.RequestOptions{})
+		}(i)
+	}
+	wg.Wait()
+	sdk.Conn.Delete(sdk.NewContext(), "app_instances/first", &greq.RequestOptions{})
+
+	expected := map[string]int{
+		"PUT /v1/login 200":                1,
+		"GET /v1/app_instances/:id 200":    4,
+		"DELETE /v1/app_instances/:id 400": 1,
+	}
+	if fmt.Sprint(sink.requests) != fmt.Sprint(expected) {
+		t.Errorf("expected requests %v, got %v", expected, sink.requests)
+	}
+	if fmt.Sprint(sink.errors) != fmt.Sprint(map[string]int{"DELETE /v1/app_instances/:id 400": 1}) {
+		t.Errorf("expected only the delete to count as an error, got %v", sink.errors)
+	}
+}
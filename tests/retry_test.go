@@ -0,0 +1,649 @@
+package dsdk_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Datera/go-udc/pkg/udc"
+	greq "github.com/levigross/grequests"
+	dsdk "github.com/tjcelaya/go-datera/pkg/dsdk"
+	"gopkg.in/h2non/gock.v1"
+)
+
+// mockAlways503 registers a successful login followed by a system endpoint that
+// is permanently overloaded for the given host
+func mockAlways503(host string) {
+	gock.New(host).
+		Put("/v1/login").
+		Persist().
+		Reply(200).
+		JSON(&dsdk.ApiLogin{Key: "thekey"})
+	gock.New(host).
+		Get("/v1/system").
+		Persist().
+		Reply(503).
+		JSON(&dsdk.ApiErrorResponse{Message: "overloaded"})
+}
+
+func TestPerConnectionRetryTimeout(t *testing.T) {
+	defer gock.OffAll()
+	mockAlways503("http://127.0.0.1:7717")
+	mockAlways503("http://127.0.0.2:7717")
+
+	short, err := dsdk.NewSDK(&udc.UDC{
+		MgmtIp:     "127.0.0.1",
+		Username:   "foo",
+		Password:   "bar",
+		ApiVersion: "1",
+	}, false, dsdk.WithRetryTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	long, err := dsdk.NewSDK(&udc.UDC{
+		MgmtIp:     "127.0.0.2",
+		Username:   "foo",
+		Password:   "bar",
+		ApiVersion: "1",
+	}, false, dsdk.WithRetryTimeout(3*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type result struct {
+		err     error
+		elapsed time.Duration
+	}
+	run := func(sdk *dsdk.SDK, res *result, wg *sync.WaitGroup) {
+		defer wg.Done()
+		t1 := time.Now()
+		_, _, res.err = sdk.System.Get(&dsdk.SystemGetRequest{Ctxt: sdk.NewContext()})
+		res.elapsed = time.Since(t1)
+	}
+
+	var shortRes, longRes result
+	wg := &sync.WaitGroup{}
+	wg.Add(2)
+	go run(short, &shortRes, wg)
+	go run(long, &longRes, wg)
+	wg.Wait()
+
+	if !errors.Is(shortRes.err, dsdk.ErrRetryTimeout) {
+		t.Errorf("expected ErrRetryTimeout from short connection, got %v", shortRes.err)
+	}
+	if !errors.Is(longRes.err, dsdk.ErrRetryTimeout) {
+		t.Errorf("expected ErrRetryTimeout from long connection, got %v", longRes.err)
+	}
+	if shortRes.elapsed >= 3*time.Second {
+		t.Errorf("short connection retried for %s, longer than its own timeout allows", shortRes.elapsed)
+	}
+	if longRes.elapsed < 3*time.Second {
+		t.Errorf("long connection gave up after %s, before its 3s timeout", longRes.elapsed)
+	}
+}
+
+func TestRetrySleepHonorsContextCancellation(t *testing.T) {
+	defer gock.OffAll()
+	mockAlways503("http://127.0.0.1:7717")
+
+	sdk, err := dsdk.NewSDK(&udc.UDC{
+		MgmtIp:     "127.0.0.1",
+		Username:   "foo",
+		Password:   "bar",
+		ApiVersion: "1",
+	}, false, dsdk.WithRetryTimeout(time.Minute), dsdk.WithJitter(dsdk.NoJitter))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctxt, cancel := context.WithCancel(sdk.NewContext())
+	defer cancel()
+	time.AfterFunc(200*time.Millisecond, cancel)
+
+	t1 := time.Now()
+	_, _, err = sdk.System.Get(&dsdk.SystemGetRequest{Ctxt: ctxt})
+	elapsed := time.Since(t1)
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+	// the first backoff is a full second without jitter
+	if elapsed >= time.Second {
+		t.Errorf("retry kept sleeping for %s after the context was cancelled", elapsed)
+	}
+}
+
+func TestRetryAfterOnTooManyRequests(t *testing.T) {
+	defer gock.OffAll()
+	gock.New("http://127.0.0.1:7717").
+		Put("/v1/login").
+		Reply(200).
+		JSON(&dsdk.ApiLogin{Key: "thekey"})
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/system").
+		Reply(dsdk.TooManyRequests).
+		SetHeader("Retry-After", "2").
+		JSON(&dsdk.ApiErrorResponse{Message: "slow down"})
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/system").
+		Reply(200).
+		JSON(dsdk.ApiOuter{Data: map[string]interface{}{"name": "the system"}})
+
+	sdk, err := dsdk.NewSDK(&udc.UDC{
+		MgmtIp:     "127.0.0.1",
+		Username:   "foo",
+		Password:   "bar",
+		ApiVersion: "1",
+	}, false, dsdk.WithRetryTimeout(10*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t1 := time.Now()
+	sys, aer, err := sdk.System.Get(&dsdk.SystemGetRequest{Ctxt: sdk.NewContext()})
+	elapsed := time.Since(t1)
+	if err != nil || aer != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	if sys.Name != "the system" {
+		t.Errorf("unexpected system %+v", sys)
+	}
+	if elapsed < 2*time.Second || elapsed > 3*time.Second {
+		t.Errorf("expected to wait roughly 2s before retrying, waited %s", elapsed)
+	}
+	if gock.HasUnmatchedRequest() {
+		t.Error("received unexpected requests")
+	}
+}
+
+func TestConfigurableRetryableStatuses(t *testing.T) {
+	defer gock.OffAll()
+	gock.New("http://127.0.0.1:7717").
+		Put("/v1/login").
+		Reply(200).
+		JSON(&dsdk.ApiLogin{Key: "thekey"})
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/system").
+		Reply(502).
+		JSON(&dsdk.ApiErrorResponse{Message: "bad gateway"})
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/system").
+		Reply(200).
+		JSON(dsdk.ApiOuter{Data: map[string]interface{}{"name": "the system"}})
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/system").
+		Reply(400).
+		JSON(&dsdk.ApiErrorResponse{Message: "invalid", Http: 400})
+
+	sdk, err := dsdk.NewSDK(&udc.UDC{
+		MgmtIp:     "127.0.0.1",
+		Username:   "foo",
+		Password:   "bar",
+		ApiVersion: "1",
+	}, false, dsdk.WithRetryTimeout(5*time.Second),
+		dsdk.WithRetryableStatuses(dsdk.Retry503, 502, dsdk.ConnectionError))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sys, aer, err := sdk.System.Get(&dsdk.SystemGetRequest{Ctxt: sdk.NewContext()})
+	if err != nil || aer != nil {
+		t.Fatalf("expected the 502 to be retried, got %v %v", aer, err)
+	}
+	if sys.Name != "the system" {
+		t.Errorf("unexpected system %+v", sys)
+	}
+
+	t1 := time.Now()
+	_, aer, err = sdk.System.Get(&dsdk.SystemGetRequest{Ctxt: sdk.NewContext()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aer == nil || aer.Http != 400 {
+		t.Fatalf("expected a 400 ApiErrorResponse, got %+v", aer)
+	}
+	if elapsed := time.Since(t1); elapsed > time.Second {
+		t.Errorf("400 should not be retried, but took %s", elapsed)
+	}
+	if gock.HasUnmatchedRequest() {
+		t.Error("received unexpected requests")
+	}
+}
+
+func TestMaxAttempts(t *testing.T) {
+	defer gock.OffAll()
+	gock.New("http://127.0.0.1:7717").
+		Put("/v1/login").
+		Reply(200).
+		JSON(&dsdk.ApiLogin{Key: "thekey"})
+	// any attempt past the third shows up as an unmatched request
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/system").
+		Times(3).
+		Reply(503).
+		JSON(&dsdk.ApiErrorResponse{Message: "overloaded"})
+
+	sdk, err := dsdk.NewSDK(&udc.UDC{
+		MgmtIp:     "127.0.0.1",
+		Username:   "foo",
+		Password:   "bar",
+		ApiVersion: "1",
+	}, false, dsdk.WithRetryTimeout(time.Minute), dsdk.WithMaxBackoff(10*time.Millisecond),
+		dsdk.WithMaxAttempts(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = sdk.System.Get(&dsdk.SystemGetRequest{Ctxt: sdk.NewContext()})
+	if !errors.Is(err, dsdk.ErrMaxAttempts) {
+		t.Fatalf("expected ErrMaxAttempts, got %v", err)
+	}
+	if gock.HasUnmatchedRequest() {
+		t.Error("request was attempted more than 3 times")
+	}
+	if !gock.IsDone() {
+		t.Error("request was attempted fewer than 3 times")
+	}
+}
+
+// constantBackoff sleeps for the same interval before every retry and records the
+// attempts it was asked about
+type constantBackoff struct {
+	interval time.Duration
+	attempts []int
+}
+
+func (b *constantBackoff) NextInterval(attempt int) time.Duration {
+	b.attempts = append(b.attempts, attempt)
+	return b.interval
+}
+
+func TestBackoffStrategy(t *testing.T) {
+	defer gock.OffAll()
+	gock.New("http://127.0.0.1:7717").
+		Put("/v1/login").
+		Reply(200).
+		JSON(&dsdk.ApiLogin{Key: "thekey"})
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/system").
+		Times(3).
+		Reply(503).
+		JSON(&dsdk.ApiErrorResponse{Message: "overloaded"})
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/system").
+		Reply(200).
+		JSON(dsdk.ApiOuter{Data: map[string]interface{}{"name": "the system"}})
+
+	strategy := &constantBackoff{interval: 200 * time.Millisecond}
+	sdk, err := dsdk.NewSDK(&udc.UDC{
+		MgmtIp:     "127.0.0.1",
+		Username:   "foo",
+		Password:   "bar",
+		ApiVersion: "1",
+	}, false, dsdk.WithRetryTimeout(time.Minute), dsdk.WithBackoffStrategy(strategy))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t1 := time.Now()
+	_, aer, err := sdk.System.Get(&dsdk.SystemGetRequest{Ctxt: sdk.NewContext()})
+	elapsed := time.Since(t1)
+	if err != nil || aer != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	if !reflect.DeepEqual(strategy.attempts, []int{1, 2}) {
+		t.Errorf("expected the strategy to be asked about attempts [1 2], got %v", strategy.attempts)
+	}
+	// the first 503 is re-sent immediately, the two that follow each sleep once
+	if elapsed < 400*time.Millisecond || elapsed > time.Second {
+		t.Errorf("expected two 200ms sleeps, waited %s", elapsed)
+	}
+}
+
+func TestRetryStats(t *testing.T) {
+	defer gock.OffAll()
+	gock.New("http://127.0.0.1:7717").
+		Put("/v1/login").
+		Reply(200).
+		JSON(&dsdk.ApiLogin{Key: "thekey"})
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/system").
+		Times(3).
+		Reply(503).
+		JSON(&dsdk.ApiErrorResponse{Message: "overloaded"})
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/system").
+		Reply(200).
+		JSON(dsdk.ApiOuter{Data: map[string]interface{}{"name": "the system"}})
+
+	sdk, err := dsdk.NewSDK(&udc.UDC{
+		MgmtIp:     "127.0.0.1",
+		Username:   "foo",
+		Password:   "bar",
+		ApiVersion: "1",
+	}, false, dsdk.WithRetryTimeout(time.Minute),
+		dsdk.WithBackoffStrategy(&constantBackoff{interval: 50 * time.Millisecond}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats := &dsdk.RetryStats{}
+	ctxt := dsdk.WithRetryStats(sdk.NewContext(), stats)
+	_, aer, err := sdk.System.Get(&dsdk.SystemGetRequest{Ctxt: ctxt})
+	if err != nil || aer != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	// three 503s followed by the successful attempt, the login isn't counted
+	if stats.Attempts != 4 {
+		t.Errorf("expected 4 attempts, got %d", stats.Attempts)
+	}
+	if stats.LastStatus != 200 {
+		t.Errorf("expected last status 200, got %d", stats.LastStatus)
+	}
+	if stats.Backoff < 100*time.Millisecond {
+		t.Errorf("expected at least two 50ms sleeps, got %s", stats.Backoff)
+	}
+	if stats.Elapsed < stats.Backoff {
+		t.Errorf("elapsed %s is shorter than the time spent backing off %s", stats.Elapsed, stats.Backoff)
+	}
+}
+
+func TestOnRetry(t *testing.T) {
+	defer gock.OffAll()
+	gock.New("http://127.0.0.1:7717").
+		Put("/v1/login").
+		Reply(200).
+		JSON(&dsdk.ApiLogin{Key: "thekey"})
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/system").
+		Times(3).
+		Reply(503).
+		JSON(&dsdk.ApiErrorResponse{Message: "overloaded"})
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/system").
+		Reply(200).
+		JSON(dsdk.ApiOuter{Data: map[string]interface{}{"name": "the system"}})
+
+	var attempts, statuses []int
+	onRetry := func(attempt int, status int, err error, next time.Duration) {
+		if err != nil {
+			t.Errorf("unexpected error passed for a 503: %s", err)
+		}
+		attempts = append(attempts, attempt)
+		statuses = append(statuses, status)
+	}
+	sdk, err := dsdk.NewSDK(&udc.UDC{
+		MgmtIp:     "127.0.0.1",
+		Username:   "foo",
+		Password:   "bar",
+		ApiVersion: "1",
+	}, false, dsdk.WithRetryTimeout(time.Minute), dsdk.WithOnRetry(onRetry),
+		dsdk.WithBackoffStrategy(&constantBackoff{interval: 10 * time.Millisecond}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, aer, err := sdk.System.Get(&dsdk.SystemGetRequest{Ctxt: sdk.NewContext()})
+	if err != nil || aer != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	if !reflect.DeepEqual(attempts, []int{1, 2, 3}) {
+		t.Errorf("expected OnRetry for attempts [1 2 3], got %v", attempts)
+	}
+	if !reflect.DeepEqual(statuses, []int{503, 503, 503}) {
+		t.Errorf("expected OnRetry with statuses [503 503 503], got %v", statuses)
+	}
+}
+
+func TestIdempotencyKeyReusedAcrossRetries(t *testing.T) {
+	defer gock.OffAll()
+	var keys []string
+	gock.Observe(func(req *http.Request, mock gock.Mock) {
+		if req.URL.Path == "/v1/app_instances" {
+			keys = append(keys, req.Header.Get(dsdk.IdempotencyKeyHeader))
+		}
+	})
+	defer gock.Observe(nil)
+	gock.New("http://127.0.0.1:7717").
+		Put("/v1/login").
+		Reply(200).
+		JSON(&dsdk.ApiLogin{Key: "thekey"})
+	gock.New("http://127.0.0.1:7717").
+		Post("/v1/app_instances").
+		Reply(503).
+		JSON(&dsdk.ApiErrorResponse{Message: "overloaded"})
+	gock.New("http://127.0.0.1:7717").
+		Post("/v1/app_instances").
+		Times(2).
+		Reply(200).
+		JSON(dsdk.ApiOuter{Data: map[string]interface{}{"name": "my-ai"}})
+
+	sdk, err := dsdk.NewSDK(&udc.UDC{
+		MgmtIp:     "127.0.0.1",
+		Username:   "foo",
+		Password:   "bar",
+		ApiVersion: "1",
+	}, false, dsdk.WithRetryTimeout(time.Minute), dsdk.WithIdempotencyKeys(),
+		dsdk.WithRetryUnsafeMethods())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		_, aer, err := sdk.Conn.Post(sdk.NewContext(), "app_instances", &greq.RequestOptions{
+			JSON: map[string]string{"name": "my-ai"},
+		})
+		if err != nil || aer != nil {
+			t.Fatalf("unexpected error: %v %v", aer, err)
+		}
+	}
+	if len(keys) != 3 {
+		t.Fatalf("expected 3 requests, got %d", len(keys))
+	}
+	if keys[0] == "" || keys[0] != keys[1] {
+		t.Errorf("expected the retry to reuse the Idempotency-Key, got %q then %q", keys[0], keys[1])
+	}
+	if keys[2] == keys[0] {
+		t.Errorf("expected a new Idempotency-Key for a new request, got %q again", keys[2])
+	}
+}
+
+// mockMethod starts a mock for a request with the given method and path
+func mockMethod(method, path string) *gock.Request {
+	r := gock.New("http://127.0.0.1:7717")
+	switch method {
+	case "POST":
+		return r.Post(path)
+	case "PUT":
+		return r.Put(path)
+	case "DELETE":
+		return r.Delete(path)
+	case "PATCH":
+		return r.Patch(path)
+	default:
+		return r.Get(path)
+	}
+}
+
+func TestOnlyIdempotentMethodsRetried(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		opts    []dsdk.ApiConnectionOption
+		retried bool
+	}{
+		{name: "GET is retried", method: "GET", retried: true},
+		{name: "DELETE is retried", method: "DELETE", retried: true},
+		{name: "POST is not retried", method: "POST", retried: false},
+		{name: "PUT is not retried", method: "PUT", retried: false},
+		{name: "PATCH is not retried", method: "PATCH", retried: false},
+		{
+			name:    "POST is retried with RetryUnsafeMethods",
+			method:  "POST",
+			opts:    []dsdk.ApiConnectionOption{dsdk.WithRetryUnsafeMethods()},
+			retried: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer gock.OffAll()
+			gock.New("http://127.0.0.1:7717").
+				Put("/v1/login").
+				Reply(200).
+				JSON(&dsdk.ApiLogin{Key: "thekey"})
+			mockMethod(tt.method, "/v1/app_instances/my-ai").
+				Reply(503).
+				JSON(&dsdk.ApiErrorResponse{Message: "overloaded"})
+			mockMethod(tt.method, "/v1/app_instances/my-ai").
+				Reply(200).
+				JSON(dsdk.ApiOuter{Data: map[string]interface{}{"name": "my-ai"}})
+
+			opts := append([]dsdk.ApiConnectionOption{dsdk.WithRetryTimeout(time.Minute)}, tt.opts...)
+			sdk, err := dsdk.NewSDK(&udc.UDC{
+				MgmtIp:     "127.0.0.1",
+				Username:   "foo",
+				Password:   "bar",
+				ApiVersion: "1",
+			}, false, opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var aer *dsdk.ApiErrorResponse
+			ctxt := sdk.NewContext()
+			switch tt.method {
+			case "GET":
+				_, aer, err = sdk.Conn.Get(ctxt, "app_instances/my-ai", nil)
+			case "DELETE":
+				_, aer, err = sdk.Conn.Delete(ctxt, "app_instances/my-ai", nil)
+			case "POST":
+				_, aer, err = sdk.Conn.Post(ctxt, "app_instances/my-ai", nil)
+			case "PUT":
+				_, aer, err = sdk.Conn.Put(ctxt, "app_instances/my-ai", nil)
+			case "PATCH":
+				_, aer, err = sdk.Conn.Patch(ctxt, "app_instances/my-ai", nil)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.retried && aer != nil {
+				t.Errorf("expected the 503 to be retried, got %s", dsdk.Pretty(aer))
+			}
+			if !tt.retried && (aer == nil || aer.Http != 503) {
+				t.Errorf("expected the 503 to be returned, got %+v", aer)
+			}
+		})
+	}
+}
+
+func TestRetryTimeoutReturnsLastFailure(t *testing.T) {
+	defer gock.OffAll()
+	gock.New("http://127.0.0.1:7717").
+		Put("/v1/login").
+		Reply(200).
+		JSON(&dsdk.ApiLogin{Key: "thekey"})
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/system").
+		Reply(503).
+		JSON(&dsdk.ApiErrorResponse{Message: "overloaded"})
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/system").
+		Persist().
+		ReplyError(errors.New("dial tcp 127.0.0.1:7717: connect: connection refused"))
+
+	sdk, err := dsdk.NewSDK(&udc.UDC{
+		MgmtIp:     "127.0.0.1",
+		Username:   "foo",
+		Password:   "bar",
+		ApiVersion: "1",
+	}, false, dsdk.WithRetryTimeout(time.Second),
+		dsdk.WithBackoffStrategy(&constantBackoff{interval: 100 * time.Millisecond}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, aer, err := sdk.System.Get(&dsdk.SystemGetRequest{Ctxt: sdk.NewContext()})
+	if !errors.Is(err, dsdk.ErrRetryTimeout) {
+		t.Fatalf("expected ErrRetryTimeout, got %v", err)
+	}
+	// the cluster stopped answering after the 503, so that's what should be reported
+	if aer == nil || aer.Http != dsdk.ConnectionError {
+		t.Fatalf("expected a ConnectionError ApiErrorResponse, got %+v", aer)
+	}
+	if aer.Path != "/v1/system" {
+		t.Errorf("expected the failed path to be reported, got %q", aer.Path)
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	defer gock.OffAll()
+	mockAlways503("http://127.0.0.1:7717")
+
+	sdk, err := dsdk.NewSDK(&udc.UDC{
+		MgmtIp:     "127.0.0.1",
+		Username:   "foo",
+		Password:   "bar",
+		ApiVersion: "1",
+	}, false, dsdk.WithRetryTimeout(time.Minute), dsdk.WithRetryBudget(0, 2),
+		dsdk.WithBackoffStrategy(&constantBackoff{interval: 10 * time.Millisecond}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the first request spends both banked retries
+	stats := &dsdk.RetryStats{}
+	_, _, err = sdk.System.Get(&dsdk.SystemGetRequest{Ctxt: dsdk.WithRetryStats(sdk.NewContext(), stats)})
+	if !errors.Is(err, dsdk.ErrRetryBudgetExhausted) {
+		t.Fatalf("expected ErrRetryBudgetExhausted, got %v", err)
+	}
+	if stats.Attempts != 3 {
+		t.Errorf("expected 3 attempts while the budget lasted, got %d", stats.Attempts)
+	}
+
+	// and later requests aren't retried at all
+	_, aer, err := sdk.System.Get(&dsdk.SystemGetRequest{Ctxt: dsdk.WithRetryStats(sdk.NewContext(), stats)})
+	if !errors.Is(err, dsdk.ErrRetryBudgetExhausted) {
+		t.Fatalf("expected ErrRetryBudgetExhausted, got %v", err)
+	}
+	if stats.Attempts != 1 {
+		t.Errorf("expected a single attempt once the budget is spent, got %d", stats.Attempts)
+	}
+	if aer == nil || aer.Http != dsdk.Retry503 {
+		t.Errorf("expected the 503 to be returned, got %+v", aer)
+	}
+}
+
+func TestPatch(t *testing.T) {
+	defer gock.OffAll()
+	gock.New("http://127.0.0.1:7717").
+		Put("/v1/login").
+		Reply(200).
+		JSON(&dsdk.ApiLogin{Key: "thekey"})
+	mockMethod("PATCH", "/v1/app_instances/my-ai").
+		MatchHeader("Auth-Token", "^thekey$").
+		BodyString(`"descr":"patched"`).
+		Reply(200).
+		JSON(dsdk.ApiOuter{Data: map[string]interface{}{"name": "my-ai", "descr": "patched"}})
+	sdk, err := dsdk.NewSDK(&udc.UDC{
+		MgmtIp:     "127.0.0.1",
+		Username:   "foo",
+		Password:   "bar",
+		ApiVersion: "1",
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ro := &greq.RequestOptions{JSON: map[string]string{"descr": "patched"}}
+	rs, aer, err := sdk.Conn.Patch(sdk.NewContext(), "app_instances/my-ai", ro)
+	if aer != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	if rs.Data["descr"] != "patched" || !gock.IsDone() {
+		t.Errorf("expected the PATCH to reach the server, got %v", rs.Data)
+	}
+}
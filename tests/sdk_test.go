@@ -2,11 +2,16 @@ package dsdk_test
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -338,8 +343,9 @@ func TestRetryScenarios(t *testing.T) {
 					Reply(200).
 					JSON(&dsdk.ApiLogin{Key: "thekey"})
 
-				// mock multiple 503s followed by 200
-				for i := 0; i < 3; i++ {
+				// mock more 503s than can fit in the retry window (even with jittered
+				// backoff) followed by 200
+				for i := 0; i < 10; i++ {
 					gock.New("http://127.0.0.1:7717").
 						Get("/v1/system").
 						Reply(503).
@@ -353,7 +359,9 @@ func TestRetryScenarios(t *testing.T) {
 					JSON(testApiResponse)
 			},
 			expected: expected{
-				Err: dsdk.ErrRetryTimeout,
+				// the last 503 is returned to explain the timeout
+				ApiErr: &dsdk.ApiErrorResponse{Message: "overloaded", Http: dsdk.Retry503},
+				Err:    dsdk.ErrRetryTimeout,
 			},
 		},
 		{
@@ -489,7 +497,11 @@ func TestRetryScenarios(t *testing.T) {
 				Data:   s,
 			}
 
-			if diff := cmp.Diff(tC.expected, actual, cmpopts.EquateErrors()); diff != "" {
+			// ApiErrorResponse is an error too but should still be compared field by field
+			equateErr := cmp.FilterPath(func(p cmp.Path) bool {
+				return p.Last().String() == ".Err"
+			}, cmpopts.EquateErrors())
+			if diff := cmp.Diff(tC.expected, actual, equateErr); diff != "" {
 				t.Fatalf("did not get expected result: %s", diff)
 			}
 		})
@@ -616,3 +628,59 @@ func TestConcurrentLoginAttempts(t *testing.T) {
 	assert.Assert(t, aer2 == nil)
 
 }
+
+// apiVersionsServer serves versions from /api_versions and counts the requests made
+func apiVersionsServer(t *testing.T, versions ...string) (*httptest.Server, int, *int32) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.URL.Path != "/api_versions" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(&dsdk.ApiVersions{ApiVersions: versions})
+	}))
+	port, err := strconv.Atoi(srv.URL[strings.LastIndex(srv.URL, ":")+1:])
+	if err != nil {
+		srv.Close()
+		t.Fatal(err)
+	}
+	return srv, port, &requests
+}
+
+func TestSDKApiVersionCheck(t *testing.T) {
+	srv, port, requests := apiVersionsServer(t, "v2", "v2.1", "v2.2")
+	defer srv.Close()
+	conf := &udc.UDC{MgmtIp: "127.0.0.1", Username: "foo", Password: "bar", ApiVersion: "2.2"}
+
+	if _, err := dsdk.NewSDK(conf, false, dsdk.WithPort(port), dsdk.WithApiVersionCheck()); err != nil {
+		t.Errorf("unexpected error for a supported version: %v", err)
+	}
+
+	conf.ApiVersion = "1"
+	_, err := dsdk.NewSDK(conf, false, dsdk.WithPort(port), dsdk.WithApiVersionCheck())
+	if !errors.Is(err, dsdk.ErrUnsupportedApiVersion) {
+		t.Errorf("expected ErrUnsupportedApiVersion, got %v", err)
+	}
+	if n := atomic.LoadInt32(requests); n != 2 {
+		t.Errorf("expected an api_versions request per check, got %d requests", n)
+	}
+
+	// without the option no request is made
+	if _, err = dsdk.NewSDKWithHTTPClient(conf, false, &http.Client{}, dsdk.WithPort(port)); err != nil {
+		t.Errorf("unexpected error without the check: %v", err)
+	}
+	if n := atomic.LoadInt32(requests); n != 2 {
+		t.Errorf("expected no request without the check, got %d", n-2)
+	}
+}
+
+func TestSDKApiVersionCheckUnreachable(t *testing.T) {
+	srv, port, _ := apiVersionsServer(t)
+	srv.Close()
+	_, err := dsdk.NewSDK(&udc.UDC{MgmtIp: "127.0.0.1", Username: "foo", Password: "bar", ApiVersion: "2.2"}, false,
+		dsdk.WithPort(port), dsdk.WithApiVersionCheck())
+	if err == nil {
+		t.Errorf("expected an error when the cluster can't be reached")
+	}
+}
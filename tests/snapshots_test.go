@@ -0,0 +1,144 @@
+package dsdk_test
+
+import (
+	"testing"
+
+	dsdk "github.com/tjcelaya/go-datera/pkg/dsdk"
+	"gopkg.in/h2non/gock.v1"
+)
+
+const (
+	siPath   = "/app_instances/my-app/storage_instances/storage-1"
+	snapPath = siPath + "/snapshots/1600000000.123456789"
+)
+
+// getStorageInstance returns the storage instance at siPath through a fake server
+func getStorageInstance(t *testing.T) (*dsdk.SDK, *dsdk.StorageInstance) {
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1" + siPath).
+		Reply(200).
+		JSON(map[string]interface{}{"data": map[string]interface{}{
+			"name": "storage-1",
+			"path": siPath,
+		}})
+	sdk := newTestSDK(t)
+	ai := &dsdk.AppInstance{Path: "/app_instances/my-app"}
+	dsdk.RegisterAppInstanceEndpoints(ai)
+	si, aer, err := ai.StorageInstancesEp.Get(&dsdk.StorageInstancesGetRequest{Ctxt: sdk.NewContext(), Name: "storage-1"})
+	if aer != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	return sdk, si
+}
+
+func snapshotData() map[string]interface{} {
+	return map[string]interface{}{
+		"path":      snapPath,
+		"timestamp": "1600000000.123456789",
+		"uuid":      "snap-uuid",
+		"op_state":  "available",
+	}
+}
+
+func TestStorageInstanceSnapshotsCreate(t *testing.T) {
+	defer gock.OffAll()
+	sdk, si := getStorageInstance(t)
+	gock.New("http://127.0.0.1:7717").
+		Post("/v1" + siPath + "/snapshots").
+		JSON(map[string]string{"uuid": "snap-uuid"}).
+		Reply(200).
+		JSON(map[string]interface{}{"data": snapshotData()})
+
+	snap, aer, err := si.SnapshotsEp.Create(&dsdk.SnapshotsCreateRequest{Ctxt: sdk.NewContext(), Uuid: "snap-uuid"})
+	if aer != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	if snap.Timestamp != "1600000000.123456789" || snap.Uuid != "snap-uuid" || snap.Path != snapPath {
+		t.Errorf("unexpected snapshot %+v", snap)
+	}
+	if !gock.IsDone() {
+		t.Errorf("expected a POST to %s/snapshots", siPath)
+	}
+}
+
+func TestStorageInstanceSnapshotsList(t *testing.T) {
+	defer gock.OffAll()
+	sdk, si := getStorageInstance(t)
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1" + siPath + "/snapshots").
+		Reply(200).
+		JSON(map[string]interface{}{"data": []interface{}{snapshotData()}})
+
+	snaps, aer, err := si.SnapshotsEp.List(&dsdk.SnapshotsListRequest{Ctxt: sdk.NewContext()})
+	if aer != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	if len(snaps) != 1 || snaps[0].Timestamp != "1600000000.123456789" || snaps[0].Uuid != "snap-uuid" {
+		t.Errorf("unexpected snapshots %+v", snaps)
+	}
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	tests := []struct {
+		name        string
+		appInstance string
+		mock        func()
+	}{
+		{
+			name: "in place",
+			mock: func() {
+				gock.New("http://127.0.0.1:7717").
+					Put("/v1" + siPath).
+					JSON(map[string]string{"restore_point": "1600000000.123456789"}).
+					Reply(200).
+					JSON(map[string]interface{}{"data": map[string]interface{}{"path": siPath}})
+			},
+		},
+		{
+			name:        "new app instance",
+			appInstance: "my-app-restored",
+			mock: func() {
+				gock.New("http://127.0.0.1:7717").
+					Post("/v1/app_instances").
+					JSON(map[string]interface{}{
+						"name":               "my-app-restored",
+						"clone_snapshot_src": map[string]string{"path": snapPath},
+					}).
+					Reply(200).
+					JSON(map[string]interface{}{"data": map[string]interface{}{
+						"name": "my-app-restored",
+						"path": "/app_instances/my-app-restored",
+					}})
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer gock.OffAll()
+			sdk, si := getStorageInstance(t)
+			gock.New("http://127.0.0.1:7717").
+				Get("/v1" + siPath + "/snapshots/1600000000.123456789").
+				Reply(200).
+				JSON(map[string]interface{}{"data": snapshotData()})
+			tt.mock()
+
+			snap, aer, err := si.SnapshotsEp.Get(&dsdk.SnapshotsGetRequest{Ctxt: sdk.NewContext(), Timestamp: "1600000000.123456789"})
+			if aer != nil || err != nil {
+				t.Fatalf("unexpected error: %v %v", aer, err)
+			}
+			ai, aer, err := snap.Restore(&dsdk.SnapshotRestoreRequest{Ctxt: sdk.NewContext(), AppInstance: tt.appInstance})
+			if aer != nil || err != nil {
+				t.Fatalf("unexpected error: %v %v", aer, err)
+			}
+			if tt.appInstance == "" && ai != nil {
+				t.Errorf("expected no new app instance, got %+v", ai)
+			}
+			if tt.appInstance != "" && (ai == nil || ai.Name != tt.appInstance) {
+				t.Errorf("expected app instance %s, got %+v", tt.appInstance, ai)
+			}
+			if !gock.IsDone() {
+				t.Errorf("unmatched requests: %v", gock.Pending())
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package dsdk_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	dsdk "github.com/tjcelaya/go-datera/pkg/dsdk"
+	"gopkg.in/h2non/gock.v1"
+)
+
+func mockStorageNodes(nodes ...map[string]interface{}) {
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/storage_nodes$").
+		Reply(200).
+		JSON(map[string]interface{}{"data": nodes})
+}
+
+func mockNodeOpState(uuid, state string, times int) {
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/storage_nodes/" + uuid + "$").
+		Times(times).
+		Reply(200).
+		JSON(map[string]interface{}{"data": map[string]interface{}{
+			"uuid":     uuid,
+			"path":     "/storage_nodes/" + uuid,
+			"op_state": state,
+		}})
+}
+
+func TestStorageNodesSetMaintenance(t *testing.T) {
+	defer gock.OffAll()
+	sdk := newTestSDK(t, dsdk.WithBackoffStrategy(&constantBackoff{interval: 10 * time.Millisecond}))
+	mockStorageNodes(
+		map[string]interface{}{"uuid": "sn-1", "admin_state": "online", "health": "ok"},
+		map[string]interface{}{"uuid": "sn-2", "admin_state": "online", "health": "ok"},
+	)
+	gock.New("http://127.0.0.1:7717").
+		Put("/v1/storage_nodes/sn-1$").
+		JSON(map[string]interface{}{"admin_state": "maintenance"}).
+		Reply(200).
+		JSON(map[string]interface{}{"data": map[string]interface{}{
+			"uuid": "sn-1", "path": "/storage_nodes/sn-1", "admin_state": "maintenance", "op_state": "running",
+		}})
+	mockNodeOpState("sn-1", "running", 2)
+	mockNodeOpState("sn-1", "maintenance", 1)
+
+	node, apierr, err := sdk.StorageNodes.SetMaintenance(sdk.NewContext(), "sn-1", true)
+	if apierr != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", apierr, err)
+	}
+	if node.AdminState != dsdk.NodeMaintenance {
+		t.Errorf("expected sn-1 to be in maintenance, got %s", node.AdminState)
+	}
+	node, apierr, err = sdk.StorageNodes.WaitForDrain(sdk.NewContext(), "sn-1", 5*time.Second)
+	if apierr != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", apierr, err)
+	}
+	if node.OpState != dsdk.NodeMaintenance || !gock.IsDone() {
+		t.Errorf("expected to poll until sn-1 drained, got %s with pending mocks %v", node.OpState, gock.Pending())
+	}
+
+	gock.New("http://127.0.0.1:7717").
+		Put("/v1/storage_nodes/sn-1$").
+		JSON(map[string]interface{}{"admin_state": "online"}).
+		Reply(200).
+		JSON(map[string]interface{}{"data": map[string]interface{}{"uuid": "sn-1", "admin_state": "online"}})
+	if _, apierr, err = sdk.StorageNodes.SetMaintenance(sdk.NewContext(), "sn-1", false); apierr != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", apierr, err)
+	}
+}
+
+func TestStorageNodesSetMaintenanceLastNode(t *testing.T) {
+	defer gock.OffAll()
+	sdk := newTestSDK(t)
+	mockStorageNodes(
+		map[string]interface{}{"uuid": "sn-1", "admin_state": "online", "health": "ok"},
+		map[string]interface{}{"uuid": "sn-2", "admin_state": "online", "health": "degraded"},
+		map[string]interface{}{"uuid": "sn-3", "admin_state": "maintenance", "health": "ok"},
+	)
+
+	_, _, err := sdk.StorageNodes.SetMaintenance(sdk.NewContext(), "sn-1", true)
+	if !errors.Is(err, dsdk.ErrInvalidRequest) {
+		t.Errorf("expected draining the last healthy node to be refused, got %v", err)
+	}
+	if gock.HasUnmatchedRequest() {
+		t.Errorf("unexpected requests: %v", gock.GetUnmatchedRequests())
+	}
+}
+
+func TestStorageNodesListDrives(t *testing.T) {
+	defer gock.OffAll()
+	sdk := newTestSDK(t)
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/storage_nodes/sn-1/hdds$").
+		Reply(200).
+		JSON(map[string]interface{}{"data": []map[string]interface{}{{
+			"path": "/storage_nodes/sn-1/hdds/1", "id": "1", "serial_no": "ZC1", "size": 4000000,
+			"health": "ok", "slot_label": "A1", "model": "ST4000", "vendor": "Seagate",
+		}}})
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/storage_nodes/sn-1/flash_devices$").
+		Reply(200).
+		JSON(map[string]interface{}{"data": []map[string]interface{}{{
+			"path": "/storage_nodes/sn-1/flash_devices/2", "id": "2", "serial_no": "S3F", "size": 960000,
+			"health": "failed", "slot_label": "B2", "causes": []string{"media errors"},
+		}}})
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/storage_nodes/sn-1/nvm_flash_devices$").
+		Reply(404).
+		JSON(map[string]interface{}{"name": "NotFoundError", "message": "not found", "code": 404})
+
+	drives, apierr, err := sdk.StorageNodes.ListDrives(sdk.NewContext(), "sn-1")
+	if apierr != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", apierr, err)
+	}
+	if len(drives) != 2 {
+		t.Fatalf("expected 2 drives, got %d", len(drives))
+	}
+	hdd, flash := drives[0], drives[1]
+	if hdd.MediaType != dsdk.DriveHdd || hdd.SerialNo != "ZC1" || hdd.Size != 4000000 || hdd.Health != "ok" ||
+		hdd.SlotLabel != "A1" || hdd.Vendor != "Seagate" {
+		t.Errorf("unexpected hdd: %+v", hdd)
+	}
+	if flash.MediaType != dsdk.DriveFlash || flash.SerialNo != "S3F" || flash.Health != "failed" ||
+		flash.SlotLabel != "B2" || len(flash.Causes) != 1 {
+		t.Errorf("unexpected flash device: %+v", flash)
+	}
+
+	for _, c := range []string{"hdds", "flash_devices", "nvm_flash_devices"} {
+		gock.New("http://127.0.0.1:7717").
+			Get("/v1/storage_nodes/missing/" + c + "$").
+			Reply(404).
+			JSON(map[string]interface{}{"name": "NotFoundError", "message": "not found", "code": 404})
+	}
+	if _, _, err = sdk.StorageNodes.ListDrives(sdk.NewContext(), "missing"); !dsdk.IsNotFound(err) {
+		t.Errorf("expected a missing node to be not found, got %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+package dsdk_test
+
+import (
+	"errors"
+	"testing"
+
+	dsdk "github.com/tjcelaya/go-datera/pkg/dsdk"
+	"gopkg.in/h2non/gock.v1"
+)
+
+func TestStoragePoolCreateDelete(t *testing.T) {
+	defer gock.OffAll()
+	gock.New("http://127.0.0.1:7717").
+		Post("/v1/storage_pools$").
+		JSON(map[string]interface{}{
+			"name":       "flash",
+			"media_type": "ssd",
+			"members": []map[string]interface{}{
+				{"path": "/storage_nodes/sn-1"},
+				{"path": "/storage_nodes/sn-2"},
+			},
+		}).
+		Reply(200).
+		JSON(map[string]interface{}{"data": map[string]interface{}{
+			"path": "/storage_pools/sp-1", "name": "flash", "media_type": "ssd",
+		}})
+	gock.New("http://127.0.0.1:7717").
+		Delete("/v1/storage_pools/sp-1$").
+		MatchParam("force", "^true$").
+		Reply(200).
+		JSON(map[string]interface{}{"data": map[string]interface{}{"path": "/storage_pools/sp-1", "name": "flash"}})
+
+	sdk := newTestSDK(t)
+	pool, apierr, err := sdk.StoragePools.Create(&dsdk.StoragePoolsCreateRequest{
+		Ctxt:      sdk.NewContext(),
+		Name:      "flash",
+		MediaType: "ssd",
+		Members:   []*dsdk.StorageNode{{Path: "/storage_nodes/sn-1"}, {Path: "/storage_nodes/sn-2"}},
+	})
+	if apierr != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", apierr, err)
+	}
+	if pool.Path != "/storage_pools/sp-1" || pool.MediaType != "ssd" {
+		t.Errorf("unexpected pool: %+v", pool)
+	}
+	if _, apierr, err = pool.Delete(&dsdk.StoragePoolDeleteRequest{Ctxt: sdk.NewContext(), Force: true}); apierr != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", apierr, err)
+	}
+	if !gock.IsDone() {
+		t.Errorf("pending mocks: %v", gock.Pending())
+	}
+}
+
+func TestStoragePoolsUsageReport(t *testing.T) {
+	defer gock.OffAll()
+	member := func(uuid string) map[string]interface{} {
+		return map[string]interface{}{"path": "/storage_nodes/" + uuid}
+	}
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/storage_pools$").
+		Reply(200).
+		JSON(map[string]interface{}{"data": []map[string]interface{}{
+			{"name": "empty", "path": "/storage_pools/p1", "members": []map[string]interface{}{member("sn-1")}},
+			{"name": "filling", "path": "/storage_pools/p2", "members": []map[string]interface{}{member("sn-2"), member("sn-3")}},
+			{"name": "full", "path": "/storage_pools/p3", "members": []map[string]interface{}{member("sn-4")}},
+			{"name": "bare", "path": "/storage_pools/p4"},
+		}})
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/storage_nodes$").
+		Reply(200).
+		JSON(map[string]interface{}{"data": []map[string]interface{}{
+			{"uuid": "sn-1", "path": "/storage_nodes/sn-1", "total_capacity": 1000, "available_capacity": 900},
+			{"uuid": "sn-2", "path": "/storage_nodes/sn-2", "total_capacity": 1000, "available_capacity": 200},
+			{"uuid": "sn-3", "path": "/storage_nodes/sn-3", "total_capacity": 1000, "available_capacity": 200},
+			{"uuid": "sn-4", "path": "/storage_nodes/sn-4", "total_capacity": 1000, "available_capacity": 50},
+		}})
+
+	sdk := newTestSDK(t)
+	report, apierr, err := sdk.StoragePools.UsageReport(sdk.NewContext(), 80, 95)
+	if apierr != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", apierr, err)
+	}
+	want := []struct {
+		name     string
+		capacity int
+		usedPct  float64
+		severity string
+	}{
+		{"empty", 1000, 10, dsdk.SeverityInfo},
+		{"filling", 2000, 80, dsdk.SeverityWarning},
+		{"full", 1000, 95, dsdk.SeverityCritical},
+		{"bare", 0, 0, dsdk.SeverityInfo},
+	}
+	if len(report) != len(want) {
+		t.Fatalf("expected %d pools, got %d", len(want), len(report))
+	}
+	for i, w := range want {
+		u := report[i]
+		if u.Name != w.name || u.Capacity != w.capacity || u.UsedPct != w.usedPct || u.Severity != w.severity {
+			t.Errorf("expected %+v, got %+v", w, u)
+		}
+	}
+
+	if _, _, err = sdk.StoragePools.UsageReport(sdk.NewContext(), 95, 80); !errors.Is(err, dsdk.ErrInvalidRequest) {
+		t.Errorf("expected inverted thresholds to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,108 @@
+package dsdk_test
+
+import (
+	"fmt"
+	"testing"
+
+	dsdk "github.com/tjcelaya/go-datera/pkg/dsdk"
+	"gopkg.in/h2non/gock.v1"
+)
+
+func TestSystemSetNtpServers(t *testing.T) {
+	defer gock.OffAll()
+	ntp := []string{"0.pool.ntp.org", "1.pool.ntp.org"}
+	// only the NTP servers are sent, the DNS settings aren't touched
+	gock.New("http://127.0.0.1:7717").
+		Put("/v1/system").
+		JSON(map[string]interface{}{"ntp_servers": ntp}).
+		Reply(200).
+		JSON(dsdk.ApiOuter{Data: map[string]interface{}{
+			"name":        "the system",
+			"ntp_servers": ntp,
+			"dns": map[string]interface{}{
+				"servers":        []string{"10.0.0.53"},
+				"search_domains": []string{"example.com"},
+			},
+		}})
+	sdk := newTestSDK(t)
+
+	sys, aer, err := sdk.System.Set(&dsdk.SystemSetRequest{Ctxt: sdk.NewContext(), NtpServers: ntp})
+	if aer != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	if fmt.Sprint(sys.NtpServers) != fmt.Sprint(ntp) {
+		t.Errorf("expected NTP servers %v, got %v", ntp, sys.NtpServers)
+	}
+	if sys.Dns == nil || fmt.Sprint(sys.Dns.Servers) != "[10.0.0.53]" || fmt.Sprint(sys.Dns.SearchDomains) != "[example.com]" {
+		t.Errorf("expected the DNS settings to be unchanged, got %+v", sys.Dns)
+	}
+	if !gock.IsDone() {
+		t.Errorf("expected a PUT with only the NTP servers, pending: %v", gock.Pending())
+	}
+}
+
+func TestSystemCapacitySummary(t *testing.T) {
+	defer gock.OffAll()
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/system").
+		Reply(200).
+		JSON(dsdk.ApiOuter{Data: map[string]interface{}{"total_provisioned_capacity": 5000}})
+	node := func(name string, raw, usable, free int) map[string]interface{} {
+		return map[string]interface{}{
+			"name":               name,
+			"total_raw_capacity": raw,
+			"total_capacity":     usable,
+			"available_capacity": free,
+		}
+	}
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/storage_nodes").
+		Reply(200).
+		JSON(map[string]interface{}{"data": []interface{}{
+			node("node-1", 1200, 1000, 400),
+			node("node-2", 1200, 1000, 250),
+			node("node-3", 2400, 2000, 1350),
+		}})
+	sdk := newTestSDK(t)
+
+	summary, aer, err := sdk.System.CapacitySummary(sdk.NewContext())
+	if aer != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	want := dsdk.CapacitySummary{Raw: 4800, Usable: 4000, Used: 2000, Free: 2000, Provisioned: 5000}
+	if *summary != want {
+		t.Errorf("expected %+v, got %+v", want, *summary)
+	}
+}
+
+func TestSystemSetSnmpPolicy(t *testing.T) {
+	defer gock.OffAll()
+	snmp := map[string]interface{}{"enabled": true, "location": "rack 4", "contact": "ops@example.com"}
+	gock.New("http://127.0.0.1:7717").
+		Put("/v1/system").
+		JSON(map[string]interface{}{"snmp_policy": snmp}).
+		Reply(200).
+		JSON(dsdk.ApiOuter{Data: map[string]interface{}{
+			"name":        "the system",
+			"ntp_servers": []string{"0.pool.ntp.org"},
+			"snmp_policy": snmp,
+		}})
+	sdk := newTestSDK(t)
+
+	sys, aer, err := sdk.System.Set(&dsdk.SystemSetRequest{
+		Ctxt:       sdk.NewContext(),
+		SnmpPolicy: &dsdk.SnmpPolicy{Enabled: true, Location: "rack 4", Contact: "ops@example.com"},
+	})
+	if aer != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	if sys.SnmpPolicy == nil || !sys.SnmpPolicy.Enabled || sys.SnmpPolicy.Location != "rack 4" || sys.SnmpPolicy.Contact != "ops@example.com" {
+		t.Errorf("unexpected SNMP policy %+v", sys.SnmpPolicy)
+	}
+	if fmt.Sprint(sys.NtpServers) != "[0.pool.ntp.org]" {
+		t.Errorf("expected the NTP servers to be unchanged, got %v", sys.NtpServers)
+	}
+	if !gock.IsDone() {
+		t.Errorf("expected a PUT with only the SNMP policy, pending: %v", gock.Pending())
+	}
+}
@@ -0,0 +1,244 @@
+package dsdk_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	greq "github.com/levigross/grequests"
+	dsdk "github.com/tjcelaya/go-datera/pkg/dsdk"
+	"gopkg.in/h2non/gock.v1"
+)
+
+// mockSystemInTenant expects a single system request made in tenant
+func mockSystemInTenant(tenant string) {
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/system").
+		MatchHeader("tenant", "^"+tenant+"$").
+		Reply(200).
+		JSON(dsdk.ApiOuter{Data: map[string]interface{}{"name": "the system"}})
+}
+
+func TestPerRequestTenant(t *testing.T) {
+	defer gock.OffAll()
+	mockSystemInTenant("/root/other")
+	mockSystemInTenant("/root/header")
+	mockSystemInTenant("/root/default")
+	sdk := newTestSDKInTenant(t, "/root/default")
+
+	ctxt := dsdk.WithRequestTenant(sdk.NewContext(), "/root/other")
+	if _, aer, err := sdk.System.Get(&dsdk.SystemGetRequest{Ctxt: ctxt}); err != nil || aer != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	ro := &greq.RequestOptions{Headers: map[string]string{"tenant": "/root/header"}}
+	if _, aer, err := sdk.Conn.Get(ctxt, "system", ro); err != nil || aer != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	if _, aer, err := sdk.System.Get(&dsdk.SystemGetRequest{Ctxt: sdk.NewContext()}); err != nil || aer != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	if gock.HasUnmatchedRequest() {
+		t.Error("request made in the wrong tenant")
+	}
+}
+
+func TestRequestTenantKeyCantBeForged(t *testing.T) {
+	defer gock.OffAll()
+	mockSystemInTenant("/root/default")
+	sdk := newTestSDKInTenant(t, "/root/default")
+
+	// only WithRequestTenant picks the tenant, not a value under the key's old name
+	ctxt := context.WithValue(sdk.NewContext(), dsdk.ContextKey("tenant"), "/root/other")
+	if _, aer, err := sdk.System.Get(&dsdk.SystemGetRequest{Ctxt: ctxt}); err != nil || aer != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	if gock.HasUnmatchedRequest() {
+		t.Error("request made in the wrong tenant")
+	}
+}
+
+func TestSetTenant(t *testing.T) {
+	defer gock.OffAll()
+	mockSystemInTenant("/root/first")
+	mockSystemInTenant("/root/second")
+	// a single login is shared by both tenants
+	sdk := newTestSDKInTenant(t, "/root/first")
+
+	if _, aer, err := sdk.System.Get(&dsdk.SystemGetRequest{Ctxt: sdk.NewContext()}); err != nil || aer != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	sdk.Conn.SetTenant("/root/second")
+	if _, aer, err := sdk.System.Get(&dsdk.SystemGetRequest{Ctxt: sdk.NewContext()}); err != nil || aer != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	if gock.HasUnmatchedRequest() {
+		t.Error("received unexpected requests")
+	}
+}
+
+func TestSetTenantReusedRequestOptions(t *testing.T) {
+	defer gock.OffAll()
+	mockSystemInTenant("/root/first")
+	mockSystemInTenant("/root/second")
+	sdk := newTestSDKInTenant(t, "/root/first")
+
+	// the tenant of the first request mustn't stick to ro
+	ro := &greq.RequestOptions{}
+	if _, aer, err := sdk.Conn.Get(sdk.NewContext(), "system", ro); err != nil || aer != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	if ro.Headers != nil {
+		t.Errorf("expected the request options to be left untouched, got headers %v", ro.Headers)
+	}
+	sdk.Conn.SetTenant("/root/second")
+	if _, aer, err := sdk.Conn.Get(sdk.NewContext(), "system", ro); err != nil || aer != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	if gock.HasUnmatchedRequest() {
+		t.Error("request made in the wrong tenant")
+	}
+}
+
+func TestCreateSubTenant(t *testing.T) {
+	defer gock.OffAll()
+	sdk := newTestSDK(t)
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/tenants/root/customers").
+		Reply(200).
+		JSON(dsdk.ApiOuter{Data: map[string]interface{}{"name": "customers", "path": "/root/customers"}})
+	gock.New("http://127.0.0.1:7717").
+		Post("/v1/tenants").
+		MatchHeader("tenant", "^/root/customers$").
+		JSON(map[string]string{"name": "acme"}).
+		Reply(200).
+		JSON(dsdk.ApiOuter{Data: map[string]interface{}{
+			"name":        "acme",
+			"path":        "/root/customers/acme",
+			"parent_path": "/root/customers",
+		}})
+
+	tenant, aer, err := sdk.Tenants.CreateSubTenant(sdk.NewContext(), "customers", "acme")
+	if aer != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	if tenant.Name != "acme" || tenant.Path != "/root/customers/acme" || tenant.ParentPath != "/root/customers" {
+		t.Errorf("unexpected tenant %+v", tenant)
+	}
+	if !gock.IsDone() {
+		t.Errorf("unmatched mocks: %v", gock.Pending())
+	}
+}
+
+func TestCreateSubTenantMissingParent(t *testing.T) {
+	defer gock.OffAll()
+	gock.CleanUnmatchedRequest()
+	sdk := newTestSDK(t)
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/tenants/root/missing").
+		Reply(404).
+		JSON(dsdk.ApiErrorResponse{Name: "NotFoundError", Message: "tenant not found", Http: 404})
+
+	_, aer, err := sdk.Tenants.CreateSubTenant(sdk.NewContext(), "/root/missing", "acme")
+	if err != nil || !dsdk.IsNotFound(aer) {
+		t.Errorf("expected the missing parent to be reported, got %v %v", aer, err)
+	}
+	if gock.HasUnmatchedRequest() {
+		t.Error("expected the tenant not to be created")
+	}
+}
+
+// mockTenant answers a GET of the tenant at path listing subtenants
+func mockTenant(path string, subtenants ...string) {
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/tenants" + path + "$").
+		Reply(200).
+		JSON(dsdk.ApiOuter{Data: map[string]interface{}{
+			"name":       path[strings.LastIndex(path, "/")+1:],
+			"path":       path,
+			"subtenants": subtenants,
+		}})
+}
+
+// treePaths flattens the tree at node into "path[children]" form
+func treePaths(node *dsdk.TenantNode) string {
+	children := []string{}
+	for _, child := range node.Children {
+		children = append(children, treePaths(child))
+	}
+	return node.Tenant.Path + fmt.Sprint(children)
+}
+
+func TestTenantsListTree(t *testing.T) {
+	defer gock.OffAll()
+	sdk := newTestSDK(t)
+	mockTenant("/root/org", "/root/org/a", "b")
+	mockTenant("/root/org/a", "/root/org/a/x")
+	// x lists its grandparent again, which mustn't be followed
+	mockTenant("/root/org/a/x", "/root/org")
+	mockTenant("/root/org/b")
+
+	tree, aer, err := sdk.Tenants.ListTree(sdk.NewContext(), "org")
+	if aer != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	want := "/root/org[/root/org/a[/root/org/a/x[]] /root/org/b[]]"
+	if got := treePaths(tree); got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+	if !gock.IsDone() {
+		t.Errorf("unmatched mocks: %v", gock.Pending())
+	}
+}
+
+func TestTenantsListTreeDepth(t *testing.T) {
+	defer gock.OffAll()
+	sdk := newTestSDK(t)
+	// every tenant has a sub-tenant named d
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/tenants/root/deep").
+		Persist().
+		Reply(200).
+		JSON(dsdk.ApiOuter{Data: map[string]interface{}{"subtenants": []string{"d"}}})
+
+	if _, aer, err := sdk.Tenants.ListTree(sdk.NewContext(), "/root/deep"); aer != nil || err == nil {
+		t.Errorf("expected the depth to be capped, got %v %v", aer, err)
+	}
+}
+
+func TestTenantsQuota(t *testing.T) {
+	defer gock.OffAll()
+	sdk := newTestSDK(t)
+	current := map[string]interface{}{"capacity": 100, "volumes": 10, "replica_limit": 3}
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/tenants/root/acme").
+		Times(2).
+		Reply(200).
+		JSON(dsdk.ApiOuter{Data: map[string]interface{}{"name": "acme", "path": "/root/acme", "quota": current}})
+	updated := map[string]interface{}{"capacity": 200, "volumes": 10, "snapshots": 50, "replica_limit": 3}
+	gock.New("http://127.0.0.1:7717").
+		Put("/v1/tenants/root/acme").
+		JSON(map[string]interface{}{"quota": updated}).
+		Reply(200).
+		JSON(dsdk.ApiOuter{Data: map[string]interface{}{"name": "acme", "path": "/root/acme", "quota": updated}})
+
+	q, aer, err := sdk.Tenants.GetQuota(sdk.NewContext(), "acme")
+	if aer != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	if q.Capacity == nil || *q.Capacity != 100 || q.Volumes == nil || *q.Volumes != 10 || q.Snapshots != nil {
+		t.Errorf("unexpected quota %+v", q)
+	}
+
+	capacity, snapshots := 200, 50
+	q, aer, err = sdk.Tenants.SetQuota(sdk.NewContext(), "/root/acme", &dsdk.TenantQuota{Capacity: &capacity, Snapshots: &snapshots})
+	if aer != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	if *q.Capacity != 200 || *q.Volumes != 10 || *q.Snapshots != 50 {
+		t.Errorf("unexpected quota %+v", q)
+	}
+	if !gock.IsDone() {
+		t.Errorf("expected the merged quota to be written, pending: %v", gock.Pending())
+	}
+}
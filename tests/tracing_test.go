@@ -0,0 +1,102 @@
+package dsdk_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	greq "github.com/levigross/grequests"
+	dsdk "github.com/tjcelaya/go-datera/pkg/dsdk"
+	"gopkg.in/h2non/gock.v1"
+)
+
+type recordedSpan struct {
+	name  string
+	attrs map[string]interface{}
+	errs  []error
+	ended bool
+}
+
+func (s *recordedSpan) SetAttributes(attrs map[string]interface{}) {
+	for k, v := range attrs {
+		s.attrs[k] = v
+	}
+}
+func (s *recordedSpan) RecordError(err error) { s.errs = append(s.errs, err) }
+func (s *recordedSpan) End()                  { s.ended = true }
+
+// spanRecorder keeps every span started with it in memory
+type spanRecorder struct {
+	m     sync.Mutex
+	spans []*recordedSpan
+}
+
+func (r *spanRecorder) Start(ctx context.Context, name string) dsdk.Span {
+	r.m.Lock()
+	defer r.m.Unlock()
+	s := &recordedSpan{name: name, attrs: map[string]interface{}{}}
+	r.spans = append(r.spans, s)
+	return s
+}
+
+// named returns the spans started with name
+func (r *spanRecorder) named(name string) []*recordedSpan {
+	r.m.Lock()
+	defer r.m.Unlock()
+	spans := []*recordedSpan{}
+	for _, s := range r.spans {
+		if s.name == name {
+			spans = append(spans, s)
+		}
+	}
+	return spans
+}
+
+func TestWithTracer(t *testing.T) {
+	defer gock.OffAll()
+	recorder := &spanRecorder{}
+	sdk := newTestSDK(t, dsdk.WithTracer(recorder))
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/app_instances/my-app").
+		Reply(200).
+		JSON(dsdk.ApiOuter{Data: map[string]interface{}{"name": "my-app"}})
+
+	if _, aer, err := sdk.Conn.Get(sdk.NewContext(), "app_instances/my-app", &greq.RequestOptions{}); aer != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", aer, err)
+	}
+	if n := len(recorder.named("/v1/login")); n != 1 {
+		t.Errorf("expected one login span, got %d", n)
+	}
+	spans := recorder.named("/v1/app_instances/:id")
+	if len(spans) != 1 {
+		t.Fatalf("expected one span named after the canonical route, got %d", len(spans))
+	}
+	s := spans[0]
+	if s.attrs["http.method"] != "GET" || s.attrs["http.status_code"] != 200 || s.attrs["request_id"] == "" {
+		t.Errorf("unexpected span attributes %v", s.attrs)
+	}
+	if len(s.errs) != 0 || !s.ended {
+		t.Errorf("expected an ended span without errors, got %v ended=%v", s.errs, s.ended)
+	}
+}
+
+func TestWithTracerRecordsErrors(t *testing.T) {
+	defer gock.OffAll()
+	recorder := &spanRecorder{}
+	sdk := newTestSDK(t, dsdk.WithTracer(recorder))
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/system").
+		Reply(400).
+		JSON(dsdk.ApiErrorResponse{Message: "bad request", Http: 400})
+
+	if _, aer, _ := sdk.Conn.Get(sdk.NewContext(), "system", &greq.RequestOptions{}); aer == nil {
+		t.Fatal("expected the request to fail")
+	}
+	spans := recorder.named("/v1/system")
+	if len(spans) != 1 {
+		t.Fatalf("expected one span, got %d", len(spans))
+	}
+	if s := spans[0]; len(s.errs) != 1 || s.attrs["http.status_code"] != 400 || !s.ended {
+		t.Errorf("expected the failure to be recorded on an ended span, got %v %v ended=%v", s.errs, s.attrs, s.ended)
+	}
+}
@@ -0,0 +1,63 @@
+package dsdk_test
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/h2non/gock.v1"
+)
+
+func TestUserDataKeys(t *testing.T) {
+	defer gock.OffAll()
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/app_instances/my-app/user_data$").
+		Times(2).
+		Reply(200).
+		JSON(map[string]interface{}{"data": map[string]interface{}{
+			"app_instance_id": "my-app",
+			"data":            map[string]interface{}{"owner": "ops", "ticket": "T-1", "replicas": 3},
+		}})
+	// only the keys being changed change, ticket is deleted
+	gock.New("http://127.0.0.1:7717").
+		Put("/v1/app_instances/my-app/user_data$").
+		JSON(map[string]interface{}{"data": map[string]interface{}{"owner": "storage", "env": "prod", "replicas": 3}}).
+		Reply(200).
+		JSON(map[string]interface{}{"data": map[string]interface{}{}})
+	gock.New("http://127.0.0.1:7717").
+		Get("/v1/app_instances/new-app/user_data$").
+		Reply(404).
+		JSON(map[string]interface{}{"name": "NotFoundError", "message": "not found", "code": 404})
+	gock.New("http://127.0.0.1:7717").
+		Put("/v1/app_instances/new-app/user_data$").
+		JSON(map[string]interface{}{"data": map[string]interface{}{"owner": "ops"}}).
+		Reply(200).
+		JSON(map[string]interface{}{"data": map[string]interface{}{}})
+
+	sdk := newTestSDK(t)
+	data, apierr, err := sdk.UserData.GetKeys(sdk.NewContext(), "/app_instances/my-app")
+	if apierr != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", apierr, err)
+	}
+	if want := map[string]string{"owner": "ops", "ticket": "T-1", "replicas": "3"}; !reflect.DeepEqual(data, want) {
+		t.Errorf("expected %v, got %v", want, data)
+	}
+
+	data, apierr, err = sdk.UserData.SetKeys(sdk.NewContext(), "/app_instances/my-app", map[string]string{
+		"owner":  "storage",
+		"env":    "prod",
+		"ticket": "",
+	})
+	if apierr != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", apierr, err)
+	}
+	if want := map[string]string{"owner": "storage", "env": "prod", "replicas": "3"}; !reflect.DeepEqual(data, want) {
+		t.Errorf("expected %v, got %v", want, data)
+	}
+
+	if _, apierr, err = sdk.UserData.SetKeys(sdk.NewContext(), "/app_instances/new-app", map[string]string{"owner": "ops"}); apierr != nil || err != nil {
+		t.Fatalf("unexpected error: %v %v", apierr, err)
+	}
+	if !gock.IsDone() {
+		t.Errorf("pending mocks: %v", gock.Pending())
+	}
+}